@@ -0,0 +1,315 @@
+package netconsoled
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// alertmanagerAlertsPath is the path of the Alertmanager v2 alerts endpoint.
+const alertmanagerAlertsPath = "/api/v2/alerts"
+
+// DefaultAlertName is the default alertname label for alerts sent by an
+// Alertmanager Sink.
+const DefaultAlertName = "NetconsoleKernelEvent"
+
+// An AlertmanagerConfig configures an Alertmanager Sink.
+type AlertmanagerConfig struct {
+	// URL is the URL of the Alertmanager.  If URL has no path,
+	// "/api/v2/alerts" is used.
+	URL string
+
+	// Username and Password, if set, are used for HTTP basic authentication.
+	Username string
+	Password string
+
+	// Events are the Events which raise an alert.  If empty, EventPanic,
+	// EventOops, and EventHungTask are used.
+	Events []Event
+
+	// AlertName is the alertname label of each alert.  If empty,
+	// DefaultAlertName is used.
+	AlertName string
+
+	// Labels are added to the labels of each alert.
+	Labels map[string]string
+
+	// Resolve is the amount of time after an Event was last seen before its
+	// alert is resolved.  If zero, 5 minutes is used.
+	Resolve time.Duration
+
+	// MaxRetries is the number of times a failed request is retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, requests are
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the timeout for each request.  If zero, 10 seconds is used.
+	Timeout time.Duration
+}
+
+// AlertmanagerSink creates a BatchSink which posts an alert to a Prometheus
+// Alertmanager when a log contains one of the configured Events.
+//
+// Each alert is labeled with the host and event which raised it, and
+// resolves automatically once the Event has not been seen for the configured
+// Resolve duration.  Every occurrence of an Event extends the end time of its
+// alert and keeps the start time of the first occurrence, but repeated Events
+// from the same host within a batch are sent as a single alert.  Requests
+// which fail are retried with exponential backoff before an error is
+// returned.
+func AlertmanagerSink(cfg AlertmanagerConfig) (BatchSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Alertmanager URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Alertmanager URL must use HTTP or HTTPS: %q", cfg.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = alertmanagerAlertsPath
+	}
+
+	if len(cfg.Events) == 0 {
+		cfg.Events = []Event{EventPanic, EventOops, EventHungTask}
+	}
+	for _, e := range cfg.Events {
+		if !knownEvent(e) {
+			return nil, fmt.Errorf("unknown Alertmanager event: %q", e)
+		}
+	}
+
+	if cfg.AlertName == "" {
+		cfg.AlertName = DefaultAlertName
+	}
+	for k := range cfg.Labels {
+		switch k {
+		case "alertname", "host", "event":
+			return nil, fmt.Errorf("Alertmanager label %q is reserved", k)
+		}
+	}
+
+	if cfg.Resolve <= 0 {
+		cfg.Resolve = 5 * time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &alertmanagerSink{
+		cfg:    cfg,
+		url:    u.String(),
+		name:   redactURL(u),
+		retry:  newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+		client: &http.Client{Timeout: cfg.Timeout},
+		active: make(map[alertKey]activeAlert),
+	}, nil
+}
+
+var (
+	_ BatchSink        = &alertmanagerSink{}
+	_ contextBatchSink = &alertmanagerSink{}
+)
+
+type alertmanagerSink struct {
+	healthState
+
+	cfg    AlertmanagerConfig
+	url    string
+	name   string
+	retry  retrier
+	client *http.Client
+
+	// Batches are sent one at a time so alerts are deduplicated.
+	mu     sync.Mutex
+	active map[alertKey]activeAlert
+}
+
+// An alertKey identifies an alert for deduplication.
+type alertKey struct {
+	host  string
+	event Event
+}
+
+// An activeAlert is an alert which has been sent and is not yet resolved.
+type activeAlert struct {
+	starts, ends time.Time
+}
+
+func (s *alertmanagerSink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+
+func (s *alertmanagerSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *alertmanagerSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	var match []Data
+	for _, d := range ds {
+		if containsEvent(s.cfg.Events, d.Event()) {
+			match = append(match, d)
+		}
+	}
+
+	if len(match) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(s.push(ctx, match))
+}
+
+func (s *alertmanagerSink) String() string {
+	return fmt.Sprintf("alertmanager: %s", s.name)
+}
+
+// An amAlert is the JSON representation of an Alertmanager v2 alert.
+type amAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// push sends alerts for a batch of logs, merging duplicate alerts within the
+// batch, and retrying with backoff if needed until ctx is done.  The caller
+// must hold s.mu.
+func (s *alertmanagerSink) push(ctx context.Context, ds []Data) error {
+	now := time.Now()
+
+	// Resolved alerts are forgotten so the next Event starts a new alert.
+	for k, a := range s.active {
+		if now.After(a.ends) {
+			delete(s.active, k)
+		}
+	}
+
+	var (
+		alerts []amAlert
+		keys   []alertKey
+		seen   = make(map[alertKey]int)
+	)
+
+	for _, d := range ds {
+		_, msg := ParseLevel(d.Log.Message)
+		k := alertKey{
+			host:  d.Host(),
+			event: d.Event(),
+		}
+
+		// Only the most recent log for each alert in a batch is sent.
+		if i, ok := seen[k]; ok {
+			alerts[i].Annotations = s.annotations(d, msg)
+			continue
+		}
+
+		starts := d.Time
+		if starts.IsZero() {
+			starts = now
+		}
+
+		if a, ok := s.active[k]; ok {
+			// Alertmanager already has this alert.  Send it again to extend
+			// its end time, keeping its original start time.
+			starts = a.starts
+		}
+
+		seen[k] = len(alerts)
+		keys = append(keys, k)
+		alerts = append(alerts, amAlert{
+			Labels:      s.labels(k),
+			Annotations: s.annotations(d, msg),
+			StartsAt:    starts,
+			EndsAt:      now.Add(s.cfg.Resolve),
+		})
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	err = s.retry.Do(ctx, func() (bool, error) {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/json")
+		if s.cfg.Username != "" || s.cfg.Password != "" {
+			req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+		}
+
+		_, retry, err := doHTTP(s.client, req)
+		return retry, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send %d alerts to Alertmanager: %v", len(alerts), err)
+	}
+
+	for i, k := range keys {
+		s.active[k] = activeAlert{
+			starts: alerts[i].StartsAt,
+			ends:   alerts[i].EndsAt,
+		}
+	}
+
+	return nil
+}
+
+// labels produces the labels for the alert identified by k.
+func (s *alertmanagerSink) labels(k alertKey) map[string]string {
+	labels := make(map[string]string, len(s.cfg.Labels)+3)
+	for name, v := range s.cfg.Labels {
+		labels[name] = v
+	}
+
+	labels["alertname"] = s.cfg.AlertName
+	labels["host"] = k.host
+	labels["event"] = string(k.event)
+
+	return labels
+}
+
+// annotations produces the annotations for an alert raised by d, with log
+// message msg.
+func (s *alertmanagerSink) annotations(d Data, msg string) map[string]string {
+	var addr string
+	if d.Addr != nil {
+		addr = d.Addr.String()
+	}
+
+	return map[string]string{
+		"summary": fmt.Sprintf("kernel %s on %s", eventSummaries[d.Event()], d.Host()),
+		"message": msg,
+		"addr":    addr,
+		"elapsed": fmt.Sprintf("%f", d.Log.Elapsed.Seconds()),
+	}
+}
+
+// eventSummaries are human-readable descriptions of each Event.
+var eventSummaries = map[Event]string{
+	EventPanic:    "panic",
+	EventOops:     "oops",
+	EventBUG:      "BUG",
+	EventLockup:   "lockup",
+	EventHungTask: "hung task",
+	EventOOM:      "out of memory",
+	EventWarning:  "warning",
+	EventSilent:   "silence",
+}
@@ -0,0 +1,234 @@
+package netconsoled_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestAlertmanagerSink(t *testing.T) {
+	srv, alertsC := testAlertmanager(t)
+	defer srv.Close()
+
+	sink, err := netconsoled.AlertmanagerSink(netconsoled.AlertmanagerConfig{
+		URL:      srv.URL,
+		Username: "foo",
+		Password: "bar",
+		Labels:   map[string]string{"team": "kernel"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	if err := sink.StoreBatch([]netconsoled.Data{
+		testData(1, 1, "Kernel panic - not syncing: foo"),
+		testData(1, 2, "hello"),
+		testData(1, 3, "Kernel panic - not syncing: foo"),
+		testData(2, 4, "INFO: task kworker/0:1:42 blocked for more than 120 seconds."),
+		testData(2, 5, "Out of memory: Killed process 1 (init)"),
+	}); err != nil {
+		t.Fatalf("failed to store logs: %v", err)
+	}
+	close(alertsC)
+
+	var got []alertmanagerAlert
+	for as := range alertsC {
+		got = append(got, as...)
+	}
+
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].Labels["host"] < got[j].Labels["host"]
+	})
+
+	for _, a := range got {
+		if !a.EndsAt.After(time.Now().Add(4 * time.Minute)) {
+			t.Fatalf("alert ends too soon: %s", a.EndsAt)
+		}
+	}
+
+	want := []alertmanagerAlert{
+		{
+			Labels: map[string]string{
+				"alertname": netconsoled.DefaultAlertName,
+				"host":      "192.168.1.1",
+				"event":     "panic",
+				"team":      "kernel",
+			},
+			Summary:  "kernel panic on 192.168.1.1",
+			StartsAt: time.Unix(1, 0),
+		},
+		{
+			Labels: map[string]string{
+				"alertname": netconsoled.DefaultAlertName,
+				"host":      "192.168.1.2",
+				"event":     "hung_task",
+				"team":      "kernel",
+			},
+			Summary:  "kernel hung task on 192.168.1.2",
+			StartsAt: time.Unix(4, 0),
+		},
+	}
+
+	// End times depend on the current time.
+	for i := range got {
+		got[i].EndsAt = time.Time{}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected alerts (-want +got):\n%s", diff)
+	}
+}
+
+func TestAlertmanagerSinkDeduplicate(t *testing.T) {
+	srv, alertsC := testAlertmanager(t)
+	defer srv.Close()
+
+	const resolve = 1 * time.Second
+
+	sink, err := netconsoled.AlertmanagerSink(netconsoled.AlertmanagerConfig{
+		URL:      srv.URL,
+		Username: "foo",
+		Password: "bar",
+		Resolve:  resolve,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	const msg = "Kernel panic - not syncing: foo"
+
+	// The first alert is sent, and each later occurrence extends it.
+	// Occurrences within a single batch are merged into one alert.
+	if err := sink.Store(testData(1, 1, msg)); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+	first := <-alertsC
+
+	time.Sleep(100 * time.Millisecond)
+	if err := sink.StoreBatch([]netconsoled.Data{
+		testData(1, 2, msg),
+		testData(1, 3, msg),
+	}); err != nil {
+		t.Fatalf("failed to store logs: %v", err)
+	}
+	close(alertsC)
+
+	var got [][]alertmanagerAlert
+	for as := range alertsC {
+		got = append(got, as)
+	}
+
+	if diff := cmp.Diff(1, len(got)); diff != "" {
+		t.Fatalf("unexpected number of refreshed alert batches (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(1, len(got[0])); diff != "" {
+		t.Fatalf("unexpected number of refreshed alerts (-want +got):\n%s", diff)
+	}
+
+	a, b := first[0], got[0][0]
+	if diff := cmp.Diff(time.Unix(1, 0), b.StartsAt); diff != "" {
+		t.Fatalf("unexpected refreshed alert start time (-want +got):\n%s", diff)
+	}
+	if !b.EndsAt.After(a.EndsAt) {
+		t.Fatalf("refreshed alert end time %s was not extended past %s", b.EndsAt, a.EndsAt)
+	}
+}
+
+func TestAlertmanagerSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.AlertmanagerConfig
+	}{
+		{
+			name: "URL",
+			cfg:  netconsoled.AlertmanagerConfig{URL: "localhost:9093"},
+		},
+		{
+			name: "event",
+			cfg: netconsoled.AlertmanagerConfig{
+				URL:    "http://localhost:9093",
+				Events: []netconsoled.Event{"foo"},
+			},
+		},
+		{
+			name: "label",
+			cfg: netconsoled.AlertmanagerConfig{
+				URL:    "http://localhost:9093",
+				Labels: map[string]string{"host": "foo"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.AlertmanagerSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// An alertmanagerAlert is the subset of an Alertmanager alert checked by
+// tests.
+type alertmanagerAlert struct {
+	Labels   map[string]string
+	Summary  string
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// testAlertmanager starts an Alertmanager stand-in which sends each batch of
+// received alerts on the returned channel.
+func testAlertmanager(t *testing.T) (*httptest.Server, chan []alertmanagerAlert) {
+	t.Helper()
+
+	var mu sync.Mutex
+	alertsC := make(chan []alertmanagerAlert, 16)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if diff := cmp.Diff("/api/v2/alerts", r.URL.Path); diff != "" {
+			t.Errorf("unexpected path (-want +got):\n%s", diff)
+		}
+
+		user, pass, _ := r.BasicAuth()
+		if diff := cmp.Diff("foo:bar", user+":"+pass); diff != "" {
+			t.Errorf("unexpected credentials (-want +got):\n%s", diff)
+		}
+
+		var as []struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+			StartsAt    time.Time         `json:"startsAt"`
+			EndsAt      time.Time         `json:"endsAt"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&as); err != nil {
+			t.Errorf("failed to decode alerts: %v", err)
+			return
+		}
+
+		out := make([]alertmanagerAlert, 0, len(as))
+		for _, a := range as {
+			out = append(out, alertmanagerAlert{
+				Labels:   a.Labels,
+				Summary:  a.Annotations["summary"],
+				StartsAt: a.StartsAt,
+				EndsAt:   a.EndsAt,
+			})
+		}
+
+		alertsC <- out
+	}))
+
+	return srv, alertsC
+}
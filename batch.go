@@ -0,0 +1,441 @@
+package netconsoled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A BatchSink is a Sink which can store many logs at once, such as a Sink
+// for a remote backend which accepts batches of logs.  Both Store and
+// StoreBatch return only once the logs are stored, or have failed to be
+// stored.
+//
+// When a Server's Sink, or a Sink within its MultiSink, implements BatchSink,
+// the Server buffers logs for it according to its Batch configuration, and
+// logs are passed to StoreBatch instead of Store.  Batches which fail to be
+// stored are passed to the Server's DeadLetter Sink.
+type BatchSink interface {
+	Sink
+
+	// StoreBatch stores a batch of logs to the Sink.
+	StoreBatch(ds []Data) error
+}
+
+// A contextBatchSink is a BatchSink which accepts a context.Context for each
+// batch, so that retrying a batch can be canceled.
+type contextBatchSink interface {
+	BatchSink
+	storeBatchContext(ctx context.Context, ds []Data) error
+}
+
+// storeBatch stores ds in sink, using StoreBatch if sink implements
+// BatchSink, and stopping at the first error otherwise.  ctx is passed to
+// Sinks which accept a context.Context.
+func storeBatch(ctx context.Context, sink Sink, ds []Data) error {
+	switch bs := sink.(type) {
+	case contextBatchSink:
+		return bs.storeBatchContext(ctx, ds)
+	case BatchSink:
+		return bs.StoreBatch(ds)
+	}
+
+	cs := ContextSinkAdapter(sink)
+	for _, d := range ds {
+		if err := cs.StoreContext(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A BatchConfig configures a batching Sink.
+type BatchConfig struct {
+	// Size is the maximum number of logs in a batch.  If zero, 100 is used.
+	Size int
+
+	// Wait is the maximum amount of time a log is buffered before it is
+	// stored.  If zero, 1 second is used.
+	Wait time.Duration
+}
+
+// override returns c with each field which is set in o replaced by o's.
+func (c BatchConfig) override(o BatchConfig) BatchConfig {
+	if o.Size > 0 {
+		c.Size = o.Size
+	}
+	if o.Wait > 0 {
+		c.Wait = o.Wait
+	}
+
+	return c
+}
+
+// A batchConfigurer is a BatchSink which configures its own batching.  Its
+// BatchConfig overrides the Server's Batch configuration for each field
+// which is set.
+type batchConfigurer interface {
+	batchConfig() BatchConfig
+}
+
+// memberBatchConfig returns the BatchConfig for a Sink which passes whole
+// batches to any of sinks: the smallest of each field set by a member, so
+// that every member's configuration is honored.
+func memberBatchConfig(sinks []Sink) BatchConfig {
+	var c BatchConfig
+	for _, sink := range sinks {
+		bc, ok := sink.(batchConfigurer)
+		if !ok {
+			continue
+		}
+
+		mc := bc.batchConfig()
+		if mc.Size > 0 && (c.Size == 0 || mc.Size < c.Size) {
+			c.Size = mc.Size
+		}
+		if mc.Wait > 0 && (c.Wait == 0 || mc.Wait < c.Wait) {
+			c.Wait = mc.Wait
+		}
+	}
+
+	return c
+}
+
+// BatchingSink creates a Sink which buffers logs and passes them to sink in
+// batches, either when a batch is full or when a log has waited for the
+// maximum amount of time.
+//
+// Store returns an error only if too many logs are waiting to be stored.
+// Errors from StoreBatch are instead reported by the Sink's health check.
+// Closing the Sink stores any remaining buffered logs, and then closes sink
+// if it implements io.Closer.
+func BatchingSink(cfg BatchConfig, sink BatchSink) Sink {
+	return newBatchingSink(cfg, sink, nil)
+}
+
+// newBatchingSink creates a batching Sink which also passes each batch that
+// sink fails to store to failed, if it is not nil.
+func newBatchingSink(cfg BatchConfig, sink BatchSink, failed func(ds []Data, err error)) Sink {
+	if cfg.Size <= 0 {
+		cfg.Size = 100
+	}
+	if cfg.Wait <= 0 {
+		cfg.Wait = 1 * time.Second
+	}
+
+	return &batchingSink{
+		sink: sink,
+		b:    newBatcher(cfg.Size, cfg.Wait, sink.StoreBatch, failed),
+	}
+}
+
+var _ Sink = &batchingSink{}
+
+type batchingSink struct {
+	sink BatchSink
+	b    *batcher
+}
+
+func (s *batchingSink) Close() error {
+	err := s.b.Close()
+
+	if c, ok := s.sink.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (s *batchingSink) CheckHealth() error {
+	if err := s.b.Err(); err != nil {
+		return err
+	}
+
+	return checkHealth(s.sink)
+}
+
+func (s *batchingSink) saturated() error   { return s.b.saturated() }
+func (s *batchingSink) Store(d Data) error { return s.b.Add(d) }
+func (s *batchingSink) String() string     { return s.sink.String() }
+
+// batchMaxPending is the number of full batches which may be buffered before
+// logs are dropped.
+const batchMaxPending = 10
+
+// A batcher buffers logs and passes them to a push function in batches,
+// either when a batch is full or when a log has waited for the maximum
+// amount of time.
+type batcher struct {
+	size   int
+	wait   time.Duration
+	push   func(ds []Data) error
+	failed func(ds []Data, err error)
+
+	flushC chan struct{}
+	doneC  chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	batch  []Data
+	err    error
+	closed bool
+}
+
+// newBatcher creates a batcher which starts pushing logs immediately.  If
+// failed is not nil, each batch which push fails to push is passed to it.
+// The batcher must be closed to push any remaining logs.
+func newBatcher(size int, wait time.Duration, push func(ds []Data) error, failed func(ds []Data, err error)) *batcher {
+	b := &batcher{
+		size:   size,
+		wait:   wait,
+		push:   push,
+		failed: failed,
+		flushC: make(chan struct{}, 1),
+		doneC:  make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	return b
+}
+
+// Add adds a log to the current batch.  If too many logs are waiting to be
+// pushed, the log is dropped and an error is returned.
+func (b *batcher) Add(d Data) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errors.New("sink is closed")
+	}
+
+	if b.fullLocked() {
+		n := len(b.batch)
+		b.mu.Unlock()
+		return fmt.Errorf("dropped log, %d logs are waiting to be sent", n)
+	}
+
+	b.batch = append(b.batch, d)
+	full := len(b.batch) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// saturated returns an error if the batcher is dropping logs because too
+// many are waiting to be pushed.
+func (b *batcher) saturated() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fullLocked() {
+		return fmt.Errorf("%d logs are waiting to be sent", len(b.batch))
+	}
+
+	return nil
+}
+
+// fullLocked reports whether too many logs are waiting to be pushed to add
+// another.  b.mu must be held.
+func (b *batcher) fullLocked() bool { return len(b.batch) >= b.size*batchMaxPending }
+
+// Err returns the error from the most recent push, if any.
+func (b *batcher) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.err
+}
+
+// Close pushes any remaining logs, stops the batcher, and returns the error
+// from the most recent push.
+func (b *batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.doneC)
+	b.wg.Wait()
+
+	return b.Err()
+}
+
+// run pushes batches of logs until the batcher is closed.
+func (b *batcher) run() {
+	defer b.wg.Done()
+
+	t := time.NewTicker(b.wait)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-b.flushC:
+		case <-b.doneC:
+			b.flush()
+			return
+		}
+
+		b.flush()
+	}
+}
+
+// flush pushes all buffered logs in batches.
+func (b *batcher) flush() {
+	for {
+		b.mu.Lock()
+		n := len(b.batch)
+		if n == 0 {
+			b.mu.Unlock()
+			return
+		}
+		if n > b.size {
+			n = b.size
+		}
+
+		ds := make([]Data, n)
+		copy(ds, b.batch)
+		b.batch = b.batch[n:]
+		b.mu.Unlock()
+
+		err := b.push(ds)
+		if err != nil && b.failed != nil {
+			b.failed(ds, err)
+		}
+
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+}
+
+// A healthState records the result of a Sink's most recent attempt to store
+// logs, and reports it as the Sink's health.
+type healthState struct {
+	mu  sync.Mutex
+	err error
+}
+
+// CheckHealth implements HealthChecker.
+func (h *healthState) CheckHealth() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.err
+}
+
+// set records err as the result of the most recent attempt, and returns it.
+func (h *healthState) set(err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.err = err
+	return err
+}
+
+// An asyncSink is a Sink which may fail to store a log after its Store
+// method has returned.  The Server passes such logs to its DeadLetter sink.
+type asyncSink interface {
+	setFailed(fn func(ds []Data, err error))
+}
+
+// A queueSink is a Sink which queues logs to be stored in the background,
+// and drops logs while its queue is full.
+type queueSink interface {
+	// saturated returns an error if the Sink's queue is full.
+	saturated() error
+}
+
+// A failureHook reports logs which an asyncSink failed to store.
+type failureHook struct {
+	mu sync.Mutex
+	fn func(ds []Data, err error)
+}
+
+// setFailed implements asyncSink.
+func (h *failureHook) setFailed(fn func(ds []Data, err error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fn = fn
+}
+
+// failed reports that ds could not be stored because of err.
+func (h *failureHook) failed(ds []Data, err error) {
+	h.mu.Lock()
+	fn := h.fn
+	h.mu.Unlock()
+
+	if fn != nil && len(ds) > 0 {
+		fn(ds, err)
+	}
+}
+
+// A retrier retries operations with exponential backoff.
+type retrier struct {
+	max      int
+	min, cap time.Duration
+}
+
+// newRetrier creates a retrier from a sink's configuration, applying
+// defaults for zero values.  If max is negative, operations are not retried.
+func newRetrier(max int, min, cap time.Duration) retrier {
+	switch {
+	case max == 0:
+		max = 5
+	case max < 0:
+		max = 0
+	}
+	if min <= 0 {
+		min = 500 * time.Millisecond
+	}
+	if cap <= 0 {
+		cap = 1 * time.Minute
+	}
+
+	return retrier{
+		max: max,
+		min: min,
+		cap: cap,
+	}
+}
+
+// Do invokes fn until it succeeds, reports that it should not be retried,
+// the maximum number of retries is reached, or ctx is done.
+func (r retrier) Do(ctx context.Context, fn func() (bool, error)) error {
+	backoff := r.min
+	for i := 0; ; i++ {
+		retry, err := fn()
+		if err == nil || !retry || i >= r.max {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+		if backoff > r.cap {
+			backoff = r.cap
+		}
+	}
+}
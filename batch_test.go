@@ -0,0 +1,146 @@
+package netconsoled_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestBatchingSink(t *testing.T) {
+	bs := &testBatchSink{}
+
+	sink := netconsoled.BatchingSink(netconsoled.BatchConfig{
+		Size: 2,
+		Wait: 1 * time.Hour,
+	}, bs)
+
+	for i := 0; i < 3; i++ {
+		if err := sink.Store(testData(1, i, fmt.Sprintf("log %d", i))); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	// A full batch is stored immediately.
+	for i := 0; len(bs.stored()) == 0; i++ {
+		if i == 500 {
+			t.Fatal("timed out waiting for batch")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Closing the sink stores the partial batch and closes the BatchSink.
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	want := [][]string{
+		{"log 0", "log 1"},
+		{"log 2"},
+	}
+
+	if diff := cmp.Diff(want, bs.stored()); diff != "" {
+		t.Fatalf("unexpected batches (-want +got):\n%s", diff)
+	}
+
+	if !bs.closed {
+		t.Fatal("batch sink was not closed")
+	}
+}
+
+func TestBatchingSinkWait(t *testing.T) {
+	bs := &testBatchSink{}
+
+	sink := netconsoled.BatchingSink(netconsoled.BatchConfig{
+		Wait: 10 * time.Millisecond,
+	}, bs)
+	defer sink.(io.Closer).Close()
+
+	if err := sink.Store(testData(1, 1, "hello")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	// A partial batch is stored once it has waited long enough.
+	for i := 0; len(bs.stored()) == 0; i++ {
+		if i == 500 {
+			t.Fatal("timed out waiting for batch")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if diff := cmp.Diff([][]string{{"hello"}}, bs.stored()); diff != "" {
+		t.Fatalf("unexpected batches (-want +got):\n%s", diff)
+	}
+}
+
+func TestBatchingSinkHealth(t *testing.T) {
+	bs := &testBatchSink{err: errors.New("backend unavailable")}
+
+	sink := netconsoled.BatchingSink(netconsoled.BatchConfig{}, bs)
+
+	if err := sink.Store(testData(1, 1, "hello")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	// Errors from StoreBatch are reported on close and by health checks.
+	if err := sink.(io.Closer).Close(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	if err := sink.(netconsoled.HealthChecker).CheckHealth(); err == nil {
+		t.Fatal("expected unhealthy sink, but no error occurred")
+	}
+}
+
+// A testBatchSink records the batches of logs it stores.
+type testBatchSink struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]string
+	closed  bool
+}
+
+func (s *testBatchSink) Store(d netconsoled.Data) error {
+	return s.StoreBatch([]netconsoled.Data{d})
+}
+
+func (s *testBatchSink) StoreBatch(ds []netconsoled.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Log.Message)
+	}
+
+	s.batches = append(s.batches, msgs)
+	return nil
+}
+
+func (s *testBatchSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return nil
+}
+
+func (s *testBatchSink) String() string { return "batch" }
+
+func (s *testBatchSink) stored() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.batches
+}
@@ -0,0 +1,35 @@
+package netconsoled
+
+import (
+	"time"
+)
+
+// A Boot identifies the current boot of a host, as detected from the elapsed
+// time since boot reported by each of its logs.
+type Boot struct {
+	// N is the number of the boot, numbered from 1.  N is zero if no logs
+	// have been observed.
+	N int
+
+	// Elapsed is the elapsed time reported by the most recent log.
+	Elapsed time.Duration
+}
+
+// Next returns the Boot of a host after it sends a log which reports the
+// specified elapsed time, and reports whether the log began a new boot.
+//
+// The first log from a host begins its first boot, and a log which reports
+// less elapsed time than the previous log indicates that the host rebooted.
+func (b Boot) Next(elapsed time.Duration) (Boot, bool) {
+	next := Boot{
+		N:       b.N,
+		Elapsed: elapsed,
+	}
+
+	if b.N == 0 || elapsed < b.Elapsed {
+		next.N++
+		return next, true
+	}
+
+	return next, false
+}
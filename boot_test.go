@@ -0,0 +1,64 @@
+package netconsoled_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestBootNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed []time.Duration
+		want    netconsoled.Boot
+		boots   int
+	}{
+		{
+			name: "no logs",
+		},
+		{
+			name:    "first log",
+			elapsed: []time.Duration{5 * time.Second},
+			want:    netconsoled.Boot{N: 1, Elapsed: 5 * time.Second},
+			boots:   1,
+		},
+		{
+			name:    "same boot",
+			elapsed: []time.Duration{1 * time.Second, 1 * time.Second, 2 * time.Second},
+			want:    netconsoled.Boot{N: 1, Elapsed: 2 * time.Second},
+			boots:   1,
+		},
+		{
+			name:    "reboots",
+			elapsed: []time.Duration{1 * time.Second, 2 * time.Second, 0, 3 * time.Second, 1 * time.Second},
+			want:    netconsoled.Boot{N: 3, Elapsed: 1 * time.Second},
+			boots:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				b     netconsoled.Boot
+				boots int
+			)
+
+			for _, e := range tt.elapsed {
+				var ok bool
+				b, ok = b.Next(e)
+				if ok {
+					boots++
+				}
+			}
+
+			if diff := cmp.Diff(tt.want, b); diff != "" {
+				t.Fatalf("unexpected boot (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.boots, boots); diff != "" {
+				t.Fatalf("unexpected number of boots (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
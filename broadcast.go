@@ -0,0 +1,243 @@
+package netconsoled
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A Broadcaster is a Sink which fans out logs to subscribers over HTTP, using
+// either Server-Sent Events or WebSockets.
+//
+// Subscribers may filter logs using the "host" and "match" query parameters,
+// which select logs from a single host and logs with messages matching a
+// regular expression, respectively.
+//
+// Each subscriber buffers a fixed number of logs.  Subscribers which cannot
+// keep up are disconnected, so a Broadcaster never blocks while storing logs.
+type Broadcaster struct {
+	// ErrorLog specifies a logger to use for capturing errors.  If nil,
+	// errors are discarded.
+	ErrorLog *log.Logger
+
+	buffer int
+
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// NewBroadcaster creates a Broadcaster which buffers up to buffer logs for
+// each subscriber.
+func NewBroadcaster(buffer int) *Broadcaster {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	return &Broadcaster{
+		buffer: buffer,
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+var _ Sink = &Broadcaster{}
+
+// Close disconnects all subscribers and prevents new subscribers from
+// connecting.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+	b.closed = true
+
+	return nil
+}
+
+// Store sends a log to each interested subscriber.
+func (b *Broadcaster) Store(d Data) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if !sub.matches(d) {
+			continue
+		}
+
+		select {
+		case sub.logC <- d:
+		default:
+			// Subscriber is not keeping up; disconnect it.
+			b.remove(sub)
+		}
+	}
+
+	return nil
+}
+
+func (b *Broadcaster) String() string { return "broadcast" }
+
+// logf logs an error using ErrorLog, if it is set.
+func (b *Broadcaster) logf(format string, v ...interface{}) {
+	if b.ErrorLog == nil {
+		return
+	}
+
+	b.ErrorLog.Printf(format, v...)
+}
+
+// ServeHTTP subscribes a client to the Broadcaster.  Clients which request
+// a WebSocket upgrade receive logs as WebSocket text messages, and all
+// others receive logs as Server-Sent Events.
+func (b *Broadcaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var match *regexp.Regexp
+	if m := q.Get("match"); m != "" {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid match expression: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		match = re
+	}
+
+	sub := &subscriber{
+		host:  q.Get("host"),
+		match: match,
+		logC:  make(chan Data, b.buffer),
+		done:  make(chan struct{}),
+	}
+
+	// Subscribe before responding so that no logs are missed once the client
+	// sees a response.
+	if !b.add(sub) {
+		http.Error(w, "broadcaster is closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer b.unsubscribe(sub)
+
+	if isWebSocket(r) {
+		ws, err := acceptWebSocket(w, r)
+		if err != nil {
+			// The client has already been sent an error, or the connection
+			// was taken over and can no longer be used for a response.
+			b.logf("error accepting WebSocket connection from %s: %v", r.RemoteAddr, err)
+			return
+		}
+		defer ws.Close()
+
+		b.serveWebSocket(ws, sub)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.done:
+			return
+		case d := <-sub.logC:
+			// Each line of a message must be prefixed for the event to be
+			// parsed correctly.
+			msg := strings.Replace(formatLog(d), "\n", "\ndata: ", -1)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", msg); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// serveWebSocket sends logs to sub over ws until either side disconnects.
+func (b *Broadcaster) serveWebSocket(ws *webSocket, sub *subscriber) {
+	// The client is not expected to send any data, but its frames must be
+	// read so that a close is detected.
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		ws.discard()
+	}()
+
+	for {
+		select {
+		case <-readDone:
+			return
+		case <-sub.done:
+			return
+		case d := <-sub.logC:
+			if err := ws.WriteText(formatLog(d)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// add adds a subscriber, reporting whether it was added.
+func (b *Broadcaster) add(sub *subscriber) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.subs[sub] = struct{}{}
+	return true
+}
+
+// unsubscribe removes a subscriber if it has not already been removed.
+func (b *Broadcaster) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		b.remove(sub)
+	}
+}
+
+// remove removes a subscriber and notifies it that it has been disconnected.
+// The caller must hold b.mu.
+func (b *Broadcaster) remove(sub *subscriber) {
+	delete(b.subs, sub)
+	close(sub.done)
+}
+
+// A subscriber is an HTTP client subscribed to a Broadcaster.
+type subscriber struct {
+	host  string
+	match *regexp.Regexp
+	logC  chan Data
+	done  chan struct{}
+}
+
+// matches determines if d should be sent to the subscriber.
+func (s *subscriber) matches(d Data) bool {
+	if s.host != "" && d.Host() != s.host {
+		return false
+	}
+
+	if s.match != nil && !s.match.MatchString(d.Log.Message) {
+		return false
+	}
+
+	return true
+}
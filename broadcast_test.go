@@ -0,0 +1,301 @@
+package netconsoled_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestBroadcaster(t *testing.T) {
+	tests := []struct {
+		name   string
+		verify func(t *testing.T)
+	}{
+		{
+			name:   "bad match",
+			verify: testBroadcasterBadMatch,
+		},
+		{
+			name:   "SSE ok",
+			verify: testBroadcasterSSEOK,
+		},
+		{
+			name:   "SSE slow client",
+			verify: testBroadcasterSSESlow,
+		},
+		{
+			name:   "WebSocket ok",
+			verify: testBroadcasterWebSocketOK,
+		},
+		{
+			name:   "WebSocket bad frame length",
+			verify: testBroadcasterWebSocketBadFrameLength,
+		},
+		{
+			name:   "WebSocket bad handshake",
+			verify: testBroadcasterWebSocketBadHandshake,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.verify(t)
+		})
+	}
+}
+
+func testBroadcasterBadMatch(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(1)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?match=(")
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+}
+
+func testBroadcasterSSEOK(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(8)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?host=192.168.1.1&match=^hello")
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+
+	// Only the final log should match the subscriber's parameters.
+	for _, d := range []netconsoled.Data{
+		broadcastData(net.IPv4(192, 168, 1, 2), "hello world"),
+		broadcastData(net.IPv4(192, 168, 1, 1), "goodbye world"),
+		broadcastData(net.IPv4(192, 168, 1, 1), "hello world"),
+	} {
+		if err := b.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read event: %v", err)
+	}
+
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, "192.168.1.1") ||
+		!strings.Contains(line, "hello world") {
+		t.Fatalf("unexpected event: %q", line)
+	}
+}
+
+func testBroadcasterSSESlow(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(1)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	// The subscriber is not reading, so storing more logs than can be
+	// buffered must not block and must disconnect the subscriber.
+	for i := 0; i < 16; i++ {
+		d := broadcastData(net.IPv4(192, 168, 1, 1), fmt.Sprintf("log %d", i))
+		if err := b.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	// Reading the body completes only when the server ends the stream.
+	if _, err := io.Copy(ioutil.Discard, res.Body); err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+}
+
+func testBroadcasterWebSocketOK(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(8)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	c, br := dialWebSocket(t, srv)
+	defer c.Close()
+
+	d := broadcastData(net.IPv4(192, 168, 1, 1), "hello world")
+	if err := b.Store(d); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	var hdr [2]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		t.Fatalf("failed to read frame header: %v", err)
+	}
+
+	// Expect a final, unmasked text frame.
+	if hdr[0] != 0x81 || hdr[1]&0x80 != 0 {
+		t.Fatalf("unexpected frame header: %#x", hdr)
+	}
+
+	n := int(hdr[1])
+	if n == 126 {
+		var b [2]byte
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			t.Fatalf("failed to read frame length: %v", err)
+		}
+		n = int(binary.BigEndian.Uint16(b[:]))
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(br, msg); err != nil {
+		t.Fatalf("failed to read frame payload: %v", err)
+	}
+
+	if !strings.Contains(string(msg), "hello world") {
+		t.Fatalf("unexpected message: %q", string(msg))
+	}
+}
+
+func testBroadcasterWebSocketBadFrameLength(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(1)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	c, br := dialWebSocket(t, srv)
+	defer c.Close()
+
+	// A masked binary frame whose 64-bit length has the most significant
+	// bit set.
+	frame := []byte{0x82, 0x80 | 127, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := c.Write(frame); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set read deadline: %v", err)
+	}
+
+	// Expect a close frame before the connection is closed.
+	got, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatalf("failed to read until close: %v", err)
+	}
+
+	if diff := cmp.Diff([]byte{0x88, 0x00}, got); diff != "" {
+		t.Fatalf("unexpected frames (-want +got):\n%s", diff)
+	}
+}
+
+func testBroadcasterWebSocketBadHandshake(t *testing.T) {
+	t.Helper()
+
+	b := netconsoled.NewBroadcaster(1)
+	b.ErrorLog = log.New(ioutil.Discard, "", 0)
+
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	// No Sec-WebSocket-Key header.
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	c, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	// Example handshake from RFC 6455, section 1.3.
+	_, err = io.WriteString(c, "GET /?match=hello HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+	if err != nil {
+		t.Fatalf("failed to write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake response: %v", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept header: %q", accept)
+	}
+
+	return c, br
+}
+
+func broadcastData(ip net.IP, msg string) netconsoled.Data {
+	return netconsoled.Data{
+		Addr: &net.UDPAddr{
+			IP:   ip,
+			Port: 6666,
+		},
+		Log: netconsole.Log{
+			Message: msg,
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/mdlayher/netconsoled"
+	"github.com/mdlayher/netconsoled/internal/config"
+)
+
+// An api serves JSON endpoints which report the state of a running server.
+type api struct {
+	cfg   *config.Config
+	s     *netconsoled.Server
+	start time.Time
+}
+
+// newAPI creates an api for the server s, which was configured using cfg.
+func newAPI(cfg *config.Config, s *netconsoled.Server) *api {
+	return &api{
+		cfg:   cfg,
+		s:     s,
+		start: time.Now(),
+	}
+}
+
+// register registers the api's endpoints with mux.
+func (a *api) register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/build", a.build)
+	mux.HandleFunc("/api/config", a.config)
+	mux.HandleFunc("/api/hosts", a.hosts)
+	mux.HandleFunc("/api/pipeline", a.pipeline)
+}
+
+// build reports information about the netconsoled binary.
+func (a *api) build(w http.ResponseWriter, _ *http.Request) {
+	type build struct {
+		Version   string    `json:"version"`
+		Revision  string    `json:"revision,omitempty"`
+		GoVersion string    `json:"go_version"`
+		OS        string    `json:"os"`
+		Arch      string    `json:"arch"`
+		StartTime time.Time `json:"start_time"`
+	}
+
+	b := build{
+		Version:   "unknown",
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		StartTime: a.start,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Version != "" {
+			b.Version = bi.Main.Version
+		}
+
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				b.Revision = s.Value
+			}
+		}
+	}
+
+	writeJSON(w, b)
+}
+
+// config reports the loaded server configuration.
+func (a *api) config(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, struct {
+		Server   config.ServerConfig `json:"server"`
+		Pipeline pipeline            `json:"pipeline"`
+	}{
+		Server:   a.cfg.Server,
+		Pipeline: newPipeline(a.cfg),
+	})
+}
+
+// hosts reports statistics for each host which has sent logs.
+func (a *api) hosts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, a.s.Hosts())
+}
+
+// pipeline reports the names of the active filters and sinks.
+func (a *api) pipeline(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, newPipeline(a.cfg))
+}
+
+// A pipeline contains the names of the filters and sinks in a Config.
+type pipeline struct {
+	Filters    []string `json:"filters"`
+	Sinks      []string `json:"sinks"`
+	DeadLetter string   `json:"dead_letter,omitempty"`
+}
+
+// newPipeline creates a pipeline from cfg.
+func newPipeline(cfg *config.Config) pipeline {
+	p := pipeline{
+		Filters: make([]string, 0, len(cfg.Filters)),
+		Sinks:   make([]string, 0, len(cfg.Sinks)),
+	}
+
+	for _, f := range cfg.Filters {
+		p.Filters = append(p.Filters, f.String())
+	}
+	for _, s := range cfg.Sinks {
+		p.Sinks = append(p.Sinks, s.String())
+	}
+	if cfg.DeadLetter != nil {
+		p.DeadLetter = cfg.DeadLetter.String()
+	}
+
+	return p
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -16,8 +16,36 @@ func initConfig(ll *log.Logger, file string) {
 server:
   # Required: listen for incoming netconsole logs.
   udp_addr: :6666
-  # Optional: enable HTTP server for Prometheus metrics.
+  # Optional: enable HTTP server for Prometheus metrics and health checks.
   http_addr: :8080
+  # Optional: listen for logs forwarded using syslog over UDP and TCP.
+  # syslog_udp_addr: :514
+  # syslog_tcp_addr: :601
+  # Optional: listen for logs relayed by other netconsoled servers.  Relays
+  # can send logs on behalf of any host, so unless relay_addr is a loopback
+  # address, relays must authenticate using client certificates signed by
+  # the CA in ca_file.
+  # relay_addr: :6667
+  # relay_tls:
+  #   cert_file: /etc/netconsoled/cert.pem
+  #   key_file: /etc/netconsoled/key.pem
+  #   ca_file: /etc/netconsoled/ca.pem
+  # Optional: fail logs which a sink takes longer than sink_timeout to store.
+  # Sinks which cannot be interrupted are abandoned, and fail further logs
+  # until they finish storing the log.
+  # sink_timeout: 10s
+  # Optional: buffer logs for sinks which store logs in batches, such as
+  # loki and elasticsearch, for up to batch_wait or until batch_size logs
+  # are buffered.  Elasticsearch, loki, otlp, relay, and webhook sinks may
+  # set their own batch_size and batch_wait to override these.
+  # batch_size: 100
+  # batch_wait: 1s
+  # Optional: report hosts which have sent no logs for longer than the
+  # silence threshold.  Expected hosts are the IP addresses which send
+  # their logs; hostnames are not supported.
+  # expected_hosts:
+  #   - 192.168.1.10
+  # silence_threshold: 5m
 # Zero or more filters to apply to incoming logs.
 filters:
   # By default, apply no filtering to logs.
@@ -28,6 +56,11 @@ sinks:
   - type: stdout
   - type: file
     file: netconsoled.log
+# Optional: append logs which any sink fails to store to a file as JSON,
+# along with the name of the failing sink and its error.
+# dead_letter:
+#   type: file
+#   file: netconsoled-dead-letter.json
 `
 
 	if err := ioutil.WriteFile(file, []byte(defaultYAML), 0644); err != nil {
@@ -56,5 +89,9 @@ func parseConfig(ll *log.Logger, file string) (*config.Config, error) {
 		ll.Printf("  - %s", s.String())
 	}
 
+	if cfg.DeadLetter != nil {
+		ll.Printf("loaded dead-letter sink: %s", cfg.DeadLetter.String())
+	}
+
 	return cfg, nil
 }
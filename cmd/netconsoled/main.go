@@ -19,9 +19,16 @@ func main() {
 		init   = flag.Bool("init", false, "create a new configuration file")
 	)
 
-	flag.Parse()
 	ll := log.New(os.Stderr, "", log.Ldate|log.Ltime)
 
+	// Subcommands are handled before the server's flags.
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		query(ll, os.Args[2:])
+		return
+	}
+
+	flag.Parse()
+
 	if *init {
 		// Generate an initial configuration file.
 		initConfig(ll, defaultConfig)
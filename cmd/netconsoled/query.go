@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/mdlayher/netconsoled/internal/store"
+)
+
+// query implements the "query" subcommand, which prints logs from a store
+// sink's directory.
+func query(ll *log.Logger, args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+
+	var (
+		dir = fs.String("dir", "", "directory of a store sink")
+
+		// Each of these flags is passed to the store as a query parameter.
+		params = map[string]*string{
+			"host":     fs.String("host", "", "only print logs from this host"),
+			"since":    fs.String("since", "", "only print logs received after this RFC 3339 time, or this long ago"),
+			"until":    fs.String("until", "", "only print logs received before this RFC 3339 time, or this long ago"),
+			"boot":     fs.String("boot", "", "only print logs from this boot of a host, numbered from 1"),
+			"contains": fs.String("contains", "", "only print logs containing this substring"),
+			"match":    fs.String("match", "", "only print logs matching this regular expression"),
+			"limit":    fs.String("limit", "", "only print this many of the most recent logs"),
+		}
+	)
+
+	_ = fs.Parse(args)
+
+	if *dir == "" {
+		ll.Fatal("must specify store directory with -dir")
+	}
+
+	v := make(url.Values)
+	for k, p := range params {
+		if *p != "" {
+			v.Set(k, *p)
+		}
+	}
+
+	q, err := store.ParseQuery(v, time.Now())
+	if err != nil {
+		ll.Fatalf("invalid query: %v", err)
+	}
+
+	s, err := store.Open(*dir, store.Options{ReadOnly: true})
+	if err != nil {
+		ll.Fatalf("failed to open store: %v", err)
+	}
+
+	rs, err := s.Query(q)
+	if err != nil {
+		ll.Fatalf("failed to query store: %v", err)
+	}
+
+	for _, r := range rs {
+		fmt.Fprintf(os.Stdout, "%s [% 15s] [boot %d] [% 15f] %s\n",
+			r.Time.Format(time.RFC3339), r.Host(), r.Boot, r.Log.Elapsed.Seconds(), r.Log.Message)
+	}
+}
@@ -2,31 +2,63 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
-	"github.com/mdlayher/netconsole"
 	"github.com/mdlayher/netconsoled"
 	"github.com/mdlayher/netconsoled/internal/config"
+	"github.com/mdlayher/netconsoled/internal/store"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// tailBuffer is the number of logs buffered for each HTTP client tailing logs.
+const tailBuffer = 128
+
 func serve(ctx context.Context, ll *log.Logger, cfg *config.Config) {
 	// Set up Prometheus metrics.
 	metrics, reg := netconsoled.NewMetrics()
 
-	// Sink is split out so it can shut down gracefully later.
-	sink := netconsoled.MultiSink(cfg.Sinks...)
+	// Sinks may provide their own metrics, including those wrapped by
+	// failover and spool sinks.
+	netconsoled.WalkSinks(cfg.Sinks, func(sink netconsoled.Sink) {
+		if c, ok := sink.(prometheus.Collector); ok {
+			if err := reg.Register(c); err != nil {
+				ll.Fatalf("failed to register metrics for sink %q: %v", sink.String(), err)
+			}
+		}
+	})
+
+	sinks := cfg.Sinks
+
+	// If the HTTP server is enabled, logs are also broadcast to any HTTP
+	// clients tailing logs.
+	var tail *netconsoled.Broadcaster
+	if cfg.Server.HTTPAddr != "" {
+		tail = netconsoled.NewBroadcaster(tailBuffer)
+		tail.ErrorLog = ll
+		sinks = append([]netconsoled.Sink{tail}, sinks...)
+	}
 
 	s := &netconsoled.Server{
-		Filter:   netconsoled.MultiFilter(cfg.Filters...),
-		Sink:     sink,
-		ErrorLog: ll,
-		Metrics:  metrics,
+		Filter:      netconsoled.MultiFilter(cfg.Filters...),
+		Sink:        netconsoled.MultiSink(sinks...),
+		DeadLetter:  cfg.DeadLetter,
+		SinkTimeout: cfg.Server.SinkTimeout,
+		Batch: netconsoled.BatchConfig{
+			Size: cfg.Server.BatchSize,
+			Wait: cfg.Server.BatchWait,
+		},
+		ExpectedHosts:    cfg.Server.ExpectedHosts,
+		SilenceThreshold: cfg.Server.SilenceThreshold,
+		ErrorLog:         ll,
+		Metrics:          metrics,
 	}
 
 	// Start each network service in its own goroutine so they can
@@ -38,52 +70,167 @@ func serve(ctx context.Context, ll *log.Logger, cfg *config.Config) {
 	go func() {
 		defer wg.Done()
 
-		ns := netconsole.NewServer("udp", cfg.Server.UDPAddr, s.Handle)
+		pc, err := net.ListenPacket("udp", cfg.Server.UDPAddr)
+		if err != nil {
+			ll.Fatalf("failed to listen UDP: %v", err)
+		}
 
 		ll.Printf("starting UDP server at %q", cfg.Server.UDPAddr)
 
 		// Canceled context will stop listener.
-		if err := ns.ListenAndServe(ctx); err != nil {
-			ll.Fatalf("failed to listen UDP: %v", err)
+		if err := s.Serve(ctx, pc); err != nil {
+			ll.Fatalf("failed to serve UDP: %v", err)
 		}
 	}()
 
+	// Syslog server goroutines, if enabled.
+	if cfg.Server.SyslogUDPAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pc, err := net.ListenPacket("udp", cfg.Server.SyslogUDPAddr)
+			if err != nil {
+				ll.Fatalf("failed to listen syslog UDP: %v", err)
+			}
+
+			ll.Printf("starting syslog UDP server at %q", cfg.Server.SyslogUDPAddr)
+
+			if err := s.ServeSyslog(ctx, pc); err != nil {
+				ll.Fatalf("failed to serve syslog UDP: %v", err)
+			}
+		}()
+	}
+
+	if cfg.Server.SyslogTCPAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := net.Listen("tcp", cfg.Server.SyslogTCPAddr)
+			if err != nil {
+				ll.Fatalf("failed to listen syslog TCP: %v", err)
+			}
+
+			ll.Printf("starting syslog TCP server at %q", cfg.Server.SyslogTCPAddr)
+
+			if err := s.ServeSyslogStream(ctx, l); err != nil {
+				ll.Fatalf("failed to serve syslog TCP: %v", err)
+			}
+		}()
+	}
+
+	// Relay server goroutine, if enabled.
+	if cfg.Server.RelayAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := net.Listen("tcp", cfg.Server.RelayAddr)
+			if err != nil {
+				ll.Fatalf("failed to listen relay: %v", err)
+			}
+
+			if cfg.Server.RelayTLS != nil {
+				tc, err := config.ServerTLSConfig(cfg.Server.RelayTLS)
+				if err != nil {
+					ll.Fatalf("failed to configure relay TLS: %v", err)
+				}
+
+				l = tls.NewListener(l, tc)
+			}
+
+			ll.Printf("starting relay server at %q", cfg.Server.RelayAddr)
+
+			if err := s.ServeRelay(ctx, l); err != nil {
+				ll.Fatalf("failed to serve relay: %v", err)
+			}
+		}()
+	}
+
+	// Expected host watcher goroutine, if enabled.
+	if len(cfg.Server.ExpectedHosts) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ll.Printf("watching %d expected hosts for silence", len(cfg.Server.ExpectedHosts))
+
+			// Canceled context will stop watcher.
+			if err := s.WatchHosts(ctx); err != nil {
+				ll.Fatalf("failed to watch expected hosts: %v", err)
+			}
+		}()
+	}
+
 	// HTTP server goroutine, if enabled.
 	if cfg.Server.HTTPAddr != "" {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 
+			// Set up Prometheus, health checks, and API.
+			prom := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+				ErrorLog: ll,
+			})
+
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", prom)
+			mux.HandleFunc("/healthz", healthz)
+			mux.Handle("/readyz", readyz(s))
+			mux.Handle("/api/tail", tail)
+			// Sinks may be wrapped by a failover or spool sink.
+			var logs, stored bool
+			netconsoled.WalkSinks(cfg.Sinks, func(sink netconsoled.Sink) {
+				switch sink := sink.(type) {
+				case *netconsoled.MemorySink:
+					if !logs {
+						mux.Handle("/api/logs", sink)
+						logs = true
+					}
+				case *store.Store:
+					if !stored {
+						mux.Handle("/api/store", sink)
+						stored = true
+					}
+				}
+			})
+			newAPI(cfg, s).register(mux)
+			newUI(s, newLogSource(cfg.Sinks), ll).register(mux)
+
+			// Streaming HTTP clients must be disconnected before the HTTP
+			// server can shut down.
+			go func() {
+				<-ctx.Done()
+				_ = tail.Close()
+			}()
+
 			// Blocks until stopped via context.
-			serveHTTP(ctx, cfg.Server.HTTPAddr, reg, ll)
+			serveHTTP(ctx, cfg.Server.HTTPAddr, mux, ll)
 		}()
 	}
 
 	// Block main goroutine until all servers halt.
 	wg.Wait()
 
-	// If possible, flush sink data before shutdown.
-	if c, ok := sink.(io.Closer); ok {
+	// Flush sink data, including any batched logs, before shutdown.
+	if err := s.Close(); err != nil {
+		ll.Fatalf("failed to flush sink data: %v", err)
+	}
+
+	ll.Println("flushed all sink data")
+
+	if c, ok := cfg.DeadLetter.(io.Closer); ok {
 		if err := c.Close(); err != nil {
-			ll.Fatalf("failed to flush sink data: %v", err)
+			ll.Fatalf("failed to flush dead-letter sink data: %v", err)
 		}
-
-		ll.Println("flushed all sink data")
 	}
 }
 
-func serveHTTP(ctx context.Context, addr string, reg *prometheus.Registry, ll *log.Logger) {
-	// Set up Prometheus and future API.
-	prom := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
-		ErrorLog: ll,
-	})
-
-	mux := http.NewServeMux()
-	mux.Handle("/metrics", prom)
-
+func serveHTTP(ctx context.Context, addr string, h http.Handler, ll *log.Logger) {
 	hs := &http.Server{
 		Addr:     addr,
-		Handler:  mux,
+		Handler:  h,
 		ErrorLog: ll,
 	}
 
@@ -122,3 +269,20 @@ func serveHTTP(ctx context.Context, addr string, reg *prometheus.Registry, ll *l
 
 	wg.Wait()
 }
+
+// healthz reports that the process is alive and able to serve HTTP requests.
+func healthz(w http.ResponseWriter, _ *http.Request) {
+	_, _ = io.WriteString(w, "ok\n")
+}
+
+// readyz returns a handler which reports whether s is ready to process logs.
+func readyz(s *netconsoled.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if err := s.Ready(); err != nil {
+			http.Error(w, fmt.Sprintf("not ready: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = io.WriteString(w, "ok\n")
+	})
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/mdlayher/netconsoled"
+	"github.com/mdlayher/netconsoled/internal/store"
+)
+
+const (
+	// uiLimit is the maximum number of logs displayed on a single page.
+	uiLimit = 2000
+
+	// uiContext is the amount of time before and after an event which is
+	// displayed when viewing its context.
+	uiContext = 1 * time.Minute
+
+	// uiCrashWindow is the default amount of history searched for crashes.
+	uiCrashWindow = 7 * 24 * time.Hour
+)
+
+// A logSource queries logs from netconsoled's in-process storage.
+type logSource func(q netconsoled.Query) ([]netconsoled.Data, error)
+
+// newLogSource creates a logSource from the first store or memory sink in
+// sinks, including those wrapped by other sinks, preferring a store.  If
+// neither is configured, it returns nil.
+func newLogSource(sinks []netconsoled.Sink) logSource {
+	var (
+		st *store.Store
+		ms *netconsoled.MemorySink
+	)
+
+	netconsoled.WalkSinks(sinks, func(sink netconsoled.Sink) {
+		switch sink := sink.(type) {
+		case *store.Store:
+			if st == nil {
+				st = sink
+			}
+		case *netconsoled.MemorySink:
+			if ms == nil {
+				ms = sink
+			}
+		}
+	})
+
+	switch {
+	case st != nil:
+		return func(q netconsoled.Query) ([]netconsoled.Data, error) {
+			rs, err := st.Query(store.Query{Query: q})
+			if err != nil {
+				return nil, err
+			}
+
+			ds := make([]netconsoled.Data, 0, len(rs))
+			for _, r := range rs {
+				ds = append(ds, r.Data)
+			}
+
+			return ds, nil
+		}
+	case ms != nil:
+		return func(q netconsoled.Query) ([]netconsoled.Data, error) {
+			return ms.Query(q), nil
+		}
+	default:
+		return nil
+	}
+}
+
+// A ui serves a web interface for browsing hosts, their logs, and crashes.
+type ui struct {
+	s    *netconsoled.Server
+	logs logSource
+	ll   *log.Logger
+}
+
+// newUI creates a ui for the server s.  If logs is nil, only host
+// statistics are available.
+func newUI(s *netconsoled.Server, logs logSource, ll *log.Logger) *ui {
+	return &ui{
+		s:    s,
+		logs: logs,
+		ll:   ll,
+	}
+}
+
+// register registers the ui's pages with mux.
+func (u *ui) register(mux *http.ServeMux) {
+	mux.HandleFunc("/ui/", u.hosts)
+	mux.HandleFunc("/ui/host", u.host)
+	mux.HandleFunc("/ui/crashes", u.crashes)
+}
+
+// hosts lists each known host.
+func (u *ui) hosts(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	u.render(w, "hosts", struct {
+		Hosts   []netconsoled.HostStats
+		Storage bool
+	}{
+		Hosts:   u.s.Hosts(),
+		Storage: u.logs != nil,
+	})
+}
+
+// A uiLine is a single log line displayed in the ui.
+type uiLine struct {
+	netconsoled.Data
+	Event  netconsoled.Event
+	Reboot bool
+}
+
+// host displays the logs for a single host in the style of dmesg.
+func (u *ui) host(w http.ResponseWriter, r *http.Request) {
+	if u.logs == nil {
+		http.Error(w, "no memory or store sink is configured", http.StatusNotFound)
+		return
+	}
+
+	v := r.URL.Query()
+
+	q, err := netconsoled.ParseQuery(v, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Host == "" {
+		http.Error(w, "missing host parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Display the context surrounding a point in time, if requested.
+	var around time.Time
+	if s := v.Get("around"); s != "" {
+		if around, err = time.Parse(time.RFC3339Nano, s); err != nil {
+			http.Error(w, fmt.Sprintf("invalid around parameter: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		q.Since = around.Add(-uiContext)
+		q.Until = around.Add(uiContext)
+	}
+
+	if q.Limit == 0 || q.Limit > uiLimit {
+		q.Limit = uiLimit
+	}
+
+	ds, err := u.logs(q)
+	if err != nil {
+		u.error(w, err)
+		return
+	}
+
+	var b netconsoled.Boot
+	lines := make([]uiLine, 0, len(ds))
+	for _, d := range ds {
+		// Synthetic logs do not report the elapsed time since boot.
+		var reboot bool
+		if d.Synthetic == netconsoled.EventNone {
+			first := b.N == 0
+			b, reboot = b.Next(d.Log.Elapsed)
+			reboot = reboot && !first
+		}
+
+		lines = append(lines, uiLine{
+			Data:   d,
+			Event:  d.Event(),
+			Reboot: reboot,
+		})
+	}
+
+	u.render(w, "host", struct {
+		Host   string
+		Around time.Time
+		Lines  []uiLine
+	}{
+		Host:   q.Host,
+		Around: around,
+		Lines:  lines,
+	})
+}
+
+// crashes lists crash events, grouped by host and boot.
+func (u *ui) crashes(w http.ResponseWriter, r *http.Request) {
+	if u.logs == nil {
+		http.Error(w, "no memory or store sink is configured", http.StatusNotFound)
+		return
+	}
+
+	q, err := netconsoled.ParseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Since.IsZero() {
+		q.Since = time.Now().Add(-uiCrashWindow)
+	}
+
+	ds, err := u.logs(q)
+	if err != nil {
+		u.error(w, err)
+		return
+	}
+
+	crashes := netconsoled.GroupCrashes(ds)
+
+	// Display the most recent crashes first.
+	sort.SliceStable(crashes, func(i, j int) bool {
+		return crashes[i].Time.After(crashes[j].Time)
+	})
+
+	u.render(w, "crashes", struct {
+		Since   time.Time
+		Crashes []netconsoled.Crash
+	}{
+		Since:   q.Since,
+		Crashes: crashes,
+	})
+}
+
+// render renders the named template with data.
+func (u *ui) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := uiTemplates.ExecuteTemplate(w, name, data); err != nil {
+		u.ll.Printf("failed to render %q page: %v", name, err)
+	}
+}
+
+// error reports an internal error.
+func (u *ui) error(w http.ResponseWriter, err error) {
+	u.ll.Printf("failed to query logs: %v", err)
+	http.Error(w, "failed to query logs", http.StatusInternalServerError)
+}
+
+// uiTemplates are the templates for each ui page.
+var uiTemplates = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"hostLink": func(host string) string {
+		return "/ui/host?" + url.Values{"host": {host}}.Encode()
+	},
+	// crashLink links to the context surrounding a crash.
+	"crashLink": func(c netconsoled.Crash) string {
+		v := make(url.Values)
+		v.Set("host", c.Host)
+		v.Set("around", c.Time.Format(time.RFC3339Nano))
+
+		return "/ui/host?" + v.Encode()
+	},
+	"timestamp": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+
+		return t.Format("2006-01-02 15:04:05.000 MST")
+	},
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>netconsoled</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+pre { font-size: 0.9em; }
+.event { color: #b00; font-weight: bold; }
+.around { background: #ffd; }
+.reboot { color: #888; }
+</style>
+</head>
+<body>
+<nav><a href="/ui/">hosts</a><a href="/ui/crashes">crashes</a></nav>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "hosts"}}{{template "header"}}
+<h1>Hosts</h1>
+{{if not .Storage}}<p>No memory or store sink is configured, so logs cannot be displayed.</p>{{end}}
+<table>
+<tr><th>Host</th><th>Last seen</th><th>Boots</th><th>Received</th><th>Dropped</th><th>Errors</th></tr>
+{{range .Hosts}}<tr>
+<td>{{if $.Storage}}<a href="{{hostLink .Host}}">{{.Host}}</a>{{else}}{{.Host}}{{end}}</td>
+<td>{{timestamp .LastSeen}}</td><td>{{.Boots}}</td><td>{{.Received}}</td><td>{{.Dropped}}</td><td>{{.Errors}}</td>
+</tr>
+{{else}}<tr><td colspan="6">No logs have been received.</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "host"}}{{template "header"}}
+<h1>{{.Host}}</h1>
+{{if not .Around.IsZero}}<p>Showing logs around {{timestamp .Around}}. <a href="{{hostLink .Host}}">Show most recent logs</a>.</p>{{end}}
+<pre>
+{{- range .Lines}}
+{{if .Reboot}}<span class="reboot">---- reboot ----</span>
+{{end}}<span class="{{if .Event}}event {{end}}{{if $.Around.Equal .Time}}around{{end}}" title="{{timestamp .Time}}">[{{printf "%12.6f" .Log.Elapsed.Seconds}}] {{.Log.Message}}</span>
+{{- else}}
+No logs found.
+{{- end}}
+</pre>
+{{template "footer"}}{{end}}
+
+{{define "crashes"}}{{template "header"}}
+<h1>Crashes since {{timestamp .Since}}</h1>
+<table>
+<tr><th>Host</th><th>Time</th><th>Events</th><th>Logs</th><th>First message</th></tr>
+{{range .Crashes}}<tr>
+<td><a href="{{hostLink .Host}}">{{.Host}}</a></td>
+<td><a href="{{crashLink .}}">{{timestamp .Time}}</a></td>
+<td>{{range $i, $e := .Events}}{{if $i}}, {{end}}{{$e}}{{end}}</td>
+<td>{{.Count}}</td>
+<td>{{.Message}}</td>
+</tr>
+{{else}}<tr><td colspan="5">No crashes found.</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+`))
@@ -0,0 +1,25 @@
+package netconsoled_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+// testData creates a log from 192.168.1.host, logged elapsed seconds after
+// boot and received elapsed seconds after the Unix epoch.
+func testData(host byte, elapsed int, msg string) netconsoled.Data {
+	return netconsoled.Data{
+		Addr: &net.UDPAddr{
+			IP:   net.IPv4(192, 168, 1, host),
+			Port: 6666,
+		},
+		Log: netconsole.Log{
+			Elapsed: time.Duration(elapsed) * time.Second,
+			Message: msg,
+		},
+		Time: time.Unix(int64(elapsed), 0),
+	}
+}
@@ -0,0 +1,135 @@
+package netconsoled
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A DeadLetter is a log which a Server's Sink failed to store.
+type DeadLetter struct {
+	Data Data
+
+	// Sink is the name of the Sink which failed to store the log.
+	Sink string
+
+	// Err is the error returned by the Sink.
+	Err error
+}
+
+// jsonDeadLetter is the JSON representation of a DeadLetter.
+type jsonDeadLetter struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Addr    string    `json:"addr"`
+	Elapsed float64   `json:"elapsed"`
+	Message string    `json:"message"`
+	Sink    string    `json:"sink"`
+	Error   string    `json:"error"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (dl DeadLetter) MarshalJSON() ([]byte, error) {
+	var addr string
+	if dl.Data.Addr != nil {
+		addr = dl.Data.Addr.String()
+	}
+
+	var err string
+	if dl.Err != nil {
+		err = dl.Err.Error()
+	}
+
+	return json.Marshal(jsonDeadLetter{
+		Time:    dl.Data.Time,
+		Host:    dl.Data.Host(),
+		Addr:    addr,
+		Elapsed: dl.Data.Log.Elapsed.Seconds(),
+		Message: dl.Data.Log.Message,
+		Sink:    dl.Sink,
+		Error:   err,
+	})
+}
+
+// A DeadLetterSink stores logs which a Server's Sink failed to store, so
+// that they are not lost.
+//
+// DeadLetterSinks may optionally implement io.Closer to flush data before
+// the server halts.
+type DeadLetterSink interface {
+	// StoreDeadLetter stores a log which could not be stored.
+	StoreDeadLetter(dl DeadLetter) error
+
+	// String returns the name of a DeadLetterSink.
+	fmt.Stringer
+}
+
+// FileDeadLetterSink creates a DeadLetterSink that creates or opens the
+// specified file and appends each DeadLetter to the file as a line of JSON.
+func FileDeadLetterSink(file string) (DeadLetterSink, error) {
+	file = filepath.Clean(file)
+
+	// Create or open the file, and always append to it.
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writerDeadLetterSink{
+		w:    f,
+		name: fmt.Sprintf("file: %q", file),
+	}, nil
+}
+
+// WriterDeadLetterSink creates a DeadLetterSink that writes each DeadLetter
+// to w as a line of JSON.
+func WriterDeadLetterSink(w io.Writer) DeadLetterSink {
+	return &writerDeadLetterSink{
+		w:    w,
+		name: "writer",
+	}
+}
+
+var _ DeadLetterSink = &writerDeadLetterSink{}
+
+type writerDeadLetterSink struct {
+	name string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerDeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sync, ok := s.w.(syncer); ok {
+		_ = sync.Sync()
+	}
+
+	c, ok := s.w.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
+
+func (s *writerDeadLetterSink) StoreDeadLetter(dl DeadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+func (s *writerDeadLetterSink) String() string { return s.name }
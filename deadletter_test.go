@@ -0,0 +1,69 @@
+package netconsoled_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestFileDeadLetterSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netconsoled_deadletter")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "deadletter.json")
+
+	// Dead letters are appended to the file, even across restarts.
+	for i := 0; i < 2; i++ {
+		sink, err := netconsoled.FileDeadLetterSink(file)
+		if err != nil {
+			t.Fatalf("failed to create sink: %v", err)
+		}
+
+		dl := netconsoled.DeadLetter{
+			Data: testData(1, i+1, "hello world"),
+			Sink: "loki: http://localhost:3100",
+			Err:  errors.New("backend unavailable"),
+		}
+
+		if err := sink.StoreDeadLetter(dl); err != nil {
+			t.Fatalf("failed to store dead letter: %v", err)
+		}
+
+		if err := sink.(io.Closer).Close(); err != nil {
+			t.Fatalf("failed to close sink: %v", err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if diff := cmp.Diff(2, len(lines)); diff != "" {
+		t.Fatalf("unexpected number of dead letters (-want +got):\n%s", diff)
+	}
+
+	for i, l := range lines {
+		for _, s := range []string{
+			`"host":"192.168.1.1"`,
+			`"message":"hello world"`,
+			`"sink":"loki: http://localhost:3100"`,
+			`"error":"backend unavailable"`,
+		} {
+			if !strings.Contains(l, s) {
+				t.Fatalf("dead letter %d does not contain %s: %s", i, s, l)
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package netconsoled
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultElasticsearchIndex is the default index name template for an
+// Elasticsearch Sink, which creates a new index each day.
+const DefaultElasticsearchIndex = `netconsoled-{{.Time.UTC.Format "2006.01.02"}}`
+
+// An ElasticsearchConfig configures an Elasticsearch Sink.
+type ElasticsearchConfig struct {
+	// URL is the base URL of the Elasticsearch or OpenSearch cluster.
+	URL string
+
+	// Index is a text/template which is executed with each log's Data to
+	// produce the name of its index.  If empty, DefaultElasticsearchIndex
+	// is used.
+	Index string
+
+	// Username and Password, if set, are sent using HTTP basic authentication.
+	Username string
+	Password string
+
+	// BatchSize is the maximum number of documents indexed in a single bulk
+	// request.  If zero, the Server's Batch.Size is used.
+	BatchSize int
+
+	// BatchWait is the maximum amount of time a log is buffered before it is
+	// indexed.  If zero, the Server's Batch.Wait is used.
+	BatchWait time.Duration
+
+	// MaxRetries is the number of times failed documents are retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, documents are
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Client is the HTTP client used to index documents.  If nil, a client
+	// with a 10 second timeout is used.
+	Client *http.Client
+}
+
+// ElasticsearchSink creates a BatchSink which indexes logs as documents using
+// the Elasticsearch bulk API, which is also supported by OpenSearch.  Each
+// batch of logs is indexed in a single bulk request.
+//
+// If a bulk request fails, or individual documents fail due to rate limiting
+// or server errors, those documents are retried with exponential backoff.
+// Documents which cannot be indexed are counted by a metric, which is
+// collected by registering the Sink as a prometheus.Collector.
+func ElasticsearchSink(cfg ElasticsearchConfig) (BatchSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Elasticsearch URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Elasticsearch URL must use HTTP or HTTPS: %q", cfg.URL)
+	}
+	name := redactURL(u)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/_bulk"
+
+	if cfg.Index == "" {
+		cfg.Index = DefaultElasticsearchIndex
+	}
+
+	index, err := template.New("index").Parse(cfg.Index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Elasticsearch index template: %v", err)
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("Elasticsearch batch size must not be negative: %d", cfg.BatchSize)
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &elasticsearchSink{
+		cfg:   cfg,
+		url:   u.String(),
+		name:  name,
+		index: index,
+		retry: newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+
+		rejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "netconsoled",
+			Subsystem:   "elasticsearch",
+			Name:        "documents_rejected_total",
+			Help:        "Total number of log documents which could not be indexed by Elasticsearch.",
+			ConstLabels: prometheus.Labels{"url": name},
+		}),
+	}, nil
+}
+
+var (
+	_ BatchSink            = &elasticsearchSink{}
+	_ contextBatchSink     = &elasticsearchSink{}
+	_ prometheus.Collector = &elasticsearchSink{}
+)
+
+type elasticsearchSink struct {
+	healthState
+
+	cfg   ElasticsearchConfig
+	url   string
+	name  string
+	index *template.Template
+	retry retrier
+
+	rejected prometheus.Counter
+}
+
+func (s *elasticsearchSink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+func (s *elasticsearchSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *elasticsearchSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	return s.set(s.push(ctx, ds))
+}
+
+func (s *elasticsearchSink) batchConfig() BatchConfig {
+	return BatchConfig{Size: s.cfg.BatchSize, Wait: s.cfg.BatchWait}
+}
+
+func (s *elasticsearchSink) String() string {
+	return fmt.Sprintf("elasticsearch: %s", s.name)
+}
+
+// Describe implements prometheus.Collector.
+func (s *elasticsearchSink) Describe(ch chan<- *prometheus.Desc) { s.rejected.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (s *elasticsearchSink) Collect(ch chan<- prometheus.Metric) { s.rejected.Collect(ch) }
+
+// An esDocument is a log document and the name of its index.
+type esDocument struct {
+	Index string
+	Body  []byte
+}
+
+// push indexes a single batch of logs, retrying documents which fail
+// temporarily until ctx is done.
+func (s *elasticsearchSink) push(ctx context.Context, ds []Data) error {
+	var (
+		docs     = make([]esDocument, 0, len(ds))
+		rejected int
+	)
+
+	for _, d := range ds {
+		doc, err := s.document(d)
+		if err != nil {
+			rejected++
+			continue
+		}
+
+		docs = append(docs, doc)
+	}
+
+	err := s.retry.Do(ctx, func() (bool, error) {
+		failed, n, retry, err := s.bulk(ctx, docs)
+		if err != nil {
+			return retry, err
+		}
+
+		// Documents which failed permanently are counted immediately, and
+		// any others are retried.
+		rejected += n
+		docs = failed
+		if len(docs) == 0 {
+			return false, nil
+		}
+
+		return true, fmt.Errorf("%d documents failed temporarily", len(docs))
+	})
+	if err != nil {
+		rejected += len(docs)
+	}
+
+	s.rejected.Add(float64(rejected))
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to index %d logs in Elasticsearch: %v", len(docs), err)
+	case rejected > 0:
+		return fmt.Errorf("Elasticsearch rejected %d logs", rejected)
+	}
+
+	return nil
+}
+
+// bulk sends a single bulk request.  It returns any documents which failed
+// and should be retried, and the number of documents which failed permanently.
+// If the entire request fails, it reports whether the request should be
+// retried.
+func (s *elasticsearchSink) bulk(ctx context.Context, docs []esDocument) ([]esDocument, int, bool, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]interface{}{
+			"index": map[string]string{"_index": doc.Index},
+		})
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.Body)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.cfg.Username != "" || s.cfg.Password != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	b, retry, err := doHTTP(s.cfg.Client, req)
+	if err != nil {
+		return nil, 0, retry, err
+	}
+
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+		} `json:"items"`
+	}
+
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, 0, false, fmt.Errorf("failed to parse bulk response: %v", err)
+	}
+	if !res.Errors {
+		return nil, 0, false, nil
+	}
+	if len(res.Items) != len(docs) {
+		return nil, 0, false, fmt.Errorf("bulk response contains %d items for %d documents",
+			len(res.Items), len(docs))
+	}
+
+	var (
+		failed   []esDocument
+		rejected int
+	)
+
+	for i, item := range res.Items {
+		for _, result := range item {
+			switch status := result.Status; {
+			case status/100 == 2:
+			case status == http.StatusTooManyRequests || status/100 == 5:
+				failed = append(failed, docs[i])
+			default:
+				rejected++
+			}
+		}
+	}
+
+	return failed, rejected, false, nil
+}
+
+// document creates an esDocument from d.
+func (s *elasticsearchSink) document(d Data) (esDocument, error) {
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+
+	var index bytes.Buffer
+	if err := s.index.Execute(&index, d); err != nil {
+		return esDocument{}, err
+	}
+
+	level, msg := ParseLevel(d.Log.Message)
+
+	doc := struct {
+		Timestamp time.Time `json:"@timestamp"`
+		Host      string    `json:"host"`
+		Addr      string    `json:"addr,omitempty"`
+		Elapsed   float64   `json:"elapsed"`
+		Level     string    `json:"level"`
+		Event     Event     `json:"event,omitempty"`
+		Message   string    `json:"message"`
+	}{
+		Timestamp: d.Time,
+		Host:      d.Host(),
+		Elapsed:   d.Log.Elapsed.Seconds(),
+		Level:     level.String(),
+		Event:     d.Event(),
+		Message:   msg,
+	}
+
+	if d.Addr != nil {
+		doc.Addr = d.Addr.String()
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return esDocument{}, err
+	}
+
+	return esDocument{
+		Index: index.String(),
+		Body:  b,
+	}, nil
+}
@@ -0,0 +1,412 @@
+package netconsoled
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultEmailSubject is the default subject template for an email Sink.
+const DefaultEmailSubject = `netconsoled: {{if .Event}}kernel {{.Event}}{{else}}{{.Count}} logs{{end}} on {{.Host}}`
+
+// emailMaxLogs is the maximum number of logs included in a single digest.
+const emailMaxLogs = 1000
+
+// An EmailConfig configures an email Sink.
+type EmailConfig struct {
+	// Addr is the host:port address of the SMTP server.
+	Addr string
+
+	// From is the sender address, and To are the recipient addresses, of
+	// each mail.
+	From string
+	To   []string
+
+	// Username and Password, if set, are used for PLAIN authentication.
+	// Authentication requires a TLS connection, unless the server is on
+	// the local machine.
+	Username string
+	Password string
+
+	// STARTTLS is used when the server supports it.  If RequireTLS is set,
+	// mail is not sent to servers which do not support STARTTLS.
+	RequireTLS bool
+
+	// TLSConfig configures STARTTLS.  If nil, the host from Addr is used
+	// to verify the server's certificate.
+	TLSConfig *tls.Config
+
+	// Events, if set, restricts the Sink to logs which contain one of the
+	// specified Events.  If empty, logs which contain any Event are sent.
+	Events []Event
+
+	// Subject is a text/template which is executed to produce the subject
+	// of each mail.  The template may use .Host, .Event (the first Event in
+	// the digest), .Events, and .Count.  If empty, DefaultEmailSubject
+	// is used.
+	Subject string
+
+	// Interval is the amount of time logs from a host are collected into
+	// a single digest before it is sent.  If zero, 1 minute is used.
+	Interval time.Duration
+
+	// MaxRetries is the number of times a failed mail is retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, mail is
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the timeout for each SMTP session.  If zero, 30 seconds
+	// is used.
+	Timeout time.Duration
+}
+
+// EmailSink creates a Sink which sends digests of logs by email.
+//
+// When a matching log arrives from a host, the Sink collects logs from that
+// host for the configured Interval, and then sends all of them in a single
+// mail, so that a burst of logs from a crashing machine produces one mail.
+// Mail which cannot be sent is retried with exponential backoff.  The Sink
+// must be closed to send any pending digests.
+func EmailSink(cfg EmailConfig) (Sink, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SMTP server address: %v", err)
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email sender %q: %v", cfg.From, err)
+	}
+
+	if len(cfg.To) == 0 {
+		return nil, errors.New("email sink must have at least one recipient")
+	}
+
+	to := make([]string, 0, len(cfg.To))
+	for _, t := range cfg.To {
+		a, err := mail.ParseAddress(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email recipient %q: %v", t, err)
+		}
+
+		to = append(to, a.Address)
+	}
+
+	for _, e := range cfg.Events {
+		if !knownEvent(e) {
+			return nil, fmt.Errorf("unknown email event: %q", e)
+		}
+	}
+
+	if cfg.Subject == "" {
+		cfg.Subject = DefaultEmailSubject
+	}
+
+	subject, err := template.New("subject").Parse(cfg.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email subject template: %v", err)
+	}
+
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{}
+	}
+	if cfg.TLSConfig.ServerName == "" {
+		cfg.TLSConfig = cfg.TLSConfig.Clone()
+		cfg.TLSConfig.ServerName = host
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 1 * time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	return &emailSink{
+		cfg:     cfg,
+		from:    from.Address,
+		to:      to,
+		subject: subject,
+		retry:   newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+		digests: make(map[string]*emailDigest),
+	}, nil
+}
+
+var (
+	_ Sink      = &emailSink{}
+	_ asyncSink = &emailSink{}
+)
+
+type emailSink struct {
+	failureHook
+
+	cfg     EmailConfig
+	from    string
+	to      []string
+	subject *template.Template
+	retry   retrier
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	digests map[string]*emailDigest
+	err     error
+	closed  bool
+}
+
+// An emailDigest is a collection of logs from a single host.
+type emailDigest struct {
+	host    string
+	logs    []Data
+	events  []Event
+	dropped int
+	timer   *time.Timer
+}
+
+func (s *emailSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	// Send any digests whose timers have not yet fired.  Digests whose timers
+	// have fired are sent by their timers.
+	var ds []*emailDigest
+	for host, d := range s.digests {
+		if d.timer.Stop() {
+			ds = append(ds, d)
+			delete(s.digests, host)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range ds {
+		s.send(d)
+	}
+
+	s.wg.Wait()
+
+	return s.CheckHealth()
+}
+
+func (s *emailSink) CheckHealth() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *emailSink) Store(d Data) error {
+	e := d.Event()
+	switch {
+	case len(s.cfg.Events) > 0 && !containsEvent(s.cfg.Events, e):
+		return nil
+	case len(s.cfg.Events) == 0 && e == EventNone:
+		return nil
+	}
+
+	host := d.Host()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("sink is closed")
+	}
+
+	dg, ok := s.digests[host]
+	if !ok {
+		dg = &emailDigest{host: host}
+		s.digests[host] = dg
+
+		s.wg.Add(1)
+		dg.timer = time.AfterFunc(s.cfg.Interval, func() {
+			s.mu.Lock()
+			if s.digests[host] == dg {
+				delete(s.digests, host)
+			}
+			s.mu.Unlock()
+
+			s.send(dg)
+		})
+	}
+
+	if !containsEvent(dg.events, e) {
+		dg.events = append(dg.events, e)
+	}
+
+	if len(dg.logs) >= emailMaxLogs {
+		dg.dropped++
+		return nil
+	}
+
+	dg.logs = append(dg.logs, d)
+	return nil
+}
+
+func (s *emailSink) String() string {
+	return fmt.Sprintf("email: %s -> %s", s.cfg.Addr, strings.Join(s.cfg.To, ", "))
+}
+
+// send sends a digest, retrying with backoff if needed, and records the
+// result for health checks.  The logs in a digest which cannot be sent are
+// reported as failed.
+func (s *emailSink) send(dg *emailDigest) {
+	defer s.wg.Done()
+
+	msg, err := s.message(dg)
+	if err == nil {
+		err = s.retry.Do(context.Background(), func() (bool, error) {
+			return s.sendMail(msg)
+		})
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to send email digest of %d logs from %s: %v",
+			len(dg.logs), dg.host, err)
+		s.failed(dg.logs, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// An emailSubject is passed to the subject template.
+type emailSubject struct {
+	Host   string
+	Event  Event
+	Events []Event
+	Count  int
+}
+
+// message produces the mail for a digest.
+func (s *emailSink) message(dg *emailDigest) ([]byte, error) {
+	sd := emailSubject{
+		Host:   dg.host,
+		Events: dg.events,
+		Count:  len(dg.logs) + dg.dropped,
+	}
+	if len(dg.events) > 0 {
+		sd.Event = dg.events[0]
+	}
+
+	var subject bytes.Buffer
+	if err := s.subject.Execute(&subject, sd); err != nil {
+		return nil, fmt.Errorf("failed to execute email subject template: %v", err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "%d logs from %s", sd.Count, dg.host)
+	if len(dg.logs) > 0 {
+		first, last := dg.logs[0].Time, dg.logs[len(dg.logs)-1].Time
+		fmt.Fprintf(&b, " between %s and %s",
+			first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	b.WriteString(":\r\n\r\n")
+
+	for _, d := range dg.logs {
+		b.WriteString(formatLog(d))
+		b.WriteString("\r\n")
+	}
+
+	if dg.dropped > 0 {
+		fmt.Fprintf(&b, "\r\n%d more logs were omitted.\r\n", dg.dropped)
+	}
+
+	return b.Bytes(), nil
+}
+
+// sendMail sends msg in a single SMTP session, and reports whether the
+// error, if any, should be retried.
+func (s *emailSink) sendMail(msg []byte) (bool, error) {
+	conn, err := net.DialTimeout("tcp", s.cfg.Addr, s.cfg.Timeout)
+	if err != nil {
+		return true, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	c, err := smtp.NewClient(conn, s.cfg.TLSConfig.ServerName)
+	if err != nil {
+		return smtpRetry(err), err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(s.cfg.TLSConfig); err != nil {
+			return smtpRetry(err), err
+		}
+	} else if s.cfg.RequireTLS {
+		return false, errors.New("SMTP server does not support STARTTLS")
+	}
+
+	if s.cfg.Username != "" || s.cfg.Password != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.TLSConfig.ServerName)
+		if err := c.Auth(auth); err != nil {
+			return smtpRetry(err), err
+		}
+	}
+
+	// The envelope uses bare addresses, while the headers use the addresses
+	// as configured.
+	if err := c.Mail(s.from); err != nil {
+		return smtpRetry(err), err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return smtpRetry(err), err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return smtpRetry(err), err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return true, err
+	}
+	if err := w.Close(); err != nil {
+		return smtpRetry(err), err
+	}
+
+	// The mail has been accepted, so errors from here on are ignored.
+	_ = c.Quit()
+	return false, nil
+}
+
+// smtpRetry reports whether an SMTP error should be retried: transient
+// negative replies and network errors are retried, but permanent failures
+// are not.
+func smtpRetry(err error) bool {
+	if terr, ok := err.(*textproto.Error); ok {
+		return terr.Code/100 == 4
+	}
+
+	return true
+}
@@ -0,0 +1,306 @@
+package netconsoled_test
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestEmailSink(t *testing.T) {
+	addr, mailC, done := testSMTPServer(t)
+	defer done()
+
+	sink, err := netconsoled.EmailSink(netconsoled.EmailConfig{
+		Addr:     addr,
+		From:     "netconsoled <netconsoled@example.com>",
+		To:       []string{"ops@example.com", "Kernel Team <kernel@example.com>"},
+		Username: "foo",
+		Password: "bar",
+		Interval: 1 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for _, d := range []netconsoled.Data{
+		testData(1, 1, "hello"),
+		testData(1, 2, "<1>BUG: unable to handle kernel NULL pointer dereference at 0000000000000000"),
+		testData(1, 3, "Kernel panic - not syncing: Fatal exception"),
+	} {
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	// Digests are only sent on close, because of the long interval.
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	m := <-mailC
+
+	want := smtpMail{
+		Auth: "\x00foo\x00bar",
+		From: "netconsoled@example.com",
+		To:   []string{"ops@example.com", "kernel@example.com"},
+		Header: map[string]string{
+			"From":    "netconsoled <netconsoled@example.com>",
+			"To":      "ops@example.com, Kernel Team <kernel@example.com>",
+			"Subject": "netconsoled: kernel oops on 192.168.1.1",
+		},
+		Body: strings.Join([]string{
+			"2 logs from 192.168.1.1 between 1970-01-01T00:00:02Z and 1970-01-01T00:00:03Z:",
+			"",
+			"[192.168.1.1:6666] [       2.000000] <1>BUG: unable to handle kernel NULL pointer dereference at 0000000000000000",
+			"[192.168.1.1:6666] [       3.000000] Kernel panic - not syncing: Fatal exception",
+			"",
+		}, "\n"),
+	}
+
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Fatalf("unexpected mail (-want +got):\n%s", diff)
+	}
+}
+
+func TestEmailSinkInterval(t *testing.T) {
+	addr, mailC, done := testSMTPServer(t)
+	defer done()
+
+	sink, err := netconsoled.EmailSink(netconsoled.EmailConfig{
+		Addr:     addr,
+		From:     "netconsoled@example.com",
+		To:       []string{"ops@example.com"},
+		Events:   []netconsoled.Event{netconsoled.EventHungTask},
+		Subject:  "{{.Count}} {{.Event}} logs from {{.Host}}",
+		Interval: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	const hung = "INFO: task kworker/0:1:42 blocked for more than 120 seconds."
+
+	// A burst of logs from each host is coalesced into a single mail.
+	for _, d := range []netconsoled.Data{
+		testData(1, 1, hung),
+		testData(2, 2, hung),
+		testData(1, 3, "Kernel panic - not syncing: Fatal exception"),
+		testData(1, 4, hung),
+	} {
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-mailC:
+			got = append(got, m.Header["Subject"])
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for mail")
+		}
+	}
+
+	if got[0] > got[1] {
+		got[0], got[1] = got[1], got[0]
+	}
+
+	want := []string{
+		"1 hung_task logs from 192.168.1.2",
+		"2 hung_task logs from 192.168.1.1",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected subjects (-want +got):\n%s", diff)
+	}
+}
+
+func TestEmailSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.EmailConfig
+	}{
+		{
+			name: "address",
+			cfg: netconsoled.EmailConfig{
+				Addr: "localhost",
+				From: "foo@example.com",
+				To:   []string{"bar@example.com"},
+			},
+		},
+		{
+			name: "sender",
+			cfg: netconsoled.EmailConfig{
+				Addr: "localhost:25",
+				From: "foo",
+				To:   []string{"bar@example.com"},
+			},
+		},
+		{
+			name: "no recipients",
+			cfg: netconsoled.EmailConfig{
+				Addr: "localhost:25",
+				From: "foo@example.com",
+			},
+		},
+		{
+			name: "event",
+			cfg: netconsoled.EmailConfig{
+				Addr:   "localhost:25",
+				From:   "foo@example.com",
+				To:     []string{"bar@example.com"},
+				Events: []netconsoled.Event{"foo"},
+			},
+		},
+		{
+			name: "subject",
+			cfg: netconsoled.EmailConfig{
+				Addr:    "localhost:25",
+				From:    "foo@example.com",
+				To:      []string{"bar@example.com"},
+				Subject: "{{",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.EmailSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// An smtpMail is a mail received by the fake SMTP server.
+type smtpMail struct {
+	Auth   string
+	From   string
+	To     []string
+	Header map[string]string
+	Body   string
+}
+
+// testSMTPServer starts a minimal SMTP server which sends each received mail
+// on the returned channel.
+func testSMTPServer(t *testing.T) (string, <-chan smtpMail, func()) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	mailC := make(chan smtpMail, 16)
+	doneC := make(chan struct{})
+
+	go func() {
+		defer close(doneC)
+
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			if err := serveSMTP(c, mailC); err != nil {
+				t.Errorf("failed to serve SMTP: %v", err)
+			}
+		}
+	}()
+
+	return l.Addr().String(), mailC, func() {
+		_ = l.Close()
+		<-doneC
+	}
+}
+
+// serveSMTP serves a single SMTP session.
+func serveSMTP(c net.Conn, mailC chan<- smtpMail) error {
+	defer c.Close()
+
+	tc := textproto.NewConn(c)
+	if err := tc.PrintfLine("220 localhost ESMTP"); err != nil {
+		return err
+	}
+
+	var m smtpMail
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return err
+		}
+
+		cmd := strings.ToUpper(strings.Fields(line)[0])
+		arg := strings.TrimSpace(line[len(cmd):])
+
+		switch cmd {
+		case "EHLO":
+			err = tc.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+		case "AUTH":
+			b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			m.Auth = string(b)
+			err = tc.PrintfLine("235 OK")
+		case "MAIL":
+			m.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			err = tc.PrintfLine("250 OK")
+		case "RCPT":
+			m.To = append(m.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			err = tc.PrintfLine("250 OK")
+		case "DATA":
+			if err := tc.PrintfLine("354 Go ahead"); err != nil {
+				return err
+			}
+
+			if err := readSMTPData(tc, &m); err != nil {
+				return err
+			}
+
+			mailC <- m
+			m = smtpMail{}
+
+			err = tc.PrintfLine("250 OK")
+		case "QUIT":
+			return tc.PrintfLine("221 Bye")
+		default:
+			err = tc.PrintfLine("502 Unknown command")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readSMTPData reads the headers and body of a mail into m.
+func readSMTPData(tc *textproto.Conn, m *smtpMail) error {
+	// The dot reader also converts line endings to "\n".
+	msg, err := mail.ReadMessage(tc.DotReader())
+	if err != nil {
+		return err
+	}
+
+	m.Header = map[string]string{
+		"From":    msg.Header.Get("From"),
+		"To":      msg.Header.Get("To"),
+		"Subject": msg.Header.Get("Subject"),
+	}
+
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		return err
+	}
+
+	m.Body = string(body)
+	return nil
+}
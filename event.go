@@ -0,0 +1,160 @@
+package netconsoled
+
+import (
+	"regexp"
+	"time"
+)
+
+// An Event is a notable kernel event, such as a panic, detected in a log.
+//
+// EventSilent is not produced by a kernel, and is never detected in a log
+// message: a Server produces a synthetic log which indicates EventSilent when
+// a host it expects to send logs has been silent for too long.
+type Event string
+
+// Possible Event values.
+const (
+	EventNone     Event = ""
+	EventPanic    Event = "panic"
+	EventOops     Event = "oops"
+	EventBUG      Event = "bug"
+	EventLockup   Event = "lockup"
+	EventHungTask Event = "hung_task"
+	EventOOM      Event = "oom"
+	EventWarning  Event = "warning"
+	EventSilent   Event = "silent"
+)
+
+// Crash determines if an Event indicates that a kernel has crashed or is
+// likely to crash.
+func (e Event) Crash() bool {
+	switch e {
+	case EventPanic, EventOops, EventBUG, EventLockup:
+		return true
+	}
+
+	return false
+}
+
+// events are patterns used to detect Events, in order of precedence.
+var events = []struct {
+	e  Event
+	re *regexp.Regexp
+}{
+	{e: EventPanic, re: regexp.MustCompile(`Kernel panic - not syncing`)},
+	{e: EventLockup, re: regexp.MustCompile(`BUG: soft lockup|NMI watchdog: .*hard LOCKUP|rcu_sched self-detected stall`)},
+	{e: EventOops, re: regexp.MustCompile(`Oops: |BUG: unable to handle (kernel|page fault)`)},
+	{e: EventBUG, re: regexp.MustCompile(`kernel BUG at |BUG: `)},
+	{e: EventHungTask, re: regexp.MustCompile(`INFO: task .+ blocked for more than \d+ seconds`)},
+	{e: EventOOM, re: regexp.MustCompile(`Out of memory: Kill(ed)? process|invoked oom-killer`)},
+	{e: EventWarning, re: regexp.MustCompile(`WARNING: (CPU: |at )`)},
+}
+
+// DetectEvent detects which Event, if any, is indicated by a log message.  Use
+// Data.Event to also report the Event of a synthetic log.
+func DetectEvent(message string) Event {
+	for _, e := range events {
+		if e.re.MatchString(message) {
+			return e.e
+		}
+	}
+
+	return EventNone
+}
+
+// A Crash is a group of logs which indicate that a host crashed during a
+// single boot.
+type Crash struct {
+	Host string
+
+	// Time and Message are the receive time and message of the first log
+	// which indicated the crash.
+	Time    time.Time
+	Message string
+
+	// Events are the distinct Events indicated by the crash's logs, in
+	// the order they first occurred.
+	Events []Event
+
+	// Count is the number of logs which indicated the crash.
+	Count int
+}
+
+// GroupCrashes groups the logs which indicate a crash by host and boot, since
+// a crash typically produces many consecutive logs.  ds must be ordered from
+// oldest to newest, and the Crashes are returned in the order of their first
+// logs.
+func GroupCrashes(ds []Data) []Crash {
+	type group struct {
+		boot  Boot
+		crash int
+	}
+
+	var crashes []Crash
+	hosts := make(map[string]*group)
+	for _, d := range ds {
+		host := d.Host()
+		g, ok := hosts[host]
+		if !ok {
+			g = &group{crash: -1}
+			hosts[host] = g
+		}
+
+		// Synthetic logs do not report the elapsed time since boot.
+		if d.Synthetic == EventNone {
+			var reboot bool
+			g.boot, reboot = g.boot.Next(d.Log.Elapsed)
+			if reboot {
+				g.crash = -1
+			}
+		}
+
+		e := d.Event()
+		if !e.Crash() {
+			continue
+		}
+
+		if g.crash == -1 {
+			g.crash = len(crashes)
+			crashes = append(crashes, Crash{
+				Host:    host,
+				Time:    d.Time,
+				Message: d.Log.Message,
+			})
+		}
+
+		c := &crashes[g.crash]
+		if !containsEvent(c.Events, e) {
+			c.Events = append(c.Events, e)
+		}
+		c.Count++
+	}
+
+	return crashes
+}
+
+// containsEvent determines if es contains e.
+func containsEvent(es []Event, e Event) bool {
+	for _, ee := range es {
+		if ee == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// knownEvent determines if e is a known Event other than EventNone.
+func knownEvent(e Event) bool {
+	if e == EventSilent {
+		return true
+	}
+
+	for _, ee := range events {
+		if ee.e == e {
+			return true
+		}
+	}
+
+	return false
+}
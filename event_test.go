@@ -0,0 +1,193 @@
+package netconsoled_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestDetectEvent(t *testing.T) {
+	tests := []struct {
+		msg   string
+		e     netconsoled.Event
+		crash bool
+	}{
+		{
+			msg: "e1000e: eth0 NIC Link is Up 1000 Mbps Full Duplex",
+			e:   netconsoled.EventNone,
+		},
+		{
+			msg:   "Kernel panic - not syncing: Fatal exception in interrupt",
+			e:     netconsoled.EventPanic,
+			crash: true,
+		},
+		{
+			msg:   "BUG: unable to handle kernel NULL pointer dereference at 0000000000000008",
+			e:     netconsoled.EventOops,
+			crash: true,
+		},
+		{
+			msg:   "Oops: 0002 [#1] SMP",
+			e:     netconsoled.EventOops,
+			crash: true,
+		},
+		{
+			msg:   "kernel BUG at mm/slub.c:3901!",
+			e:     netconsoled.EventBUG,
+			crash: true,
+		},
+		{
+			msg:   "watchdog: BUG: soft lockup - CPU#3 stuck for 22s! [kworker/3:1:123]",
+			e:     netconsoled.EventLockup,
+			crash: true,
+		},
+		{
+			msg: "INFO: task jbd2/sda1-8:245 blocked for more than 120 seconds.",
+			e:   netconsoled.EventHungTask,
+		},
+		{
+			msg: "Out of memory: Kill process 1234 (java) score 900 or sacrifice child",
+			e:   netconsoled.EventOOM,
+		},
+		{
+			msg: "WARNING: CPU: 0 PID: 1 at kernel/foo.c:10 foo+0x10/0x20",
+			e:   netconsoled.EventWarning,
+		},
+		{
+			// Only a Server may produce EventSilent.
+			msg: "netconsoled: host 192.168.1.1 has been silent for 5m0s",
+			e:   netconsoled.EventNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			e := netconsoled.DetectEvent(tt.msg)
+
+			if diff := cmp.Diff(tt.e, e); diff != "" {
+				t.Fatalf("unexpected event (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.crash, e.Crash()); diff != "" {
+				t.Fatalf("unexpected crash (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGroupCrashes(t *testing.T) {
+	const (
+		panicMsg = "Kernel panic - not syncing: Fatal exception"
+		oopsMsg  = "Oops: 0002 [#1] SMP"
+		helloMsg = "hello world"
+	)
+
+	silent := testData(1, 0, "netconsoled: host 192.168.1.1 has been silent for 5m0s")
+	silent.Synthetic = netconsoled.EventSilent
+
+	tests := []struct {
+		name string
+		ds   []netconsoled.Data
+		want []netconsoled.Crash
+	}{
+		{
+			name: "no crashes",
+			ds: []netconsoled.Data{
+				testData(1, 1, helloMsg),
+				testData(1, 2, "WARNING: CPU: 0 PID: 1 at kernel/foo.c:10 foo+0x10/0x20"),
+			},
+		},
+		{
+			name: "one boot",
+			ds: []netconsoled.Data{
+				testData(1, 1, helloMsg),
+				testData(1, 2, oopsMsg),
+				testData(1, 3, helloMsg),
+				testData(1, 4, panicMsg),
+				testData(1, 5, oopsMsg),
+			},
+			want: []netconsoled.Crash{{
+				Host:    "192.168.1.1",
+				Time:    time.Unix(2, 0),
+				Message: oopsMsg,
+				Events:  []netconsoled.Event{netconsoled.EventOops, netconsoled.EventPanic},
+				Count:   3,
+			}},
+		},
+		{
+			name: "reboot",
+			ds: []netconsoled.Data{
+				testData(1, 2, panicMsg),
+				// The host reboots, but does not crash again until later.
+				testData(1, 1, helloMsg),
+				testData(1, 3, oopsMsg),
+			},
+			want: []netconsoled.Crash{
+				{
+					Host:    "192.168.1.1",
+					Time:    time.Unix(2, 0),
+					Message: panicMsg,
+					Events:  []netconsoled.Event{netconsoled.EventPanic},
+					Count:   1,
+				},
+				{
+					Host:    "192.168.1.1",
+					Time:    time.Unix(3, 0),
+					Message: oopsMsg,
+					Events:  []netconsoled.Event{netconsoled.EventOops},
+					Count:   1,
+				},
+			},
+		},
+		{
+			name: "synthetic",
+			ds: []netconsoled.Data{
+				testData(1, 2, panicMsg),
+				// A synthetic log reports no elapsed time, but is not a reboot.
+				silent,
+				testData(1, 3, oopsMsg),
+			},
+			want: []netconsoled.Crash{{
+				Host:    "192.168.1.1",
+				Time:    time.Unix(2, 0),
+				Message: panicMsg,
+				Events:  []netconsoled.Event{netconsoled.EventPanic, netconsoled.EventOops},
+				Count:   2,
+			}},
+		},
+		{
+			name: "hosts",
+			ds: []netconsoled.Data{
+				testData(1, 1, panicMsg),
+				testData(2, 2, oopsMsg),
+				testData(1, 3, panicMsg),
+			},
+			want: []netconsoled.Crash{
+				{
+					Host:    "192.168.1.1",
+					Time:    time.Unix(1, 0),
+					Message: panicMsg,
+					Events:  []netconsoled.Event{netconsoled.EventPanic},
+					Count:   2,
+				},
+				{
+					Host:    "192.168.1.2",
+					Time:    time.Unix(2, 0),
+					Message: oopsMsg,
+					Events:  []netconsoled.Event{netconsoled.EventOops},
+					Count:   1,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, netconsoled.GroupCrashes(tt.ds)); diff != "" {
+				t.Fatalf("unexpected crashes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
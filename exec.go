@@ -0,0 +1,546 @@
+package netconsoled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exec sink formats.
+const (
+	ExecText = "text"
+	ExecJSON = "json"
+)
+
+// Exec sink supervision parameters.
+const (
+	// execStableRun is the amount of time a command must run before its
+	// restart backoff is reset.
+	execStableRun = 10 * time.Second
+
+	// execStopTimeout is the amount of time a command is given to read any
+	// queued logs and to exit after its input is closed.
+	execStopTimeout = 10 * time.Second
+
+	// execQueueSize is the number of logs which may wait to be written to
+	// a command before logs are dropped.
+	execQueueSize = 1024
+)
+
+// An ExecConfig configures an exec Sink.
+type ExecConfig struct {
+	// Command is the command and its arguments.
+	Command []string
+
+	// Format is the format of logs written to a command's input: ExecText
+	// for the default single line format, or ExecJSON for one JSON object
+	// per line.  If empty, ExecText is used.  Format is not used by
+	// ExecEventSink.
+	Format string
+
+	// Events, if set, restricts the Sink to logs which contain one of the
+	// specified Events.  If empty, ExecSink receives all logs, and
+	// ExecEventSink runs for logs which contain any Event.
+	Events []Event
+
+	// MinBackoff and MaxBackoff bound the delay before a command which has
+	// exited is restarted.  If zero, 500 milliseconds and 1 minute are used.
+	// They are not used by ExecEventSink.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the maximum amount of time a command run by ExecEventSink
+	// may run before it is killed.  If zero, 1 minute is used.
+	Timeout time.Duration
+
+	// MaxConcurrent is the maximum number of commands run by ExecEventSink
+	// at once.  If zero, 4 is used.
+	MaxConcurrent int
+}
+
+// validate checks the configuration common to both exec Sinks.
+func (cfg *ExecConfig) validate() error {
+	if len(cfg.Command) == 0 || cfg.Command[0] == "" {
+		return errors.New("exec command must not be empty")
+	}
+
+	for _, e := range cfg.Events {
+		if !knownEvent(e) {
+			return fmt.Errorf("unknown exec event: %q", e)
+		}
+	}
+
+	return nil
+}
+
+// ExecSink creates a Sink which starts a long-running command and writes
+// each log to its standard input, one per line.  The command's standard
+// output and error are written to netconsoled's standard error.
+//
+// Logs are queued and written to the command in the background, so a command
+// which stops reading its input cannot stall other Sinks.  If too many logs
+// are waiting to be written, logs are dropped with an error.
+//
+// If the command exits, it is restarted with exponential backoff when the
+// next log arrives, and logs which arrive while it cannot be restarted are
+// dropped with an error.  Closing the Sink writes any queued logs, closes the
+// command's input, and waits for it to exit.
+func ExecSink(cfg ExecConfig) (Sink, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Format {
+	case "":
+		cfg.Format = ExecText
+	case ExecText, ExecJSON:
+	default:
+		return nil, fmt.Errorf("unsupported exec format: %q", cfg.Format)
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 1 * time.Minute
+	}
+
+	s := &execSink{
+		cfg:     cfg,
+		queueC:  make(chan execWrite, execQueueSize),
+		doneC:   make(chan struct{}),
+		backoff: cfg.MinBackoff,
+	}
+
+	go s.write()
+
+	return s, nil
+}
+
+var (
+	_ Sink      = &execSink{}
+	_ asyncSink = &execSink{}
+	_ queueSink = &execSink{}
+)
+
+type execSink struct {
+	failureHook
+
+	cfg    ExecConfig
+	queueC chan execWrite
+	doneC  chan struct{}
+
+	mu        sync.Mutex
+	p         *execProcess
+	nextStart time.Time
+	backoff   time.Duration
+	err       error
+	closed    bool
+}
+
+// An execWrite is a log queued to be written to a command.
+type execWrite struct {
+	d Data
+	b []byte
+}
+
+// An execProcess is a running command started by an exec Sink.
+type execProcess struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+
+	// err is set before exitC is closed.
+	exitC chan struct{}
+	err   error
+}
+
+func (s *execSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queueC)
+	s.mu.Unlock()
+
+	// Give the command a chance to read any queued logs.
+	stop := time.NewTimer(execStopTimeout)
+	defer stop.Stop()
+
+	select {
+	case <-s.doneC:
+	case <-stop.C:
+	}
+
+	s.mu.Lock()
+	p := s.p
+	s.p = nil
+	s.mu.Unlock()
+
+	if p == nil {
+		<-s.doneC
+		return nil
+	}
+
+	// Closing the input asks the command to exit, and interrupts any write
+	// which is still blocked; kill the command if it does not exit.
+	_ = p.stdin.Close()
+	<-s.doneC
+
+	select {
+	case <-p.exitC:
+	case <-time.After(execStopTimeout):
+		_ = p.cmd.Process.Kill()
+		<-p.exitC
+	}
+
+	return p.err
+}
+
+func (s *execSink) CheckHealth() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reap()
+
+	// Before the first log is sent, the sink is assumed to be healthy.
+	if s.p == nil && !s.nextStart.IsZero() {
+		return fmt.Errorf("command %q is not running", s.cfg.Command[0])
+	}
+
+	return s.err
+}
+
+func (s *execSink) Store(d Data) error {
+	if len(s.cfg.Events) > 0 && !containsEvent(s.cfg.Events, d.Event()) {
+		return nil
+	}
+
+	var b []byte
+	switch s.cfg.Format {
+	case ExecText:
+		b = []byte(formatLog(d) + "\n")
+	case ExecJSON:
+		jb, err := d.MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		b = append(jb, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("sink is closed")
+	}
+
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	select {
+	case s.queueC <- execWrite{d: d, b: b}:
+		return nil
+	default:
+		return fmt.Errorf("dropped log, %d logs are waiting to be written to command %q",
+			len(s.queueC), s.cfg.Command[0])
+	}
+}
+
+func (s *execSink) saturated() error {
+	if n := len(s.queueC); n == cap(s.queueC) {
+		return fmt.Errorf("%d logs are waiting to be written to command %q", n, s.cfg.Command[0])
+	}
+
+	return nil
+}
+
+func (s *execSink) String() string {
+	return fmt.Sprintf("exec: %s %q", s.cfg.Format, strings.Join(s.cfg.Command, " "))
+}
+
+// write writes queued logs to the running command until the Sink is closed.
+func (s *execSink) write() {
+	defer close(s.doneC)
+
+	for w := range s.queueC {
+		s.mu.Lock()
+		s.reap()
+		p := s.p
+		s.mu.Unlock()
+
+		err := fmt.Errorf("command %q is not running", s.cfg.Command[0])
+		if p != nil {
+			// The write may block for as long as the command does not read
+			// its input, so s.mu must not be held.
+			_, err = p.stdin.Write(w.b)
+		}
+		if err != nil {
+			// The command has most likely exited; it is restarted by the
+			// next call to Store.
+			err = fmt.Errorf("failed to write log to command %q: %v", s.cfg.Command[0], err)
+			s.failed([]Data{w.d}, err)
+		}
+
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}
+}
+
+// reap cleans up after the command if it has exited.  The caller must
+// hold s.mu.
+func (s *execSink) reap() {
+	p := s.p
+	if p == nil {
+		return
+	}
+
+	select {
+	case <-p.exitC:
+	default:
+		return
+	}
+
+	_ = p.stdin.Close()
+	s.p = nil
+
+	// Commands which exit soon after starting are restarted with increasing
+	// delays, but a command which ran for a while is restarted promptly.
+	now := time.Now()
+	if now.Sub(p.started) >= execStableRun {
+		s.backoff = s.cfg.MinBackoff
+	}
+
+	s.nextStart = now.Add(s.backoff)
+	s.backoff *= 2
+	if s.backoff > s.cfg.MaxBackoff {
+		s.backoff = s.cfg.MaxBackoff
+	}
+}
+
+// start starts the command if it is not already running, obeying the
+// restart backoff.  The caller must hold s.mu.
+func (s *execSink) start() error {
+	s.reap()
+	if s.p != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(s.nextStart) {
+		return fmt.Errorf("command %q is not running, restarting in %s",
+			s.cfg.Command[0], s.nextStart.Sub(now))
+	}
+
+	cmd := exec.Command(s.cfg.Command[0], s.cfg.Command[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		s.nextStart = now.Add(s.backoff)
+		s.backoff *= 2
+		if s.backoff > s.cfg.MaxBackoff {
+			s.backoff = s.cfg.MaxBackoff
+		}
+
+		return fmt.Errorf("failed to start command %q: %v", s.cfg.Command[0], err)
+	}
+
+	p := &execProcess{
+		cmd:     cmd,
+		stdin:   stdin,
+		started: now,
+		exitC:   make(chan struct{}),
+	}
+
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exitC)
+	}()
+
+	s.p = p
+	return nil
+}
+
+// ExecEventSink creates a Sink which runs a command for each log which
+// contains one of the configured Events.  The log is passed to the command
+// in environment variables:
+//   - NETCONSOLE_HOST: the host which sent the log
+//   - NETCONSOLE_ADDR: the address which sent the log
+//   - NETCONSOLE_TIME: the time the log was received, in RFC 3339 format
+//   - NETCONSOLE_ELAPSED: the seconds since the host booted
+//   - NETCONSOLE_LEVEL: the kernel level of the log
+//   - NETCONSOLE_EVENT: the Event detected in the log
+//   - NETCONSOLE_MESSAGE: the log message
+//
+// The command's standard output and error are written to netconsoled's
+// standard error.
+//
+// Commands run in the background, and logs which arrive while the maximum
+// number of commands are running are dropped with an error.  When a Server
+// uses the Sink, logs whose command fails are passed to its DeadLetter Sink.
+// Closing the Sink waits for all commands to exit.
+func ExecEventSink(cfg ExecConfig) (Sink, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 1 * time.Minute
+	}
+	if cfg.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("exec maximum concurrent commands must not be negative: %d", cfg.MaxConcurrent)
+	}
+	if cfg.MaxConcurrent == 0 {
+		cfg.MaxConcurrent = 4
+	}
+
+	return &execEventSink{
+		cfg:  cfg,
+		semC: make(chan struct{}, cfg.MaxConcurrent),
+	}, nil
+}
+
+var (
+	_ Sink      = &execEventSink{}
+	_ asyncSink = &execEventSink{}
+	_ queueSink = &execEventSink{}
+)
+
+type execEventSink struct {
+	failureHook
+
+	cfg  ExecConfig
+	semC chan struct{}
+	wg   sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+func (s *execEventSink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return s.CheckHealth()
+}
+
+func (s *execEventSink) CheckHealth() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *execEventSink) Store(d Data) error {
+	level, msg := ParseLevel(d.Log.Message)
+	e := d.Event()
+
+	switch {
+	case len(s.cfg.Events) > 0 && !containsEvent(s.cfg.Events, e):
+		return nil
+	case len(s.cfg.Events) == 0 && e == EventNone:
+		return nil
+	}
+
+	// Commands must not be started once Close is waiting for them to exit.
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("sink is closed")
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	select {
+	case s.semC <- struct{}{}:
+	default:
+		s.wg.Done()
+		return fmt.Errorf("dropped %s event from %s, %d commands are already running",
+			e, d.Host(), cap(s.semC))
+	}
+
+	var addr string
+	if d.Addr != nil {
+		addr = d.Addr.String()
+	}
+
+	t := d.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	env := append(os.Environ(),
+		"NETCONSOLE_HOST="+d.Host(),
+		"NETCONSOLE_ADDR="+addr,
+		"NETCONSOLE_TIME="+t.Format(time.RFC3339Nano),
+		fmt.Sprintf("NETCONSOLE_ELAPSED=%f", d.Log.Elapsed.Seconds()),
+		"NETCONSOLE_LEVEL="+level.String(),
+		"NETCONSOLE_EVENT="+string(e),
+		"NETCONSOLE_MESSAGE="+msg,
+	)
+
+	go func() {
+		defer func() {
+			<-s.semC
+			s.wg.Done()
+		}()
+
+		err := s.run(env)
+		if err != nil {
+			err = fmt.Errorf("command %q failed for %s event from %s: %v",
+				s.cfg.Command[0], e, d.Host(), err)
+			s.failed([]Data{d}, err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.err = err
+	}()
+
+	return nil
+}
+
+func (s *execEventSink) saturated() error {
+	if n := len(s.semC); n == cap(s.semC) {
+		return fmt.Errorf("%d commands are already running", n)
+	}
+
+	return nil
+}
+
+func (s *execEventSink) String() string {
+	return fmt.Sprintf("exec: event %q", strings.Join(s.cfg.Command, " "))
+}
+
+// run runs the command once with the specified environment.
+func (s *execEventSink) run(env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.cfg.Command[0], s.cfg.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
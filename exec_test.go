@@ -0,0 +1,279 @@
+package netconsoled_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestExecSink(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		want   []string
+	}{
+		{
+			name: "text",
+			want: []string{
+				"[192.168.1.1:6666] [       1.000000] hello",
+				"[192.168.1.2:6666] [       2.000000] world",
+			},
+		},
+		{
+			name:   "JSON",
+			format: netconsoled.ExecJSON,
+			want: []string{
+				`{"time":"` + time.Unix(1, 0).Format(time.RFC3339Nano) + `","host":"192.168.1.1","addr":"192.168.1.1:6666","elapsed":1,"message":"hello"}`,
+				`{"time":"` + time.Unix(2, 0).Format(time.RFC3339Nano) + `","host":"192.168.1.2","addr":"192.168.1.2:6666","elapsed":2,"message":"world"}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, done := testExecFile(t)
+			defer done()
+
+			sink, err := netconsoled.ExecSink(netconsoled.ExecConfig{
+				Command: []string{"sh", "-c", `cat > "$0"`, file},
+				Format:  tt.format,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			for _, d := range []netconsoled.Data{
+				testData(1, 1, "hello"),
+				testData(2, 2, "world"),
+			} {
+				if err := sink.Store(d); err != nil {
+					t.Fatalf("failed to store log: %v", err)
+				}
+			}
+
+			// Closing the sink waits for the command to exit.
+			if err := sink.(io.Closer).Close(); err != nil {
+				t.Fatalf("failed to close sink: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, readExecFile(t, file)); diff != "" {
+				t.Fatalf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExecSinkRestart(t *testing.T) {
+	file, done := testExecFile(t)
+	defer done()
+
+	// The command exits after reading a single log.
+	sink, err := netconsoled.ExecSink(netconsoled.ExecConfig{
+		Command:    []string{"sh", "-c", `head -n 1 >> "$0"`, file},
+		Events:     []netconsoled.Event{netconsoled.EventOops},
+		MinBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	hc := sink.(netconsoled.HealthChecker)
+
+	for i := 1; i <= 2; i++ {
+		// Logs without a matching event are ignored.
+		for _, msg := range []string{"hello", "Oops: 0002 [#1] SMP"} {
+			if err := sink.Store(testData(1, i, msg)); err != nil {
+				t.Fatalf("failed to store log: %v", err)
+			}
+		}
+
+		// Wait for the command to exit, and for the restart backoff.
+		deadline := time.Now().Add(5 * time.Second)
+		for hc.CheckHealth() == nil {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for command to exit")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	want := []string{
+		"[192.168.1.1:6666] [       1.000000] Oops: 0002 [#1] SMP",
+		"[192.168.1.1:6666] [       2.000000] Oops: 0002 [#1] SMP",
+	}
+
+	if diff := cmp.Diff(want, readExecFile(t, file)); diff != "" {
+		t.Fatalf("unexpected output (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecSinkBlockedCommand(t *testing.T) {
+	// The command never reads its input, and exits shortly.
+	sink, err := netconsoled.ExecSink(netconsoled.ExecConfig{
+		Command: []string{"sleep", "1"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	msg := strings.Repeat("a", 1024)
+
+	// Once the pipe and the queue are full, logs are dropped rather than
+	// blocking the caller.
+	var dropped int
+	start := time.Now()
+	for i := 0; i < 2048; i++ {
+		if err := sink.Store(testData(1, i, msg)); err != nil {
+			dropped++
+		}
+	}
+
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("storing logs blocked for %s", d)
+	}
+	if dropped == 0 {
+		t.Fatal("expected logs to be dropped, but none were")
+	}
+
+	// Once the command exits, queued logs cannot be written.
+	_ = sink.(io.Closer).Close()
+	if err := sink.(netconsoled.HealthChecker).CheckHealth(); err == nil {
+		t.Fatal("expected sink to be unhealthy")
+	}
+}
+
+func TestExecEventSink(t *testing.T) {
+	file, done := testExecFile(t)
+	defer done()
+
+	sink, err := netconsoled.ExecEventSink(netconsoled.ExecConfig{
+		Command: []string{
+			"sh", "-c",
+			`echo "$NETCONSOLE_HOST $NETCONSOLE_ADDR $NETCONSOLE_ELAPSED $NETCONSOLE_LEVEL $NETCONSOLE_EVENT $NETCONSOLE_MESSAGE" >> "$0"`,
+			file,
+		},
+		MaxConcurrent: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for _, d := range []netconsoled.Data{
+		testData(1, 1, "hello"),
+		testData(2, 2, "<0>Kernel panic - not syncing: Fatal exception"),
+	} {
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	want := []string{
+		"192.168.1.2 192.168.1.2:6666 2.000000 emerg panic Kernel panic - not syncing: Fatal exception",
+	}
+
+	if diff := cmp.Diff(want, readExecFile(t, file)); diff != "" {
+		t.Fatalf("unexpected output (-want +got):\n%s", diff)
+	}
+}
+
+func TestExecEventSinkLimits(t *testing.T) {
+	sink, err := netconsoled.ExecEventSink(netconsoled.ExecConfig{
+		Command:       []string{"sleep", "10"},
+		Timeout:       100 * time.Millisecond,
+		MaxConcurrent: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	const msg = "Kernel panic - not syncing: Fatal exception"
+
+	if err := sink.Store(testData(1, 1, msg)); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	// The first command is still running, so this event is dropped.
+	if err := sink.Store(testData(2, 2, msg)); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	// The first command is killed after its timeout.
+	if err := sink.(io.Closer).Close(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestExecSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.ExecConfig
+	}{
+		{
+			name: "command",
+		},
+		{
+			name: "format",
+			cfg: netconsoled.ExecConfig{
+				Command: []string{"cat"},
+				Format:  "xml",
+			},
+		},
+		{
+			name: "event",
+			cfg: netconsoled.ExecConfig{
+				Command: []string{"cat"},
+				Events:  []netconsoled.Event{"foo"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.ExecSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// testExecFile returns the path of a file for a command to write, and a
+// function to clean it up.
+func testExecFile(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "netconsoled-exec-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	return filepath.Join(dir, "out"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// readExecFile reads the lines written by a command.
+func readExecFile(t *testing.T, file string) []string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
@@ -0,0 +1,267 @@
+package netconsoled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A FailoverConfig configures a failover Sink.
+type FailoverConfig struct {
+	// ProbeInterval is the minimum interval between attempts to fail back
+	// to the primary Sink while a secondary Sink is in use.  If zero, 30
+	// seconds is used.
+	ProbeInterval time.Duration
+
+	// Name identifies the failover group in its metrics, and must be unique
+	// among the failover Sinks registered with a Prometheus registry.  If
+	// empty, the kinds of the failover Sink's Sinks are used.
+	Name string
+}
+
+// FailoverSink creates a Sink which stores each log in the first of an
+// ordered list of Sinks which is able to store it.  The first Sink is the
+// primary Sink, and the others are used in order only when the Sinks before
+// them fail.
+//
+// A Sink is skipped if it reports that it is not healthy, or if it returns
+// an error when storing a log.  While a secondary Sink is in use, a log is
+// sent to the primary Sink once every probe interval regardless of its
+// health, and the failover Sink fails back to the primary Sink if it is
+// stored successfully.
+//
+// If any of the Sinks implements BatchSink, the failover Sink also implements
+// BatchSink, and each batch is stored in full by a single Sink.  A Server
+// batches logs for it using the smallest batch size and wait configured by
+// any of the Sinks.
+//
+// The failover Sink reports which Sink is in use by registering it as a
+// prometheus.Collector.  Metrics of the Sinks it contains are not included,
+// and can be registered by using WalkSinks to find them.
+func FailoverSink(cfg FailoverConfig, sinks ...Sink) (Sink, error) {
+	if len(sinks) < 2 {
+		return nil, fmt.Errorf("failover sink must have at least two sinks: %d", len(sinks))
+	}
+
+	if cfg.ProbeInterval < 0 {
+		return nil, fmt.Errorf("failover probe interval must not be negative: %s", cfg.ProbeInterval)
+	}
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = 30 * time.Second
+	}
+
+	s := &failoverSink{
+		cfg:   cfg,
+		sinks: sinks,
+	}
+
+	if cfg.Name == "" {
+		names := make([]string, 0, len(sinks))
+		for _, sink := range sinks {
+			names = append(names, metricName(sink))
+		}
+
+		cfg.Name = strings.Join(names, ",")
+	}
+
+	s.activeSink = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace:   "netconsoled",
+		Subsystem:   "failover",
+		Name:        "active",
+		Help:        "Whether each sink in a failover group is the sink in use.",
+		ConstLabels: prometheus.Labels{"failover": cfg.Name},
+	}, []string{"sink", "index"})
+
+	for i := range sinks {
+		var v float64
+		if i == 0 {
+			v = 1
+		}
+
+		s.setActive(i, v)
+	}
+
+	for _, sink := range sinks {
+		if _, ok := sink.(BatchSink); ok {
+			return &failoverBatchSink{failoverSink: s}, nil
+		}
+	}
+
+	return s, nil
+}
+
+var (
+	_ ContextSink          = &failoverSink{}
+	_ prometheus.Collector = &failoverSink{}
+	_ BatchSink            = &failoverBatchSink{}
+	_ contextBatchSink     = &failoverBatchSink{}
+)
+
+type failoverSink struct {
+	cfg   FailoverConfig
+	sinks []Sink
+
+	activeSink *prometheus.GaugeVec
+
+	mu     sync.Mutex
+	active int
+	probed time.Time
+}
+
+func (s *failoverSink) inner() []Sink { return s.sinks }
+
+func (s *failoverSink) Close() error {
+	// Close every Sink, even if some of them fail.
+	var err error
+	for _, sink := range s.sinks {
+		c, ok := sink.(io.Closer)
+		if !ok {
+			continue
+		}
+
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (s *failoverSink) CheckHealth() error {
+	// The failover Sink is healthy as long as any Sink is healthy.
+	errs := make([]string, 0, len(s.sinks))
+	for _, sink := range s.sinks {
+		err := checkHealth(sink)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Sprintf("%s: %v", sink, err))
+	}
+
+	return fmt.Errorf("no failover sinks are healthy: %s", strings.Join(errs, "; "))
+}
+
+func (s *failoverSink) Store(d Data) error { return s.StoreContext(context.Background(), d) }
+
+func (s *failoverSink) StoreContext(ctx context.Context, d Data) error {
+	err := s.store(func(sink Sink) error {
+		return ContextSinkAdapter(sink).StoreContext(ctx, d)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store log in any failover sink: %v", err)
+	}
+
+	return nil
+}
+
+// store invokes fn with the first Sink which is able to store logs, and
+// returns the errors from each Sink if none of them are.
+func (s *failoverSink) store(fn func(sink Sink) error) error {
+	s.mu.Lock()
+	start, probe := s.active, false
+	if start > 0 && time.Since(s.probed) >= s.cfg.ProbeInterval {
+		start, probe = 0, true
+		s.probed = time.Now()
+	}
+	s.mu.Unlock()
+
+	var errs []string
+	for i := start; i < len(s.sinks); i++ {
+		sink := s.sinks[i]
+
+		// The primary Sink is probed even if it is not healthy, since some
+		// Sinks only report that they have recovered after storing a log.
+		if !probe || i != 0 {
+			if err := checkHealth(sink); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", sink, err))
+				continue
+			}
+		}
+
+		if err := fn(sink); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", sink, err))
+			continue
+		}
+
+		s.use(i)
+		return nil
+	}
+
+	// Sinks before the active Sink were skipped, so try them once more
+	// before giving up.
+	for i := 0; i < start; i++ {
+		if err := fn(s.sinks[i]); err == nil {
+			s.use(i)
+			return nil
+		}
+	}
+
+	return errors.New(strings.Join(errs, "; "))
+}
+
+func (s *failoverSink) String() string {
+	names := make([]string, 0, len(s.sinks))
+	for _, sink := range s.sinks {
+		names = append(names, sink.String())
+	}
+
+	return fmt.Sprintf("failover: [%s]", strings.Join(names, ", "))
+}
+
+// setActive sets the value of the active sink metric for the Sink at index i.
+func (s *failoverSink) setActive(i int, v float64) {
+	s.activeSink.WithLabelValues(metricName(s.sinks[i]), strconv.Itoa(i)).Set(v)
+}
+
+// Describe implements prometheus.Collector.
+func (s *failoverSink) Describe(ch chan<- *prometheus.Desc) { s.activeSink.Describe(ch) }
+
+// Collect implements prometheus.Collector.
+func (s *failoverSink) Collect(ch chan<- prometheus.Metric) { s.activeSink.Collect(ch) }
+
+// A failoverBatchSink is a failover Sink with a member which implements
+// BatchSink.
+type failoverBatchSink struct {
+	*failoverSink
+}
+
+func (s *failoverBatchSink) batchConfig() BatchConfig { return memberBatchConfig(s.sinks) }
+
+func (s *failoverBatchSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *failoverBatchSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	err := s.store(func(sink Sink) error { return storeBatch(ctx, sink, ds) })
+	if err != nil {
+		return fmt.Errorf("failed to store %d logs in any failover sink: %v", len(ds), err)
+	}
+
+	return nil
+}
+
+// use makes the Sink at index i the active Sink.
+func (s *failoverSink) use(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Probe the primary Sink one interval after failing over.
+	if i > 0 && s.active == 0 {
+		s.probed = time.Now()
+	}
+
+	if i != s.active {
+		s.setActive(s.active, 0)
+		s.setActive(i, 1)
+	}
+
+	s.active = i
+}
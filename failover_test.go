@@ -0,0 +1,263 @@
+package netconsoled_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFailoverSink(t *testing.T) {
+	var (
+		primary   = &failoverTestSink{name: "primary", err: errors.New("relay unreachable")}
+		secondary = &failoverTestSink{name: "secondary"}
+	)
+
+	sink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{
+		ProbeInterval: 50 * time.Millisecond,
+	}, primary, secondary)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	store := func(msg string) {
+		t.Helper()
+
+		if err := sink.Store(testData(1, 1, msg)); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	// The first log falls through to the secondary sink, which is used
+	// until the primary sink is probed.
+	store("foo")
+	store("bar")
+
+	// The primary sink recovers, and the next probe fails back to it.
+	primary.setErr(nil)
+	time.Sleep(100 * time.Millisecond)
+	store("baz")
+	store("qux")
+
+	if diff := cmp.Diff([]string{"baz", "qux"}, primary.stored()); diff != "" {
+		t.Fatalf("unexpected primary logs (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"foo", "bar"}, secondary.stored()); diff != "" {
+		t.Fatalf("unexpected secondary logs (-want +got):\n%s", diff)
+	}
+
+	// The primary sink was not attempted again until it was probed.
+	if diff := cmp.Diff(3, primary.attempts()); diff != "" {
+		t.Fatalf("unexpected primary attempts (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailoverSinkBatch(t *testing.T) {
+	var (
+		primary   = &testBatchSink{err: errors.New("backend unavailable")}
+		secondary = &failoverTestSink{name: "secondary"}
+	)
+
+	sink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{}, primary, secondary)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// A member implements BatchSink, so the failover sink does too, and
+	// a batch which the primary sink fails to store is stored in full by
+	// the secondary sink.
+	bs, ok := sink.(netconsoled.BatchSink)
+	if !ok {
+		t.Fatalf("failover sink does not implement BatchSink: %T", sink)
+	}
+
+	if err := bs.StoreBatch([]netconsoled.Data{
+		testData(1, 1, "foo"),
+		testData(1, 2, "bar"),
+	}); err != nil {
+		t.Fatalf("failed to store logs: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"foo", "bar"}, secondary.stored()); diff != "" {
+		t.Fatalf("unexpected secondary logs (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailoverSinkMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	// Failover groups containing the same sinks are told apart by name, so
+	// that each can be registered.
+	for _, name := range []string{"1", "2"} {
+		sink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{Name: name},
+			&failoverTestSink{name: "primary"},
+			&failoverTestSink{name: "secondary"},
+		)
+		if err != nil {
+			t.Fatalf("failed to create sink: %v", err)
+		}
+
+		if err := reg.Register(sink.(prometheus.Collector)); err != nil {
+			t.Fatalf("failed to register failover sink %q: %v", name, err)
+		}
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	var got []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			var ls []string
+			for _, l := range m.GetLabel() {
+				ls = append(ls, l.GetName()+"="+l.GetValue())
+			}
+
+			got = append(got, fmt.Sprintf("%s %v", ls, m.GetGauge().GetValue()))
+		}
+	}
+
+	want := []string{
+		"[failover=1 index=0 sink=primary] 1",
+		"[failover=1 index=1 sink=secondary] 0",
+		"[failover=2 index=0 sink=primary] 1",
+		"[failover=2 index=1 sink=secondary] 0",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected metrics (-want +got):\n%s", diff)
+	}
+}
+
+func TestFailoverSinkHealth(t *testing.T) {
+	var (
+		primary   = &failoverTestSink{name: "primary", health: errors.New("backlog")}
+		secondary = &failoverTestSink{name: "secondary"}
+	)
+
+	sink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{}, primary, secondary)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// Unhealthy sinks are skipped without attempting to store logs.
+	if err := sink.Store(testData(1, 1, "foo")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	if diff := cmp.Diff(0, primary.attempts()); diff != "" {
+		t.Fatalf("unexpected primary attempts (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"foo"}, secondary.stored()); diff != "" {
+		t.Fatalf("unexpected secondary logs (-want +got):\n%s", diff)
+	}
+
+	hc := sink.(netconsoled.HealthChecker)
+	if err := hc.CheckHealth(); err != nil {
+		t.Fatalf("expected healthy sink: %v", err)
+	}
+
+	// The failover sink is unhealthy only when all of its sinks are, and
+	// fails to store logs when all of its sinks fail.
+	secondary.mu.Lock()
+	secondary.err = errors.New("disk full")
+	secondary.health = secondary.err
+	secondary.mu.Unlock()
+
+	if err := hc.CheckHealth(); err == nil {
+		t.Fatal("expected unhealthy sink, but no error occurred")
+	}
+
+	primary.setErr(errors.New("relay unreachable"))
+	if err := sink.Store(testData(1, 2, "bar")); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestFailoverSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   netconsoled.FailoverConfig
+		sinks []netconsoled.Sink
+	}{
+		{
+			name:  "one sink",
+			sinks: []netconsoled.Sink{netconsoled.NoopSink()},
+		},
+		{
+			name:  "probe interval",
+			cfg:   netconsoled.FailoverConfig{ProbeInterval: -1},
+			sinks: []netconsoled.Sink{netconsoled.NoopSink(), netconsoled.NoopSink()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.FailoverSink(tt.cfg, tt.sinks...); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// A failoverTestSink records the logs it stores, and fails to store logs
+// while err is set.
+type failoverTestSink struct {
+	name string
+
+	mu     sync.Mutex
+	err    error
+	health error
+	n      int
+	logs   []string
+}
+
+func (s *failoverTestSink) Store(d netconsoled.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.n++
+	if s.err != nil {
+		return s.err
+	}
+
+	s.logs = append(s.logs, d.Log.Message)
+	return nil
+}
+
+func (s *failoverTestSink) CheckHealth() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health
+}
+
+func (s *failoverTestSink) String() string { return s.name }
+
+func (s *failoverTestSink) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+func (s *failoverTestSink) attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
+
+func (s *failoverTestSink) stored() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logs
+}
@@ -1,7 +1,9 @@
 package netconsoled
 
 import (
+	"context"
 	"fmt"
+	"strings"
 )
 
 // A Filter allows filtering and transformation of incoming logs based on the
@@ -18,6 +20,44 @@ type Filter interface {
 	fmt.Stringer
 }
 
+// A ContextFilter is a Filter which accepts a context.Context, so that it
+// can be canceled or given a deadline.
+type ContextFilter interface {
+	Filter
+
+	// FilterContext is like Filter, but ctx may be used to cancel the
+	// operation.
+	FilterContext(ctx context.Context, in Data) (out Data, pass bool, err error)
+}
+
+// ContextFilterAdapter adapts f into a ContextFilter.  If f is already a
+// ContextFilter, it is returned.  Otherwise, FilterContext returns an error
+// if ctx is done, and calls f's Filter method if it is not.
+func ContextFilterAdapter(f Filter) ContextFilter {
+	if cf, ok := f.(ContextFilter); ok {
+		return cf
+	}
+
+	return &contextFilter{f: f}
+}
+
+var _ ContextFilter = &contextFilter{}
+
+type contextFilter struct {
+	f Filter
+}
+
+func (f *contextFilter) Filter(in Data) (Data, bool, error) { return f.f.Filter(in) }
+func (f *contextFilter) String() string                     { return f.f.String() }
+
+func (f *contextFilter) FilterContext(ctx context.Context, in Data) (Data, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Data{}, false, err
+	}
+
+	return f.f.Filter(in)
+}
+
 // MultiFilter chains zero or more Filters together.  The output of each Filter
 // is passed to the next Filter in the chain.  If any Filter does not pass
 // a given log, subsequent Filters in the chain are not invoked.
@@ -27,13 +67,17 @@ func MultiFilter(filters ...Filter) Filter {
 	}
 }
 
-var _ Filter = &multiFilter{}
+var _ ContextFilter = &multiFilter{}
 
 type multiFilter struct {
 	filters []Filter
 }
 
 func (f *multiFilter) Filter(in Data) (Data, bool, error) {
+	return f.FilterContext(context.Background(), in)
+}
+
+func (f *multiFilter) FilterContext(ctx context.Context, in Data) (Data, bool, error) {
 	var (
 		out  Data
 		pass bool
@@ -41,7 +85,7 @@ func (f *multiFilter) Filter(in Data) (Data, bool, error) {
 	)
 
 	for _, filter := range f.filters {
-		out, pass, err = filter.Filter(in)
+		out, pass, err = ContextFilterAdapter(filter).FilterContext(ctx, in)
 		if err != nil {
 			return Data{}, false, err
 		}
@@ -56,8 +100,28 @@ func (f *multiFilter) Filter(in Data) (Data, bool, error) {
 }
 
 func (f *multiFilter) String() string {
-	// TODO(mdlayher): loop through filters and list.
-	return "multi"
+	names := make([]string, 0, len(f.filters))
+	for _, filter := range f.filters {
+		names = append(names, filter.String())
+	}
+
+	return fmt.Sprintf("multi: [%s]", strings.Join(names, ", "))
+}
+
+// wrapFilters wraps filter, or each of the Filters within filter if it is a
+// MultiFilter, using fn.
+func wrapFilters(filter Filter, fn func(f Filter) Filter) Filter {
+	mf, ok := filter.(*multiFilter)
+	if !ok {
+		return fn(filter)
+	}
+
+	filters := make([]Filter, 0, len(mf.filters))
+	for _, f := range mf.filters {
+		filters = append(filters, wrapFilters(f, fn))
+	}
+
+	return MultiFilter(filters...)
 }
 
 // FuncFilter adapts a function into a Filter.
@@ -76,6 +140,30 @@ type funcFilter struct {
 func (f *funcFilter) Filter(in Data) (Data, bool, error) { return f.fn(in) }
 func (f *funcFilter) String() string                     { return "func" }
 
+// FuncContextFilter adapts a function which accepts a context.Context into
+// a ContextFilter.
+func FuncContextFilter(filter func(ctx context.Context, in Data) (Data, bool, error)) ContextFilter {
+	return &funcContextFilter{
+		fn: filter,
+	}
+}
+
+var _ ContextFilter = &funcContextFilter{}
+
+type funcContextFilter struct {
+	fn func(ctx context.Context, in Data) (Data, bool, error)
+}
+
+func (f *funcContextFilter) Filter(in Data) (Data, bool, error) {
+	return f.fn(context.Background(), in)
+}
+
+func (f *funcContextFilter) FilterContext(ctx context.Context, in Data) (Data, bool, error) {
+	return f.fn(ctx, in)
+}
+
+func (f *funcContextFilter) String() string { return "func" }
+
 // NoopFilter returns a Filter that performs no processing and always passes a log.
 func NoopFilter() Filter {
 	return &noopFilter{}
@@ -1,6 +1,7 @@
 package netconsoled_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -33,6 +34,14 @@ func TestFilter(t *testing.T) {
 			},
 			verify: testMultiFilterAllow,
 		},
+		{
+			name:   "multi context",
+			verify: testMultiFilterContext,
+		},
+		{
+			name:   "multi string",
+			verify: testMultiFilterString,
+		},
 	}
 
 	for _, tt := range tests {
@@ -98,3 +107,55 @@ func testMultiFilterAllow(t *testing.T, d netconsoled.Data) {
 		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
 	}
 }
+
+func testMultiFilterContext(t *testing.T, d netconsoled.Data) {
+	t.Helper()
+
+	type key struct{}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "foo"))
+	defer cancel()
+
+	// The context is passed to context-aware filters.
+	var got interface{}
+	ctxFilter := netconsoled.FuncContextFilter(func(ctx context.Context, in netconsoled.Data) (netconsoled.Data, bool, error) {
+		got = ctx.Value(key{})
+		cancel()
+		return in, true, nil
+	})
+
+	filter := netconsoled.ContextFilterAdapter(netconsoled.MultiFilter(
+		netconsoled.NoopFilter(),
+		ctxFilter,
+		// Should stop here once canceled and not reach panic filter.
+		panicFilter,
+	))
+
+	_, pass, err := filter.FilterContext(ctx, d)
+	if err != context.Canceled {
+		t.Fatalf("expected context canceled error, but got: %v", err)
+	}
+	if pass {
+		t.Fatal("expected filter to disallow log, but it was allowed")
+	}
+
+	if diff := cmp.Diff("foo", got); diff != "" {
+		t.Fatalf("unexpected context value (-want +got):\n%s", diff)
+	}
+}
+
+func testMultiFilterString(t *testing.T, _ netconsoled.Data) {
+	t.Helper()
+
+	filter := netconsoled.MultiFilter(
+		netconsoled.NoopFilter(),
+		netconsoled.MultiFilter(
+			panicFilter,
+			netconsoled.NoopFilter(),
+		),
+	)
+
+	if diff := cmp.Diff("multi: [noop, multi: [func, noop]]", filter.String()); diff != "" {
+		t.Fatalf("unexpected filter name (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,50 @@
+package netconsoled
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redactURL returns u without any user information, so that it can be used
+// in names and metric labels without exposing credentials.
+func redactURL(u *url.URL) string {
+	ru := *u
+	ru.User = nil
+	return ru.String()
+}
+
+// originURL returns only the scheme and host of u, for Sinks whose URLs may
+// contain secrets in their path or query, such as incoming chat webhooks.
+func originURL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+}
+
+// maxErrorBody is the maximum number of bytes of an HTTP error response
+// included in an error.
+const maxErrorBody = 512
+
+// doHTTP performs an HTTP request for a sink and returns the response body
+// if the request succeeds.  If it fails, doHTTP reports whether the request
+// should be retried: on network errors, rate limiting, and server errors.
+func doHTTP(c *http.Client, req *http.Request) ([]byte, bool, error) {
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 == 2 {
+		b, err := ioutil.ReadAll(res.Body)
+		return b, true, err
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	err = fmt.Errorf("unexpected HTTP status %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode/100 == 5
+	return nil, retry, err
+}
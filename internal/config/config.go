@@ -1,18 +1,28 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/mdlayher/netconsoled"
+	"github.com/mdlayher/netconsoled/internal/store"
 	yaml "gopkg.in/yaml.v2"
 )
 
 // Parse parses a Config from its raw YAML format.
 func Parse(b []byte) (*Config, error) {
+	// Unknown keys are rejected so that misspelled or unsupported options
+	// are not silently ignored.
 	var c RawConfig
-	if err := yaml.Unmarshal(b, &c); err != nil {
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
 		return nil, err
 	}
 
@@ -30,10 +40,16 @@ func Parse(b []byte) (*Config, error) {
 		return nil, err
 	}
 
+	dl, err := parseDeadLetter(c.DeadLetter)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		Server:  c.Server,
-		Filters: filters,
-		Sinks:   sinks,
+		Server:     c.Server,
+		Filters:    filters,
+		Sinks:      sinks,
+		DeadLetter: dl,
 	}, nil
 }
 
@@ -53,6 +69,81 @@ func checkServerConfig(c ServerConfig) error {
 		}
 	}
 
+	if c.SyslogUDPAddr != "" {
+		if _, err := net.ResolveUDPAddr("udp", c.SyslogUDPAddr); err != nil {
+			return fmt.Errorf("failed to parse server syslog UDP address: %v", err)
+		}
+	}
+
+	if c.SyslogTCPAddr != "" {
+		if _, err := net.ResolveTCPAddr("tcp", c.SyslogTCPAddr); err != nil {
+			return fmt.Errorf("failed to parse server syslog TCP address: %v", err)
+		}
+	}
+
+	if c.RelayAddr != "" {
+		addr, err := net.ResolveTCPAddr("tcp", c.RelayAddr)
+		if err != nil {
+			return fmt.Errorf("failed to parse server relay address: %v", err)
+		}
+
+		// Relayed logs may claim to come from any host, so peers must be
+		// authenticated unless only local processes can connect.
+		if !addr.IP.IsLoopback() && (c.RelayTLS == nil || c.RelayTLS.CAFile == "") {
+			return fmt.Errorf("server relay address %q is not a loopback address and requires relay TLS with a client CA file", c.RelayAddr)
+		}
+	}
+
+	if c.RelayTLS != nil {
+		if c.RelayAddr == "" {
+			return errors.New("server relay TLS configuration requires a relay address")
+		}
+
+		if _, err := ServerTLSConfig(c.RelayTLS); err != nil {
+			return err
+		}
+	}
+
+	if c.SinkTimeout < 0 {
+		return fmt.Errorf("server sink timeout must not be negative: %s", c.SinkTimeout)
+	}
+
+	if c.BatchSize < 0 {
+		return fmt.Errorf("server batch size must not be negative: %d", c.BatchSize)
+	}
+	if c.BatchWait < 0 {
+		return fmt.Errorf("server batch wait must not be negative: %s", c.BatchWait)
+	}
+
+	seen := make(map[string]bool, len(c.ExpectedHosts))
+	for _, h := range c.ExpectedHosts {
+		if h == "" {
+			return errors.New("server expected host must not be empty")
+		}
+
+		// Hosts are identified by the IP address which sent their logs, so
+		// expected hosts must match that address exactly.
+		ip := net.ParseIP(h)
+		if ip == nil {
+			return fmt.Errorf("server expected host must be an IP address: %q", h)
+		}
+		if ip.String() != h {
+			return fmt.Errorf("server expected host %q must be written as %q", h, ip.String())
+		}
+		if seen[h] {
+			return fmt.Errorf("duplicate server expected host: %q", h)
+		}
+
+		seen[h] = true
+	}
+
+	if c.SilenceThreshold < 0 {
+		return fmt.Errorf("server silence threshold must not be negative: %s", c.SilenceThreshold)
+	}
+	if c.SilenceThreshold > 0 && len(c.ExpectedHosts) == 0 {
+		return errors.New("server silence threshold requires expected hosts")
+	}
+
 	return nil
 }
 
@@ -81,27 +172,13 @@ func parseFilters(c RawConfig) ([]netconsoled.Filter, error) {
 
 // parseSinks builds a slice of netconsoled.Sinks from a RawConfig.
 func parseSinks(c RawConfig) ([]netconsoled.Sink, error) {
-	var ss []netconsoled.Sink
+	var (
+		ss []netconsoled.Sink
+		p  sinkParser
+	)
+
 	for _, s := range c.Sinks {
-		var (
-			sink netconsoled.Sink
-			err  error
-		)
-
-		switch s.Type {
-		case "file":
-			if s.File == "" {
-				return nil, errors.New("must specify output file for file sink")
-			}
-
-			sink, err = netconsoled.FileSink(s.File)
-		case "noop":
-			sink = netconsoled.NoopSink()
-		case "stdout":
-			sink = netconsoled.StdoutSink()
-		default:
-			return nil, fmt.Errorf("unknown sink type in configuration: %q", s.Type)
-		}
+		sink, err := p.parse(s)
 		if err != nil {
 			return nil, err
 		}
@@ -116,6 +193,417 @@ func parseSinks(c RawConfig) ([]netconsoled.Sink, error) {
 	return ss, nil
 }
 
+// A sinkParser builds netconsoled.Sinks, and ensures that sinks which may
+// only be configured once are not configured again.
+type sinkParser struct {
+	memory    bool
+	stored    bool
+	failovers int
+}
+
+// parse builds a single netconsoled.Sink from a RawSink.
+func (p *sinkParser) parse(s RawSink) (netconsoled.Sink, error) {
+	var (
+		sink netconsoled.Sink
+		err  error
+	)
+
+	if (s.BatchSize != 0 || s.BatchWait != 0) && !batchSinks[s.Type] {
+		return nil, fmt.Errorf("%s sink does not support batch size or batch wait", s.Type)
+	}
+
+	switch s.Type {
+	case "alertmanager":
+		sink, err = netconsoled.AlertmanagerSink(netconsoled.AlertmanagerConfig{
+			URL:        s.URL,
+			Username:   s.Username,
+			Password:   s.Password,
+			Events:     parseEvents(s.Events),
+			AlertName:  s.AlertName,
+			Labels:     s.Labels,
+			Resolve:    s.Resolve,
+			MaxRetries: s.MaxRetries,
+			Timeout:    s.Timeout,
+		})
+	case "elasticsearch":
+		sink, err = netconsoled.ElasticsearchSink(netconsoled.ElasticsearchConfig{
+			URL:        s.URL,
+			Index:      s.Index,
+			Username:   s.Username,
+			Password:   s.Password,
+			BatchSize:  s.BatchSize,
+			BatchWait:  s.BatchWait,
+			MaxRetries: s.MaxRetries,
+		})
+	case "email":
+		sink, err = emailSink(s)
+	case "exec":
+		cfg := netconsoled.ExecConfig{
+			Command:       s.Command,
+			Format:        s.Format,
+			Events:        parseEvents(s.Events),
+			Timeout:       s.Timeout,
+			MaxConcurrent: s.MaxConcurrent,
+		}
+
+		if s.PerEvent {
+			sink, err = netconsoled.ExecEventSink(cfg)
+		} else {
+			sink, err = netconsoled.ExecSink(cfg)
+		}
+	case "failover":
+		sink, err = p.failoverSink(s)
+	case "file":
+		if s.File == "" {
+			return nil, errors.New("must specify output file for file sink")
+		}
+
+		sink, err = netconsoled.FileSink(s.File)
+	case "journald":
+		sink, err = netconsoled.JournaldSink(netconsoled.JournaldConfig{
+			Path:       s.Addr,
+			Identifier: s.Tag,
+		})
+	case "loki":
+		sink, err = netconsoled.LokiSink(netconsoled.LokiConfig{
+			URL:        s.URL,
+			Encoding:   s.Encoding,
+			TenantID:   s.TenantID,
+			Username:   s.Username,
+			Password:   s.Password,
+			Pipeline:   s.Pipeline,
+			BatchSize:  s.BatchSize,
+			BatchWait:  s.BatchWait,
+			MaxRetries: s.MaxRetries,
+		})
+	case "memory":
+		if p.memory {
+			return nil, errors.New("only one memory sink may be configured")
+		}
+		p.memory = true
+
+		sink, err = memorySink(s.Size, s.PerHost)
+	case "noop":
+		sink = netconsoled.NoopSink()
+	case "otlp":
+		sink, err = netconsoled.OTLPSink(netconsoled.OTLPConfig{
+			URL:        s.URL,
+			Headers:    s.Headers,
+			BatchSize:  s.BatchSize,
+			BatchWait:  s.BatchWait,
+			MaxRetries: s.MaxRetries,
+		})
+	case "relay":
+		sink, err = relaySink(s)
+	case "store":
+		if p.stored {
+			return nil, errors.New("only one store sink may be configured")
+		}
+		p.stored = true
+
+		if s.Dir == "" {
+			return nil, errors.New("must specify directory for store sink")
+		}
+
+		sink, err = store.Open(s.Dir, store.Options{
+			SegmentSize: s.SegmentSize,
+			MaxAge:      s.MaxAge,
+			MaxSize:     s.MaxSize,
+		})
+	case "spool":
+		sink, err = p.spoolSink(s)
+	case "stdout":
+		sink = netconsoled.StdoutSink()
+	case "syslog":
+		sink, err = syslogSink(s)
+	case "udp":
+		// A single address may be used in place of a list.
+		addrs := s.Addrs
+		if s.Addr != "" {
+			addrs = append([]string{s.Addr}, addrs...)
+		}
+
+		sink, err = netconsoled.UDPSink(netconsoled.UDPConfig{
+			Addrs:        addrs,
+			StripElapsed: s.StripElapsed,
+		})
+	case "webhook":
+		sink, err = netconsoled.WebhookSink(netconsoled.WebhookConfig{
+			URL:        s.URL,
+			Method:     s.Method,
+			Headers:    s.Headers,
+			Body:       s.Body,
+			Events:     parseEvents(s.Events),
+			BatchSize:  s.BatchSize,
+			BatchWait:  s.BatchWait,
+			RateLimit:  s.RateLimit,
+			MaxRetries: s.MaxRetries,
+			Timeout:    s.Timeout,
+		})
+	default:
+		return nil, fmt.Errorf("unknown sink type in configuration: %q", s.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// batchSinks are the sink types which support per-sink batch configuration.
+var batchSinks = map[string]bool{
+	"elasticsearch": true,
+	"loki":          true,
+	"otlp":          true,
+	"relay":         true,
+	"webhook":       true,
+}
+
+// parseDeadLetter builds a netconsoled.DeadLetterSink from a RawDeadLetter.
+// If no dead-letter sink is configured, it returns nil.
+func parseDeadLetter(dl *RawDeadLetter) (netconsoled.DeadLetterSink, error) {
+	if dl == nil {
+		return nil, nil
+	}
+
+	switch dl.Type {
+	case "file":
+		if dl.File == "" {
+			return nil, errors.New("must specify output file for file dead-letter sink")
+		}
+
+		return netconsoled.FileDeadLetterSink(dl.File)
+	case "stdout":
+		return netconsoled.WriterDeadLetterSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown dead-letter sink type in configuration: %q", dl.Type)
+	}
+}
+
+// defaultMemorySize is the default number of logs kept by a memory sink.
+const defaultMemorySize = 1000
+
+// memorySink builds a memory sink from its configuration.
+func memorySink(size int, perHost bool) (netconsoled.Sink, error) {
+	switch {
+	case size < 0:
+		return nil, fmt.Errorf("memory sink size must not be negative: %d", size)
+	case size == 0:
+		size = defaultMemorySize
+	}
+
+	return netconsoled.NewMemorySink(size, perHost), nil
+}
+
+// emailSink builds an email sink from its configuration.
+func emailSink(s RawSink) (netconsoled.Sink, error) {
+	tc, err := tlsConfig(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return netconsoled.EmailSink(netconsoled.EmailConfig{
+		Addr:       s.Addr,
+		From:       s.From,
+		To:         s.To,
+		Username:   s.Username,
+		Password:   s.Password,
+		RequireTLS: s.RequireTLS,
+		TLSConfig:  tc,
+		Events:     parseEvents(s.Events),
+		Subject:    s.Subject,
+		Interval:   s.Interval,
+		MaxRetries: s.MaxRetries,
+		Timeout:    s.Timeout,
+	})
+}
+
+// relaySink builds a relay sink from its configuration.
+func relaySink(s RawSink) (netconsoled.Sink, error) {
+	tc, err := tlsConfig(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return netconsoled.RelaySink(netconsoled.RelayConfig{
+		Network:    s.Network,
+		Addr:       s.Addr,
+		TLSConfig:  tc,
+		BatchSize:  s.BatchSize,
+		BatchWait:  s.BatchWait,
+		MaxRetries: s.MaxRetries,
+		Timeout:    s.Timeout,
+	})
+}
+
+// failoverSink builds a failover sink and the sinks it contains from its
+// configuration.
+func (p *sinkParser) failoverSink(s RawSink) (netconsoled.Sink, error) {
+	sinks := make([]netconsoled.Sink, 0, len(s.Sinks))
+	for _, rs := range s.Sinks {
+		sink, err := p.parse(rs)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, err
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	// Number failover groups in the order they are configured, so that
+	// their metrics can be told apart.
+	p.failovers++
+
+	sink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{
+		ProbeInterval: s.ProbeInterval,
+		Name:          strconv.Itoa(p.failovers),
+	}, sinks...)
+	if err != nil {
+		closeSinks(sinks)
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// spoolSink builds a spool sink and the sink it wraps from its
+// configuration.
+func (p *sinkParser) spoolSink(s RawSink) (netconsoled.Sink, error) {
+	if s.Sink == nil {
+		return nil, errors.New("must specify wrapped sink for spool sink")
+	}
+
+	sink, err := p.parse(*s.Sink)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{
+		Dir:         s.Dir,
+		MaxSize:     s.MaxSize,
+		SegmentSize: s.SegmentSize,
+		MinBackoff:  s.MinBackoff,
+		MaxBackoff:  s.MaxBackoff,
+	}, sink)
+	if err != nil {
+		closeSinks([]netconsoled.Sink{sink})
+		return nil, err
+	}
+
+	return spool, nil
+}
+
+// closeSinks closes sinks which were built for a sink that could not be
+// configured.
+func closeSinks(sinks []netconsoled.Sink) {
+	for _, sink := range sinks {
+		if c, ok := sink.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+}
+
+// syslogSink builds a syslog sink from its configuration.
+func syslogSink(s RawSink) (netconsoled.Sink, error) {
+	tc, err := tlsConfig(s.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return netconsoled.SyslogSink(netconsoled.SyslogConfig{
+		Network:   s.Network,
+		Addr:      s.Addr,
+		Format:    s.Format,
+		Tag:       s.Tag,
+		TLSConfig: tc,
+	})
+}
+
+// parseEvents converts event names to netconsoled.Events.  Unknown events
+// are reported by the sinks which use them.
+func parseEvents(ss []string) []netconsoled.Event {
+	if len(ss) == 0 {
+		return nil
+	}
+
+	es := make([]netconsoled.Event, 0, len(ss))
+	for _, s := range ss {
+		es = append(es, netconsoled.Event(s))
+	}
+
+	return es
+}
+
+// tlsConfig builds a client *tls.Config from its configuration.  If c is nil,
+// the default configuration is returned.
+func tlsConfig(c *RawTLS) (*tls.Config, error) {
+	if c == nil {
+		return &tls.Config{}, nil
+	}
+
+	tc := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %v", err)
+		}
+
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %q", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
+
+// ServerTLSConfig builds a server *tls.Config from its configuration.  The
+// certificate and key are required.  If a CA file is set, clients must
+// present a certificate signed by one of its CAs.
+func ServerTLSConfig(c *RawTLS) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("server TLS configuration requires a certificate and key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server TLS certificate: %v", err)
+	}
+
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if c.CAFile != "" {
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read server TLS CA file: %v", err)
+		}
+
+		tc.ClientCAs = x509.NewCertPool()
+		if !tc.ClientCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in server TLS CA file %q", c.CAFile)
+		}
+
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tc, nil
+}
+
 // A RawConfig is the raw structure used to unmarshal YAML configuration.
 type RawConfig struct {
 	Server ServerConfig `yaml:"server"`
@@ -124,10 +612,112 @@ type RawConfig struct {
 		Type string `yaml:"type"`
 	} `yaml:"filters"`
 
-	Sinks []struct {
-		Type string `yaml:"type"`
-		File string `yaml:"file"`
-	} `yaml:"sinks"`
+	Sinks []RawSink `yaml:"sinks"`
+
+	DeadLetter *RawDeadLetter `yaml:"dead_letter"`
+}
+
+// A RawDeadLetter is the raw configuration for a dead-letter sink, which
+// receives logs that any sink failed to store.
+type RawDeadLetter struct {
+	Type string `yaml:"type"`
+	File string `yaml:"file"`
+}
+
+// A RawSink is the raw configuration for a single sink.  Each sink type
+// uses a subset of the fields.
+type RawSink struct {
+	Type string `yaml:"type"`
+
+	// File sink.
+	File string `yaml:"file"`
+
+	// Memory sink.
+	Size    int  `yaml:"size"`
+	PerHost bool `yaml:"per_host"`
+
+	// Store and spool sinks.
+	Dir         string        `yaml:"dir"`
+	SegmentSize int64         `yaml:"segment_size"`
+	MaxAge      time.Duration `yaml:"max_age"`
+	MaxSize     int64         `yaml:"max_size"`
+
+	// Network sinks.
+	Network string  `yaml:"network"`
+	Addr    string  `yaml:"addr"`
+	TLS     *RawTLS `yaml:"tls"`
+
+	// Syslog and journald sinks.  Format is also used by the exec sink.
+	Format string `yaml:"format"`
+	Tag    string `yaml:"tag"`
+
+	// HTTP sinks.
+	URL        string            `yaml:"url"`
+	Username   string            `yaml:"username"`
+	Password   string            `yaml:"password"`
+	Headers    map[string]string `yaml:"headers"`
+	MaxRetries int               `yaml:"max_retries"`
+
+	// Batching sinks: Elasticsearch, Loki, OTLP, relay, and webhook.  These
+	// override the server's batch configuration.
+	BatchSize int           `yaml:"batch_size"`
+	BatchWait time.Duration `yaml:"batch_wait"`
+
+	// Loki sink.
+	Encoding string `yaml:"encoding"`
+	TenantID string `yaml:"tenant_id"`
+	Pipeline string `yaml:"pipeline"`
+
+	// Elasticsearch sink.
+	Index string `yaml:"index"`
+
+	// Webhook, Alertmanager, email, and exec sinks.
+	Events  []string      `yaml:"events"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Webhook sink.
+	Method    string        `yaml:"method"`
+	Body      string        `yaml:"body"`
+	RateLimit time.Duration `yaml:"rate_limit"`
+
+	// Alertmanager sink.
+	AlertName string            `yaml:"alert_name"`
+	Labels    map[string]string `yaml:"labels"`
+	Resolve   time.Duration     `yaml:"resolve"`
+
+	// Email sink.
+	From       string        `yaml:"from"`
+	To         []string      `yaml:"to"`
+	Subject    string        `yaml:"subject"`
+	Interval   time.Duration `yaml:"interval"`
+	RequireTLS bool          `yaml:"require_tls"`
+
+	// Exec sink.
+	Command       []string `yaml:"command"`
+	PerEvent      bool     `yaml:"per_event"`
+	MaxConcurrent int      `yaml:"max_concurrent"`
+
+	// UDP sink.
+	Addrs        []string `yaml:"addrs"`
+	StripElapsed bool     `yaml:"strip_elapsed"`
+
+	// Spool sink.
+	Sink       *RawSink      `yaml:"sink"`
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+
+	// Failover sink.
+	Sinks         []RawSink     `yaml:"sinks"`
+	ProbeInterval time.Duration `yaml:"probe_interval"`
+}
+
+// A RawTLS is the raw TLS configuration for a network client or server.
+type RawTLS struct {
+	CAFile             string `yaml:"ca_file" json:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file" json:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file" json:"key_file,omitempty"`
+	ServerName         string `yaml:"server_name" json:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
 }
 
 // A Config is the processed configuration for a netconsoled server.
@@ -135,11 +725,38 @@ type Config struct {
 	Server  ServerConfig
 	Filters []netconsoled.Filter
 	Sinks   []netconsoled.Sink
+
+	// DeadLetter is nil if no dead-letter sink is configured.
+	DeadLetter netconsoled.DeadLetterSink
 }
 
 // A ServerConfig contains configuration for a netconsoled server's
 // network listeners.
 type ServerConfig struct {
-	UDPAddr  string `yaml:"udp_addr"`
-	HTTPAddr string `yaml:"http_addr"`
+	UDPAddr  string `yaml:"udp_addr" json:"udp_addr"`
+	HTTPAddr string `yaml:"http_addr" json:"http_addr,omitempty"`
+
+	// Optional listeners for logs forwarded using syslog.
+	SyslogUDPAddr string `yaml:"syslog_udp_addr" json:"syslog_udp_addr,omitempty"`
+	SyslogTCPAddr string `yaml:"syslog_tcp_addr" json:"syslog_tcp_addr,omitempty"`
+
+	// Optional listener for logs relayed by other netconsoled servers, and
+	// its TLS configuration.  Unless the address is a loopback address, the
+	// TLS configuration must set a CA file so relays are authenticated using
+	// client certificates.
+	RelayAddr string  `yaml:"relay_addr" json:"relay_addr,omitempty"`
+	RelayTLS  *RawTLS `yaml:"relay_tls" json:"relay_tls,omitempty"`
+
+	// Optional maximum amount of time each sink may take to store a log.
+	SinkTimeout time.Duration `yaml:"sink_timeout" json:"sink_timeout,omitempty"`
+
+	// Optional maximum number of logs in a batch, and maximum amount of time
+	// a log is buffered, for sinks which store logs in batches.
+	BatchSize int           `yaml:"batch_size" json:"batch_size,omitempty"`
+	BatchWait time.Duration `yaml:"batch_wait" json:"batch_wait,omitempty"`
+
+	// Optional IP addresses of hosts which are expected to send logs, and the
+	// maximum amount of time they may be silent before they are reported.
+	ExpectedHosts    []string      `yaml:"expected_hosts" json:"expected_hosts,omitempty"`
+	SilenceThreshold time.Duration `yaml:"silence_threshold" json:"silence_threshold,omitempty"`
 }
@@ -2,14 +2,18 @@ package config_test
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mdlayher/netconsoled"
 	"github.com/mdlayher/netconsoled/internal/config"
+	"github.com/mdlayher/netconsoled/internal/store"
 )
 
 func TestParse(t *testing.T) {
@@ -40,6 +44,130 @@ func TestParse(t *testing.T) {
 		t.Fatalf("failed to create test file sink: %v", err)
 	}
 
+	storeDir := filepath.Join(tmpDir, "store")
+	storeSink, err := store.Open(storeDir, store.Options{})
+	if err != nil {
+		t.Fatalf("failed to create test store sink: %v", err)
+	}
+	defer storeSink.Close()
+
+	syslogSink, err := netconsoled.SyslogSink(netconsoled.SyslogConfig{
+		Network: "tcp",
+		Addr:    "localhost:514",
+		Format:  netconsoled.SyslogRFC3164,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test syslog sink: %v", err)
+	}
+
+	journaldSink, err := netconsoled.JournaldSink(netconsoled.JournaldConfig{})
+	if err != nil {
+		t.Fatalf("failed to create test journald sink: %v", err)
+	}
+
+	lokiSink, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL:      "http://localhost:3100",
+		Encoding: netconsoled.LokiGzip,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test loki sink: %v", err)
+	}
+
+	esSink, err := netconsoled.ElasticsearchSink(netconsoled.ElasticsearchConfig{
+		URL: "http://localhost:9200",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test elasticsearch sink: %v", err)
+	}
+
+	otlpSink, err := netconsoled.OTLPSink(netconsoled.OTLPConfig{
+		URL: "http://localhost:4318",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test otlp sink: %v", err)
+	}
+
+	webhookSink, err := netconsoled.WebhookSink(netconsoled.WebhookConfig{
+		URL:    "https://hooks.example.com/foo",
+		Method: "PUT",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test webhook sink: %v", err)
+	}
+
+	amSink, err := netconsoled.AlertmanagerSink(netconsoled.AlertmanagerConfig{
+		URL: "http://localhost:9093",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test alertmanager sink: %v", err)
+	}
+
+	emailSink, err := netconsoled.EmailSink(netconsoled.EmailConfig{
+		Addr: "smtp.example.com:587",
+		From: "netconsoled@example.com",
+		To:   []string{"ops@example.com", "kernel@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create test email sink: %v", err)
+	}
+	defer emailSink.(io.Closer).Close()
+
+	execSink, err := netconsoled.ExecSink(netconsoled.ExecConfig{
+		Command: []string{"logger", "-t", "netconsoled"},
+		Format:  netconsoled.ExecJSON,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test exec sink: %v", err)
+	}
+
+	execEventSink, err := netconsoled.ExecEventSink(netconsoled.ExecConfig{
+		Command: []string{"/usr/local/bin/crash-triage"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create test exec event sink: %v", err)
+	}
+
+	relaySink, err := netconsoled.RelaySink(netconsoled.RelayConfig{
+		Network: "tls",
+		Addr:    "central.example.com:6667",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test relay sink: %v", err)
+	}
+	defer relaySink.(io.Closer).Close()
+
+	udpSink, err := netconsoled.UDPSink(netconsoled.UDPConfig{
+		Addrs:        []string{"127.0.0.1:6666", "127.0.0.1:6667"},
+		StripElapsed: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create test udp sink: %v", err)
+	}
+	defer udpSink.(io.Closer).Close()
+
+	// Close the spool immediately so the parsed spool can open its directory.
+	// The wrapped Sink hides Close, so that closing the spool does not close
+	// stdout for the rest of the tests.
+	spoolDir := filepath.Join(tmpDir, "spool")
+	stdoutSink := struct{ netconsoled.Sink }{netconsoled.StdoutSink()}
+	spoolSink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{Dir: spoolDir}, stdoutSink)
+	if err != nil {
+		t.Fatalf("failed to create test spool sink: %v", err)
+	}
+	_ = spoolSink.(io.Closer).Close()
+
+	failoverSink, err := netconsoled.FailoverSink(netconsoled.FailoverConfig{}, relaySink, fileSink)
+	if err != nil {
+		t.Fatalf("failed to create test failover sink: %v", err)
+	}
+
+	deadLetterFile := filepath.Join(tmpDir, "deadletter.json")
+	deadLetterSink, err := netconsoled.FileDeadLetterSink(deadLetterFile)
+	if err != nil {
+		t.Fatalf("failed to create test dead-letter sink: %v", err)
+	}
+	defer deadLetterSink.(io.Closer).Close()
+
 	tests := []struct {
 		name string
 		b    []byte
@@ -47,61 +175,1054 @@ func TestParse(t *testing.T) {
 		ok   bool
 	}{
 		{
-			name: "empty server UDP",
+			name: "empty server UDP",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+			`)),
+		},
+		{
+			name: "bad server UDP",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :foo
+			`)),
+		},
+		{
+			name: "bad server HTTP",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  http_addr: :foo
+			`)),
+		},
+		{
+			name: "bad server syslog UDP",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  syslog_udp_addr: :foo
+			`)),
+		},
+		{
+			name: "bad server syslog TCP",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  syslog_tcp_addr: :foo
+			`)),
+		},
+		{
+			name: "server syslog listeners",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  syslog_udp_addr: :514
+  syslog_tcp_addr: :601
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr:       ":6666",
+					SyslogUDPAddr: ":514",
+					SyslogTCPAddr: ":601",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad server relay",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: :foo
+			`)),
+		},
+		{
+			name: "server relay without client authentication",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: :6667
+			`)),
+		},
+		{
+			name: "server relay TLS without client CA",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: :6667
+  relay_tls:
+    cert_file: /etc/netconsoled/cert.pem
+    key_file: /etc/netconsoled/key.pem
+			`)),
+		},
+		{
+			name: "server relay TLS without relay",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_tls:
+    cert_file: /etc/netconsoled/cert.pem
+    key_file: /etc/netconsoled/key.pem
+			`)),
+		},
+		{
+			name: "server relay TLS without certificate",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: :6667
+  relay_tls:
+    ca_file: /etc/netconsoled/ca.pem
+			`)),
+		},
+		{
+			name: "server relay TLS missing certificate",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: :6667
+  relay_tls:
+    cert_file: /nonexistent/cert.pem
+    key_file: /nonexistent/key.pem
+    ca_file: /nonexistent/ca.pem
+			`)),
+		},
+		{
+			name: "bad server sink timeout",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  sink_timeout: -1s
+			`)),
+		},
+		{
+			name: "server sink timeout",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  sink_timeout: 10s
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr:     ":6666",
+					SinkTimeout: 10 * time.Second,
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad server batch size",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  batch_size: -1
+			`)),
+		},
+		{
+			name: "bad server batch wait",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  batch_wait: -1s
+			`)),
+		},
+		{
+			name: "server batching",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  batch_size: 500
+  batch_wait: 5s
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr:   ":6666",
+					BatchSize: 500,
+					BatchWait: 5 * time.Second,
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad server expected host",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  expected_hosts:
+    - 192.168.1.1
+    - 192.168.1.1
+			`)),
+		},
+		{
+			name: "bad server expected host hostname",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  expected_hosts:
+    - foo.example.com
+			`)),
+		},
+		{
+			name: "bad server expected host IPv6",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  expected_hosts:
+    - 2001:db8:0::1
+			`)),
+		},
+		{
+			name: "bad server silence threshold",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  silence_threshold: 5m
+			`)),
+		},
+		{
+			name: "server expected hosts",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  expected_hosts:
+    - 192.168.1.1
+    - 192.168.1.2
+  silence_threshold: 5m
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr:          ":6666",
+					ExpectedHosts:    []string{"192.168.1.1", "192.168.1.2"},
+					SilenceThreshold: 5 * time.Minute,
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "server relay listener",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+  relay_addr: 127.0.0.1:6667
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr:   ":6666",
+					RelayAddr: "127.0.0.1:6667",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "bad filter",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+filters:
+  - type: noop
+  - type: bad
+			`)),
+		},
+		{
+			name: "bad sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: noop
+  - type: bad
+			`)),
+		},
+		{
+			name: "file sink, empty file",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: file
+			`)),
+		},
+		{
+			name: "memory sink, negative size",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: memory
+    size: -1
+			`)),
+		},
+		{
+			name: "multiple memory sinks",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: memory
+  - type: memory
+			`)),
+		},
+		{
+			name: "memory sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: memory
+    size: 100
+    per_host: true
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NewMemorySink(100, true),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "store sink, empty dir",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: store
+			`)),
+		},
+		{
+			name: "store sink",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: store
+    dir: %s
+    max_age: 720h
+    max_size: 1073741824
+			`, storeDir))),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					storeSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "syslog sink, bad network",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: syslog
+    network: foo
+    addr: localhost:514
+			`)),
+		},
+		{
+			name: "syslog sink, bad TLS CA file",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: syslog
+    network: tls
+    addr: localhost:6514
+    tls:
+      ca_file: /nonexistent/ca.pem
+			`)),
+		},
+		{
+			name: "syslog sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: syslog
+    network: tcp
+    addr: localhost:514
+    format: rfc3164
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					syslogSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "journald sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: journald
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					journaldSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "loki sink, bad encoding",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: loki
+    url: http://localhost:3100
+    encoding: foo
+			`)),
+		},
+		{
+			name: "loki sink, bad batch size",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: loki
+    url: http://localhost:3100
+    batch_size: -1
+			`)),
+		},
+		{
+			name: "stdout sink, batch size",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: stdout
+    batch_size: 10
+			`)),
+		},
+		{
+			name: "loki sink, unknown key",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: loki
+    url: http://localhost:3100
+    batchsize: 10
+			`)),
+		},
+		{
+			name: "loki sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: loki
+    url: http://localhost:3100
+    encoding: gzip
+    tenant_id: tenant
+    username: user
+    password: pass
+    pipeline: test
+    batch_size: 500
+    batch_wait: 2s
+    max_retries: 3
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					lokiSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "elasticsearch sink, bad index",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: elasticsearch
+    url: http://localhost:9200
+    index: "{{"
+			`)),
+		},
+		{
+			name: "elasticsearch sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: elasticsearch
+    url: http://localhost:9200
+    index: kernel-{{.Time.Format "2006.01"}}
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					esSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "otlp sink, bad URL",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: otlp
+    url: localhost:4318
+			`)),
+		},
+		{
+			name: "otlp sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: otlp
+    url: http://localhost:4318
+    headers:
+      Authorization: Bearer foo
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					otlpSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "webhook sink, bad body",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
+  udp_addr: :6666
+sinks:
+  - type: webhook
+    url: https://hooks.example.com/foo
+    body: "{{"
 			`)),
 		},
 		{
-			name: "bad server UDP",
+			name: "webhook sink, bad event",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
-  udp_addr: :foo
+  udp_addr: :6666
+sinks:
+  - type: webhook
+    url: https://hooks.example.com/foo
+    events:
+      - foo
 			`)),
 		},
 		{
-			name: "bad server HTTP",
+			name: "webhook sink",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
   udp_addr: :6666
-  http_addr: :foo
+sinks:
+  - type: webhook
+    url: https://hooks.example.com/foo
+    method: PUT
+    events:
+      - panic
+      - oops
+    batch_wait: 5s
+    rate_limit: 10s
 			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					webhookSink,
+				},
+			},
+			ok: true,
 		},
 		{
-			name: "bad filter",
+			name: "alertmanager sink, reserved label",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
   udp_addr: :6666
-filters:
-  - type: noop
-  - type: bad
+sinks:
+  - type: alertmanager
+    url: http://localhost:9093
+    labels:
+      host: foo
 			`)),
 		},
 		{
-			name: "bad sink",
+			name: "alertmanager sink",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
   udp_addr: :6666
 sinks:
-  - type: noop
-  - type: bad
+  - type: alertmanager
+    url: http://localhost:9093
+    events:
+      - panic
+      - lockup
+    labels:
+      severity: critical
+    resolve: 10m
 			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					amSink,
+				},
+			},
+			ok: true,
 		},
 		{
-			name: "file sink, empty file",
+			name: "email sink, no recipients",
 			b: []byte(strings.TrimSpace(`
 ---
 server:
   udp_addr: :6666
 sinks:
-  - type: file
+  - type: email
+    addr: smtp.example.com:587
+    from: netconsoled@example.com
+			`)),
+		},
+		{
+			name: "email sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: email
+    addr: smtp.example.com:587
+    from: netconsoled@example.com
+    to:
+      - ops@example.com
+      - kernel@example.com
+    username: foo
+    password: bar
+    require_tls: true
+    subject: "{{.Event}} on {{.Host}}"
+    interval: 5m
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					emailSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "exec sink, no command",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: exec
+			`)),
+		},
+		{
+			name: "exec sinks",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: exec
+    command: [logger, -t, netconsoled]
+    format: json
+  - type: exec
+    command: [/usr/local/bin/crash-triage]
+    per_event: true
+    events:
+      - panic
+    timeout: 5m
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					execSink,
+					execEventSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "relay sink, bad network",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: relay
+    network: udp
+    addr: central.example.com:6667
+			`)),
+		},
+		{
+			name: "relay sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: relay
+    network: tls
+    addr: central.example.com:6667
+    tls:
+      server_name: central.example.com
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					relaySink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "udp sink, no addresses",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: udp
+			`)),
+		},
+		{
+			name: "udp sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: udp
+    addr: 127.0.0.1:6666
+    addrs:
+      - 127.0.0.1:6667
+    strip_elapsed: true
+			`)),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					udpSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "spool sink, no wrapped sink",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: spool
+    dir: %s
+			`, spoolDir))),
+		},
+		{
+			name: "spool sink, bad wrapped sink",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: spool
+    dir: %s
+    sink:
+      type: file
+			`, spoolDir))),
+		},
+		{
+			name: "spool sink, bad segment size",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: spool
+    dir: %s
+    max_size: 1024
+    segment_size: 2048
+    sink:
+      type: file
+      file: %s
+			`, spoolDir, testFile.Name()))),
+		},
+		{
+			name: "spool sink",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: spool
+    dir: %s
+    max_size: 1048576
+    min_backoff: 1s
+    max_backoff: 5m
+    sink:
+      type: stdout
+			`, spoolDir))),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					spoolSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "failover sink, one sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: failover
+    sinks:
+      - type: stdout
+			`)),
+		},
+		{
+			name: "failover sink, bad sink",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: failover
+    sinks:
+      - type: stdout
+      - type: foo
+			`)),
+		},
+		{
+			name: "failover sink",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+sinks:
+  - type: failover
+    probe_interval: 1m
+    sinks:
+      - type: relay
+        network: tls
+        addr: central.example.com:6667
+      - type: file
+        file: %s
+			`, testFile.Name()))),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					failoverSink,
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "dead letter, bad type",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+dead_letter:
+  type: foo
+			`)),
+		},
+		{
+			name: "dead letter file, empty file",
+			b: []byte(strings.TrimSpace(`
+---
+server:
+  udp_addr: :6666
+dead_letter:
+  type: file
 			`)),
 		},
+		{
+			name: "dead letter file",
+			b: []byte(strings.TrimSpace(fmt.Sprintf(`
+---
+server:
+  udp_addr: :6666
+dead_letter:
+  type: file
+  file: %s
+			`, deadLetterFile))),
+			cfg: &config.Config{
+				Server: config.ServerConfig{
+					UDPAddr: ":6666",
+				},
+				Filters: []netconsoled.Filter{
+					netconsoled.NoopFilter(),
+				},
+				Sinks: []netconsoled.Sink{
+					netconsoled.NoopSink(),
+				},
+				DeadLetter: deadLetterSink,
+			},
+			ok: true,
+		},
 		{
 			name: "empty filters and sinks",
 			b: []byte(strings.TrimSpace(`
@@ -230,8 +1351,9 @@ sinks:
 		t.Run(tt.name, func(t *testing.T) {
 			cfg, err := config.Parse(tt.b)
 
-			// Ensure that the test YAML isn't malformed.
-			if err != nil && strings.Contains(err.Error(), "yaml") {
+			// Ensure that the test YAML isn't malformed.  Unknown keys are
+			// reported by the YAML parser, but are not malformed YAML.
+			if err != nil && strings.Contains(err.Error(), "yaml") && !strings.Contains(err.Error(), "not found in struct") {
 				t.Fatalf("malformed test YAML: %v", err)
 			}
 
@@ -251,6 +1373,7 @@ sinks:
 			opts := []cmp.Option{
 				cmp.Comparer(filterComparer),
 				cmp.Comparer(sinkComparer),
+				cmp.Comparer(deadLetterComparer),
 			}
 
 			if diff := cmp.Diff(tt.cfg, cfg, opts...); diff != "" {
@@ -265,3 +1388,11 @@ sinks:
 
 func filterComparer(x, y netconsoled.Filter) bool { return x.String() == y.String() }
 func sinkComparer(x, y netconsoled.Sink) bool     { return x.String() == y.String() }
+
+func deadLetterComparer(x, y netconsoled.DeadLetterSink) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+
+	return x.String() == y.String()
+}
@@ -0,0 +1,3 @@
+// Package record implements the on-disk record format shared by the
+// netconsoled spool and log store.
+package record
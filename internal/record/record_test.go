@@ -0,0 +1,154 @@
+package record_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled/internal/record"
+)
+
+func TestDecode(t *testing.T) {
+	in := record.Record{
+		Time:    1,
+		Addr:    "192.168.1.1:6666",
+		Elapsed: 2,
+		Boot:    3,
+		Message: "hello world",
+		Host:    "host",
+
+		Synthetic: "silent",
+	}
+
+	b, err := record.Encode(in)
+	if err != nil {
+		t.Fatalf("failed to encode record: %v", err)
+	}
+
+	corrupt := append([]byte(nil), b...)
+	corrupt[len(corrupt)-2] ^= 0xff
+
+	tests := []struct {
+		name string
+		b    []byte
+		r    record.Record
+		n    int
+		err  error
+		ok   bool
+	}{
+		{
+			name: "empty",
+			err:  io.EOF,
+		},
+		{
+			name: "partial header",
+			b:    b[:record.HeaderLen-1],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "partial payload",
+			b:    b[:len(b)-1],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "checksum mismatch",
+			b:    corrupt,
+		},
+		{
+			name: "OK",
+			b:    b,
+			r:    in,
+			n:    len(b),
+			ok:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, n, err := record.Decode(bytes.NewReader(tt.b))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to decode record: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				if tt.err != nil && err != tt.err {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return
+			}
+
+			if diff := cmp.Diff(tt.r, r); diff != "" {
+				t.Fatalf("unexpected record (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.n, n); diff != "" {
+				t.Fatalf("unexpected length (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netconsoled_record")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var b []byte
+	for _, m := range []string{"foo", "bar"} {
+		rb, err := record.Encode(record.Record{Message: m})
+		if err != nil {
+			t.Fatalf("failed to encode record: %v", err)
+		}
+
+		b = append(b, rb...)
+	}
+	size := int64(len(b))
+
+	// Simulate a record which was partially written before a crash.
+	b = append(b, 0, 0)
+
+	path := filepath.Join(dir, record.Name(1, ".seg"))
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+
+	var got []string
+	n, err := record.Load(path, true, func(r record.Record, _ int64) {
+		got = append(got, r.Message)
+	})
+	if err != nil {
+		t.Fatalf("failed to load segment: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"foo", "bar"}, got); diff != "" {
+		t.Fatalf("unexpected records (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(size, n); diff != "" {
+		t.Fatalf("unexpected size (-want +got):\n%s", diff)
+	}
+
+	// The partial record is removed.
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+	if diff := cmp.Diff(size, fi.Size()); diff != "" {
+		t.Fatalf("unexpected file size (-want +got):\n%s", diff)
+	}
+
+	ids, err := record.List(dir, ".seg")
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+	if diff := cmp.Diff([]uint64{1}, ids); diff != "" {
+		t.Fatalf("unexpected segments (-want +got):\n%s", diff)
+	}
+}
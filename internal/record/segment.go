@@ -0,0 +1,163 @@
+package record
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderLen is the length of a record header: the length of the record's
+	// payload, followed by a CRC32 checksum of the payload.
+	HeaderLen = 8
+
+	// MaxRecordLen bounds the size of a single record's payload.  netconsole
+	// logs are small, so anything larger indicates corruption.
+	MaxRecordLen = 1 << 20
+)
+
+// A Record is the on-disk representation of a single log.
+type Record struct {
+	// Time is the time the log was received, in Unix nanoseconds.
+	Time    int64  `json:"t"`
+	Addr    string `json:"a"`
+	Elapsed int64  `json:"e"`
+	Boot    int    `json:"b,omitempty"`
+	Message string `json:"m"`
+	Host    string `json:"h,omitempty"`
+
+	// Synthetic is the Event of a log produced by a Server rather than a
+	// host, if any.
+	Synthetic string `json:"s,omitempty"`
+}
+
+// Encode encodes r with its header.
+func Encode(r Record) ([]byte, error) {
+	pb, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pb) > MaxRecordLen {
+		return nil, fmt.Errorf("record is too large: %d bytes", len(pb))
+	}
+
+	b := make([]byte, HeaderLen+len(pb))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(pb)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(pb))
+	copy(b[HeaderLen:], pb)
+
+	return b, nil
+}
+
+// Decode decodes a single record from r, returning the record and the
+// number of bytes read.  io.EOF is returned only if r contains no more data.
+func Decode(r io.Reader) (Record, int, error) {
+	var hdr [HeaderLen]byte
+	if n, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return Record{}, 0, io.EOF
+		}
+
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+
+	n := binary.BigEndian.Uint32(hdr[0:4])
+	if n > MaxRecordLen {
+		return Record{}, 0, fmt.Errorf("record length %d is too large", n)
+	}
+
+	pb := make([]byte, n)
+	if _, err := io.ReadFull(r, pb); err != nil {
+		return Record{}, 0, io.ErrUnexpectedEOF
+	}
+
+	if crc32.ChecksumIEEE(pb) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return Record{}, 0, errors.New("record checksum mismatch")
+	}
+
+	var rec Record
+	if err := json.Unmarshal(pb, &rec); err != nil {
+		return Record{}, 0, err
+	}
+
+	return rec, HeaderLen + int(n), nil
+}
+
+// Name returns the file name for segment id with the file extension ext.
+func Name(id uint64, ext string) string {
+	return fmt.Sprintf("%020d%s", id, ext)
+}
+
+// List returns the IDs of the segment files in dir with the file extension
+// ext, in ascending order.
+func List(dir, ext string) ([]uint64, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint64
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || filepath.Ext(name) != ext {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			// Not one of our files.
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Load calls fn with each record in the segment file at path and its
+// offset, and returns the size of the records read.  If repair is true and
+// the file ends with a partially written record, the file is truncated to
+// remove it.
+func Load(path string, repair bool, fn func(r Record, off int64)) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		size int64
+		br   = bufio.NewReader(f)
+	)
+
+	for {
+		r, n, err := Decode(br)
+		if err != nil {
+			// Anything other than a clean end of file indicates a partial
+			// or corrupt record; discard it and everything after it.
+			if err != io.EOF && repair {
+				if err := os.Truncate(path, size); err != nil {
+					return 0, err
+				}
+			}
+
+			return size, nil
+		}
+
+		fn(r, size)
+		size += int64(n)
+	}
+}
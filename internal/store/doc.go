@@ -0,0 +1,2 @@
+// Package store implements an embedded, persistent log store for netconsoled.
+package store
@@ -0,0 +1,624 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+	"github.com/mdlayher/netconsoled/internal/record"
+)
+
+const (
+	// segmentExt is the file extension used for segment files.
+	segmentExt = ".seg"
+
+	// retentionInterval is the minimum interval between retention checks
+	// when storing logs.
+	retentionInterval = 1 * time.Minute
+)
+
+// DefaultSegmentSize is the default maximum size of a segment file.
+const DefaultSegmentSize = 64 << 20
+
+// Options configures a Store.
+type Options struct {
+	// SegmentSize is the size at which the active segment file is sealed
+	// and a new one is created.  If zero, DefaultSegmentSize is used.
+	SegmentSize int64
+
+	// MaxAge and MaxSize limit the age and total size of stored logs.  The
+	// oldest segment files are deleted to enforce these limits.  If zero,
+	// no limit is enforced.
+	MaxAge  time.Duration
+	MaxSize int64
+
+	// ReadOnly opens a Store for queries only.  A read-only Store never
+	// modifies its directory, so it can be used while another process
+	// stores logs.
+	ReadOnly bool
+}
+
+// A Store is a netconsoled.Sink which persists logs to segment files in a
+// directory, and indexes them by host, time, and boot.
+//
+// Each record is prefixed with its length and checksum, so a partially
+// written record at the end of a segment is detected and discarded when the
+// Store is opened.
+type Store struct {
+	dir  string
+	opts Options
+
+	mu        sync.RWMutex
+	segs      []*segment
+	active    *os.File
+	boots     map[string]netconsoled.Boot
+	retention time.Time
+}
+
+var _ netconsoled.Sink = &Store{}
+
+// Open opens or creates a Store in dir.
+func Open(dir string, opts Options) (*Store, error) {
+	dir = filepath.Clean(dir)
+
+	if opts.SegmentSize == 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if opts.SegmentSize < 0 || opts.MaxAge < 0 || opts.MaxSize < 0 {
+		return nil, errors.New("store options must not be negative")
+	}
+
+	if !opts.ReadOnly {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Store{
+		dir:   dir,
+		opts:  opts,
+		boots: make(map[string]netconsoled.Boot),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if opts.ReadOnly {
+		return s, nil
+	}
+
+	if err := s.enforceRetention(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := s.openActive(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load indexes all existing segment files.
+func (s *Store) load() error {
+	ids, err := record.List(s.dir, segmentExt)
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		// Only the most recent segment file is appended to, so only it can
+		// end with a partially written record which must be repaired.
+		// Corruption in any other segment file is left in place.
+		repair := !s.opts.ReadOnly && i == len(ids)-1
+
+		seg, err := loadSegment(filepath.Join(s.dir, segmentName(id)), id, repair)
+		if err != nil {
+			return fmt.Errorf("failed to load segment %q: %v", segmentName(id), err)
+		}
+
+		s.segs = append(s.segs, seg)
+	}
+
+	// Recover the boot state of each host from its most recent log which
+	// was sent by the host, rather than synthesized on its behalf.
+	for _, seg := range s.segs {
+		for host, ies := range seg.hosts {
+			for i := len(ies) - 1; i >= 0; i-- {
+				if ies[i].synthetic {
+					continue
+				}
+
+				s.boots[host] = netconsoled.Boot{
+					N:       ies[i].boot,
+					Elapsed: ies[i].elapsed,
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// openActive opens the most recent segment file for appending, or creates
+// a new one if none exist or the most recent is full.
+func (s *Store) openActive() error {
+	if len(s.segs) == 0 || s.segs[len(s.segs)-1].size >= s.opts.SegmentSize {
+		var id uint64
+		if len(s.segs) > 0 {
+			id = s.segs[len(s.segs)-1].id + 1
+		}
+
+		s.segs = append(s.segs, newSegment(filepath.Join(s.dir, segmentName(id)), id))
+	}
+
+	seg := s.segs[len(s.segs)-1]
+
+	f, err := os.OpenFile(seg.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.active = f
+	return nil
+}
+
+// Close flushes and closes the active segment file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return nil
+	}
+
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// Store appends a log to the active segment file.
+func (s *Store) Store(d netconsoled.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return errors.New("store is not open for writing")
+	}
+
+	if d.Time.IsZero() {
+		d.Time = time.Now()
+	}
+
+	host := d.Host()
+
+	// The host's boot is only updated once the log has been written.
+	// Synthetic logs do not report the elapsed time since boot, so they
+	// belong to the host's current boot.
+	b := s.boots[host]
+	if d.Synthetic == netconsoled.EventNone {
+		b, _ = b.Next(d.Log.Elapsed)
+	}
+
+	r := Record{
+		Data: d,
+		Boot: b.N,
+	}
+
+	buf, err := encodeRecord(r)
+	if err != nil {
+		return err
+	}
+
+	seg := s.segs[len(s.segs)-1]
+	if _, err := s.active.Write(buf); err != nil {
+		// Remove any partially written record so that later records are
+		// written at the offsets recorded in the index.
+		if terr := s.active.Truncate(seg.size); terr != nil {
+			return fmt.Errorf("failed to write record: %v, and failed to remove partial record: %v", err, terr)
+		}
+
+		return err
+	}
+
+	s.boots[host] = b
+
+	seg.index(host, indexEntry{
+		off:       seg.size,
+		time:      d.Time.UnixNano(),
+		boot:      b.N,
+		elapsed:   d.Log.Elapsed,
+		synthetic: d.Synthetic != netconsoled.EventNone,
+	})
+	seg.size += int64(len(buf))
+
+	if seg.size >= s.opts.SegmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+
+	if d.Time.Sub(s.retention) >= retentionInterval {
+		s.retention = d.Time
+		return s.enforceRetention(d.Time)
+	}
+
+	return nil
+}
+
+// roll seals the active segment file and starts a new one.
+func (s *Store) roll() error {
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+	if err := s.active.Close(); err != nil {
+		return err
+	}
+
+	if err := s.openActive(); err != nil {
+		return err
+	}
+
+	return s.enforceRetention(time.Now())
+}
+
+// enforceRetention deletes the oldest segment files until the Store's age
+// and size limits are met.  The most recent segment file is never deleted.
+func (s *Store) enforceRetention(now time.Time) error {
+	var size int64
+	for _, seg := range s.segs {
+		size += seg.size
+	}
+
+	for len(s.segs) > 1 {
+		seg := s.segs[0]
+
+		old := s.opts.MaxAge > 0 && seg.maxTime > 0 &&
+			now.Sub(time.Unix(0, seg.maxTime)) > s.opts.MaxAge
+		big := s.opts.MaxSize > 0 && size > s.opts.MaxSize
+
+		if !old && !big {
+			break
+		}
+
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		size -= seg.size
+		s.segs = s.segs[1:]
+	}
+
+	return nil
+}
+
+func (s *Store) String() string { return fmt.Sprintf("store: %q", s.dir) }
+
+// A Query selects logs from a Store.
+type Query struct {
+	netconsoled.Query
+
+	// Boot selects logs from a single boot of a host, numbered from 1.
+	// Boot is only meaningful when Host is also set.
+	Boot int
+}
+
+// A Record is a log retrieved from a Store.
+type Record struct {
+	netconsoled.Data
+
+	// Boot is the boot of the host which produced the log, numbered from 1.
+	Boot int
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Record) MarshalJSON() ([]byte, error) {
+	b, err := r.Data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	// Append the boot field to the JSON object produced for r.Data.
+	b = b[:len(b)-1]
+	return append(b, fmt.Sprintf(`,"boot":%d}`, r.Boot)...), nil
+}
+
+// Query returns the logs selected by q, ordered from oldest to newest.
+func (s *Store) Query(q Query) ([]Record, error) {
+	// Only consult the index while holding the lock, so that slow reads do
+	// not block logs from being stored.
+	reads := s.lookup(q)
+
+	var out []Record
+	for _, rd := range reads {
+		rs, err := rd.seg.read(rd.offs)
+		if err != nil {
+			// The segment file may have been deleted to enforce retention
+			// since the index was consulted.
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, r := range rs {
+			if q.Matches(r.Data) {
+				out = append(out, r)
+			}
+		}
+	}
+
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+
+	return out, nil
+}
+
+// A segmentRead is a set of records to read from a segment file.
+type segmentRead struct {
+	seg  *segment
+	offs []int64
+}
+
+// lookup consults the index to find the records which may be selected by q.
+func (s *Store) lookup(q Query) []segmentRead {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var since, until int64
+	if !q.Since.IsZero() {
+		since = q.Since.UnixNano()
+	}
+	if !q.Until.IsZero() {
+		until = q.Until.UnixNano()
+	}
+
+	var reads []segmentRead
+	for _, seg := range s.segs {
+		// Skip segments which cannot possibly contain matching logs.
+		if since != 0 && seg.maxTime < since {
+			continue
+		}
+		if until != 0 && seg.minTime > until {
+			continue
+		}
+
+		var ies []indexEntry
+		if q.Host != "" {
+			ies = seg.hosts[q.Host]
+		} else {
+			for _, hies := range seg.hosts {
+				ies = append(ies, hies...)
+			}
+
+			sort.Slice(ies, func(i, j int) bool {
+				return ies[i].off < ies[j].off
+			})
+		}
+
+		// Consult the index before reading any records.
+		var offs []int64
+		for _, ie := range ies {
+			if (since != 0 && ie.time < since) || (until != 0 && ie.time > until) {
+				continue
+			}
+			if q.Boot != 0 && ie.boot != q.Boot {
+				continue
+			}
+
+			offs = append(offs, ie.off)
+		}
+
+		if len(offs) == 0 {
+			continue
+		}
+
+		reads = append(reads, segmentRead{
+			seg:  seg,
+			offs: offs,
+		})
+	}
+
+	return reads
+}
+
+// ServeHTTP serves logs selected by a Query as a JSON array.  The query
+// parameters accepted are the same as those for a netconsoled.MemorySink,
+// with the addition of "boot".
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rs, err := s.Query(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to query store: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if rs == nil {
+		// Always return an array, even if empty.
+		rs = []Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rs)
+}
+
+// ParseQuery parses a Query from URL query parameters.  Relative times are
+// computed using now.
+func ParseQuery(v url.Values, now time.Time) (Query, error) {
+	nq, err := netconsoled.ParseQuery(v, now)
+	if err != nil {
+		return Query{}, err
+	}
+
+	q := Query{Query: nq}
+
+	if b := v.Get("boot"); b != "" {
+		if q.Boot, err = strconv.Atoi(b); err != nil || q.Boot < 0 {
+			return Query{}, fmt.Errorf("invalid boot parameter: %q", b)
+		}
+	}
+
+	return q, nil
+}
+
+// A segment is the index of a single segment file.
+type segment struct {
+	id   uint64
+	path string
+	size int64
+
+	// Range of log receive times in the segment, in Unix nanoseconds.
+	minTime, maxTime int64
+
+	hosts map[string][]indexEntry
+}
+
+// An indexEntry locates a single record in a segment.
+type indexEntry struct {
+	off       int64
+	time      int64
+	boot      int
+	elapsed   time.Duration
+	synthetic bool
+}
+
+// segmentName returns the file name for segment id.
+func segmentName(id uint64) string {
+	return record.Name(id, segmentExt)
+}
+
+// newSegment creates an empty segment.
+func newSegment(path string, id uint64) *segment {
+	return &segment{
+		id:    id,
+		path:  path,
+		hosts: make(map[string][]indexEntry),
+	}
+}
+
+// loadSegment indexes the segment file at path.  If repair is true and the
+// file ends with a partially written record, the file is truncated to
+// remove it.
+func loadSegment(path string, id uint64, repair bool) (*segment, error) {
+	seg := newSegment(path, id)
+
+	size, err := record.Load(path, repair, func(sr record.Record, off int64) {
+		r := decodeRecord(sr)
+		seg.index(r.Host(), indexEntry{
+			off:       off,
+			time:      r.Time.UnixNano(),
+			boot:      r.Boot,
+			elapsed:   r.Log.Elapsed,
+			synthetic: r.Synthetic != netconsoled.EventNone,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seg.size = size
+	return seg, nil
+}
+
+// index adds an entry to the segment's index.
+func (seg *segment) index(host string, ie indexEntry) {
+	if seg.minTime == 0 || ie.time < seg.minTime {
+		seg.minTime = ie.time
+	}
+	if ie.time > seg.maxTime {
+		seg.maxTime = ie.time
+	}
+
+	seg.hosts[host] = append(seg.hosts[host], ie)
+}
+
+// read reads the records at the specified offsets.
+func (seg *segment) read(offs []int64) ([]Record, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rs := make([]Record, 0, len(offs))
+	for _, off := range offs {
+		sr, _, err := record.Decode(io.NewSectionReader(f, off, record.HeaderLen+record.MaxRecordLen))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record at offset %d in %q: %v", off, seg.path, err)
+		}
+
+		rs = append(rs, decodeRecord(sr))
+	}
+
+	return rs, nil
+}
+
+// encodeRecord encodes r with its header.
+func encodeRecord(r Record) ([]byte, error) {
+	var addr string
+	if r.Addr != nil {
+		addr = r.Addr.String()
+	}
+
+	return record.Encode(record.Record{
+		Time:    r.Time.UnixNano(),
+		Addr:    addr,
+		Elapsed: int64(r.Log.Elapsed),
+		Boot:    r.Boot,
+		Message: r.Log.Message,
+		Host:    r.Hostname,
+
+		Synthetic: string(r.Synthetic),
+	})
+}
+
+// decodeRecord converts a segment record into a Record.
+func decodeRecord(sr record.Record) Record {
+	r := Record{
+		Data: netconsoled.Data{
+			Log: netconsole.Log{
+				Elapsed: time.Duration(sr.Elapsed),
+				Message: sr.Message,
+			},
+			Time:      time.Unix(0, sr.Time),
+			Hostname:  sr.Host,
+			Synthetic: netconsoled.Event(sr.Synthetic),
+		},
+		Boot: sr.Boot,
+	}
+
+	if sr.Addr != "" {
+		r.Addr = addr(sr.Addr)
+	}
+
+	return r
+}
+
+// An addr is a net.Addr for a stored UDP address.
+type addr string
+
+func (a addr) Network() string { return "udp" }
+func (a addr) String() string  { return string(a) }
@@ -0,0 +1,367 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+	"github.com/mdlayher/netconsoled/internal/store"
+)
+
+func TestStoreQuery(t *testing.T) {
+	dir, done := testDir(t)
+	defer done()
+
+	s := testOpen(t, dir, store.Options{})
+
+	start := time.Unix(1000, 0)
+	logs := []netconsoled.Data{
+		testData(start, 1, 1*time.Second, "hello world"),
+		testData(start.Add(1*time.Second), 2, 1*time.Second, "hello world"),
+		testData(start.Add(2*time.Second), 1, 2*time.Second, "kernel panic"),
+		// Host 1 reboots.
+		testData(start.Add(3*time.Second), 1, 1*time.Second, "hello again"),
+	}
+
+	for _, d := range logs {
+		if err := s.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		q     store.Query
+		boots []int
+		want  []netconsoled.Data
+	}{
+		{
+			name:  "all",
+			boots: []int{1, 1, 1, 2},
+			want:  logs,
+		},
+		{
+			name: "host",
+			q: store.Query{
+				Query: netconsoled.Query{Host: "192.168.1.1"},
+			},
+			boots: []int{1, 1, 2},
+			want:  []netconsoled.Data{logs[0], logs[2], logs[3]},
+		},
+		{
+			name: "host boot",
+			q: store.Query{
+				Query: netconsoled.Query{Host: "192.168.1.1"},
+				Boot:  1,
+			},
+			boots: []int{1, 1},
+			want:  []netconsoled.Data{logs[0], logs[2]},
+		},
+		{
+			name: "time range",
+			q: store.Query{
+				Query: netconsoled.Query{
+					Since: start.Add(1 * time.Second),
+					Until: start.Add(2 * time.Second),
+				},
+			},
+			boots: []int{1, 1},
+			want:  logs[1:3],
+		},
+	}
+
+	// Run each test against the open store, and again after it is closed and
+	// reopened read-only to verify that the index is rebuilt from disk.
+	for _, reopen := range []bool{false, true} {
+		if reopen {
+			if err := s.Close(); err != nil {
+				t.Fatalf("failed to close store: %v", err)
+			}
+
+			s = testOpen(t, dir, store.Options{ReadOnly: true})
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rs, err := s.Query(tt.q)
+				if err != nil {
+					t.Fatalf("failed to query: %v", err)
+				}
+
+				var (
+					boots []int
+					got   []netconsoled.Data
+				)
+
+				for _, r := range rs {
+					boots = append(boots, r.Boot)
+					got = append(got, r.Data)
+				}
+
+				if diff := cmp.Diff(tt.boots, boots); diff != "" {
+					t.Fatalf("unexpected boots (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(tt.want, got, cmp.Comparer(dataComparer)); diff != "" {
+					t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestStoreRecoverPartialRecord(t *testing.T) {
+	dir, done := testDir(t)
+	defer done()
+
+	s := testOpen(t, dir, store.Options{})
+
+	now := time.Unix(1000, 0)
+	if err := s.Store(testData(now, 1, 2*time.Second, "hello world")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("unexpected segment files: %v, %v", files, err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	_, _ = f.Write([]byte{0x00, 0x00, 0x01})
+	_ = f.Close()
+
+	s = testOpen(t, dir, store.Options{})
+	defer s.Close()
+
+	// The partial record is discarded, and the host's boot state is
+	// recovered so that this log is detected as a reboot.
+	d := testData(now.Add(1*time.Second), 1, 1*time.Second, "hello again")
+	if err := s.Store(d); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	rs, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if len(rs) != 2 {
+		t.Fatalf("unexpected number of records: %d", len(rs))
+	}
+
+	if diff := cmp.Diff(2, rs[1].Boot); diff != "" {
+		t.Fatalf("unexpected boot (-want +got):\n%s", diff)
+	}
+}
+
+func TestStoreSynthetic(t *testing.T) {
+	dir, done := testDir(t)
+	defer done()
+
+	s := testOpen(t, dir, store.Options{})
+
+	now := time.Unix(1000, 0)
+	silent := testData(now.Add(1*time.Second), 1, 0, "netconsoled: host 192.168.1.1 has been silent for 1s")
+	silent.Synthetic = netconsoled.EventSilent
+
+	for _, d := range []netconsoled.Data{
+		testData(now, 1, 2*time.Second, "hello world"),
+		silent,
+	} {
+		if err := s.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	s = testOpen(t, dir, store.Options{})
+	defer s.Close()
+
+	// Neither the synthetic log nor the boot state recovered after it is
+	// detected as a reboot.
+	d := testData(now.Add(2*time.Second), 1, 3*time.Second, "hello again")
+	if err := s.Store(d); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	rs, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	var (
+		boots []int
+		got   []netconsoled.Data
+	)
+
+	for _, r := range rs {
+		boots = append(boots, r.Boot)
+		got = append(got, r.Data)
+	}
+
+	if diff := cmp.Diff([]int{1, 1, 1}, boots); diff != "" {
+		t.Fatalf("unexpected boots (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(silent, got[1], cmp.Comparer(dataComparer)); diff != "" {
+		t.Fatalf("unexpected synthetic log (-want +got):\n%s", diff)
+	}
+}
+
+func TestStoreCorruptSealedSegment(t *testing.T) {
+	dir, done := testDir(t)
+	defer done()
+
+	// Roll segments after every log.
+	s := testOpen(t, dir, store.Options{SegmentSize: 1})
+
+	now := time.Unix(1000, 0)
+	for i := 0; i < 2; i++ {
+		d := testData(now.Add(time.Duration(i)*time.Second), 1, time.Duration(i+1)*time.Second, "hello world")
+		if err := s.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close store: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil || len(files) < 2 {
+		t.Fatalf("unexpected segment files: %v, %v", files, err)
+	}
+
+	// Corrupt the end of the oldest, sealed segment.
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	_, _ = f.Write([]byte{0x00, 0x00, 0x01})
+	_ = f.Close()
+
+	before, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	s = testOpen(t, dir, store.Options{SegmentSize: 1})
+	defer s.Close()
+
+	// Only the active segment is repaired, so the sealed segment is left
+	// as-is, but its valid records can still be queried.
+	after, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	if diff := cmp.Diff(before.Size(), after.Size()); diff != "" {
+		t.Fatalf("unexpected sealed segment size (-want +got):\n%s", diff)
+	}
+
+	rs, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(rs)); diff != "" {
+		t.Fatalf("unexpected number of records (-want +got):\n%s", diff)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir, done := testDir(t)
+	defer done()
+
+	// Roll segments after every log, and keep only about two of them.
+	s := testOpen(t, dir, store.Options{
+		SegmentSize: 1,
+		MaxSize:     200,
+	})
+	defer s.Close()
+
+	now := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		d := testData(now.Add(time.Duration(i)*time.Second), 1, time.Duration(i)*time.Second, "hello world")
+		if err := s.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	rs, err := s.Query(store.Query{})
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if len(rs) == 0 || len(rs) > 3 {
+		t.Fatalf("unexpected number of records after retention: %d", len(rs))
+	}
+
+	// Only the most recent logs are retained.
+	if diff := cmp.Diff(9*time.Second, rs[len(rs)-1].Log.Elapsed); diff != "" {
+		t.Fatalf("unexpected most recent log (-want +got):\n%s", diff)
+	}
+}
+
+func testDir(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "netconsoled_store")
+	if err != nil {
+		t.Fatalf("failed to create test directory: %v", err)
+	}
+
+	return dir, func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatalf("failed to clean up test directory %q: %v", dir, err)
+		}
+	}
+}
+
+func testOpen(t *testing.T, dir string, opts store.Options) *store.Store {
+	t.Helper()
+
+	s, err := store.Open(dir, opts)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	return s
+}
+
+func testData(now time.Time, host byte, elapsed time.Duration, msg string) netconsoled.Data {
+	return netconsoled.Data{
+		Addr: &net.UDPAddr{
+			IP:   net.IPv4(192, 168, 1, host),
+			Port: 6666,
+		},
+		Log: netconsole.Log{
+			Elapsed: elapsed,
+			Message: msg,
+		},
+		Time: now,
+	}
+}
+
+// dataComparer compares Data by value, since addresses read from the store
+// are not the same type as those which were stored.
+func dataComparer(x, y netconsoled.Data) bool {
+	return x.Addr.String() == y.Addr.String() &&
+		x.Log == y.Log &&
+		x.Time.Equal(y.Time) &&
+		x.Synthetic == y.Synthetic
+}
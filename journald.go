@@ -0,0 +1,76 @@
+package netconsoled
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultJournaldPath is the path of the systemd journal's native
+// protocol socket.
+const DefaultJournaldPath = "/run/systemd/journal/socket"
+
+// A JournaldConfig configures a journald Sink.
+type JournaldConfig struct {
+	// Path is the path of the journal's native protocol socket.  If empty,
+	// DefaultJournaldPath is used.
+	Path string
+
+	// Identifier is the SYSLOG_IDENTIFIER of each entry.  If empty,
+	// "kernel" is used.
+	Identifier string
+}
+
+// withDefaults returns a copy of cfg with default values applied.
+func (cfg JournaldConfig) withDefaults() JournaldConfig {
+	if cfg.Path == "" {
+		cfg.Path = DefaultJournaldPath
+	}
+
+	if cfg.Identifier == "" {
+		cfg.Identifier = "kernel"
+	}
+
+	return cfg
+}
+
+// journalEntry encodes d as a journal entry using the native protocol.
+func journalEntry(d Data, identifier string) []byte {
+	level, msg := ParseLevel(d.Log.Message)
+
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", msg)
+	journalField(&b, "PRIORITY", strconv.Itoa(int(level)))
+	journalField(&b, "SYSLOG_FACILITY", "0")
+	journalField(&b, "SYSLOG_IDENTIFIER", identifier)
+	journalField(&b, "NETCONSOLE_HOST", d.Host())
+	if d.Addr != nil {
+		journalField(&b, "NETCONSOLE_ADDR", d.Addr.String())
+	}
+	journalField(&b, "NETCONSOLE_ELAPSED", fmt.Sprintf("%f", d.Log.Elapsed.Seconds()))
+	if e := d.Event(); e != EventNone {
+		journalField(&b, "NETCONSOLE_EVENT", string(e))
+	}
+
+	return b.Bytes()
+}
+
+// journalField appends a single field to a journal entry.  Values which
+// contain newlines are encoded with an explicit length.
+func journalField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteString(key)
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
@@ -0,0 +1,194 @@
+package netconsoled
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// JournaldSink creates a Sink which writes logs to the systemd journal using
+// its native protocol.  Each entry contains the log's message and priority,
+// as well as fields describing its source host and elapsed time.
+//
+// Entries which are too large to send in a single datagram are written to
+// a sealed memfd, which is passed to the journal instead.
+func JournaldSink(cfg JournaldConfig) (Sink, error) {
+	return &journaldSink{
+		cfg: cfg.withDefaults(),
+	}, nil
+}
+
+var _ Sink = &journaldSink{}
+
+type journaldSink struct {
+	cfg JournaldConfig
+
+	mu sync.Mutex
+	c  *net.UnixConn
+}
+
+func (s *journaldSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.c == nil {
+		return nil
+	}
+
+	err := s.c.Close()
+	s.c = nil
+	return err
+}
+
+func (s *journaldSink) Store(d Data) error {
+	b := journalEntry(d, s.cfg.Identifier)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// If the journal was restarted, its socket must be dialed again.
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.c == nil {
+			s.c, err = net.DialUnix("unixgram", nil, &net.UnixAddr{
+				Name: s.cfg.Path,
+				Net:  "unixgram",
+			})
+			if err != nil {
+				return fmt.Errorf("failed to connect to journal %q: %v", s.cfg.Path, err)
+			}
+		}
+
+		if err = s.send(b); err == nil {
+			return nil
+		}
+
+		_ = s.c.Close()
+		s.c = nil
+	}
+
+	return fmt.Errorf("failed to send log to journal %q: %v", s.cfg.Path, err)
+}
+
+func (s *journaldSink) String() string {
+	return fmt.Sprintf("journald: %q", s.cfg.Path)
+}
+
+// send sends a single journal entry.  The caller must hold s.mu.
+func (s *journaldSink) send(b []byte) error {
+	_, err := s.c.Write(b)
+	if !isErrno(err, syscall.EMSGSIZE, syscall.ENOBUFS) {
+		return err
+	}
+
+	// The entry is too large for a single datagram.
+	f, err := journalMemfd(b)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// WriteMsgUnix cannot be used with a connected datagram socket, so the
+	// file descriptor is sent directly.
+	rc, err := s.c.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	oob := syscall.UnixRights(int(f.Fd()))
+	werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, oob, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+
+	return os.NewSyscallError("sendmsg", err)
+}
+
+// Constants used to create sealed memfds, from <linux/memfd.h> and
+// <linux/fcntl.h>.
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1024 + 9
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8
+)
+
+// memfdJournalName is the name of memfds passed to the journal.
+const memfdJournalName = "netconsoled-journal"
+
+// journalMemfd creates a sealed memfd containing b.
+func journalMemfd(b []byte) (*os.File, error) {
+	nr, ok := sysMemfdCreate[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("memfd_create is not supported on %s", runtime.GOARCH)
+	}
+
+	name, err := syscall.BytePtrFromString(memfdJournalName)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, _, errno := syscall.Syscall(nr, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("memfd_create", errno)
+	}
+
+	f := os.NewFile(fd, memfdJournalName)
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// The journal only accepts memfds which cannot be modified.
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealAll); errno != 0 {
+		_ = f.Close()
+		return nil, os.NewSyscallError("fcntl", errno)
+	}
+
+	return f, nil
+}
+
+// sysMemfdCreate maps architectures to their memfd_create system call
+// numbers, which are not provided by package syscall.
+var sysMemfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+	"mips64":   5314,
+	"mips64le": 5314,
+}
+
+// isErrno determines if err was caused by one of errnos.
+func isErrno(err error, errnos ...syscall.Errno) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+
+	errno, ok := err.(syscall.Errno)
+	if !ok {
+		return false
+	}
+
+	for _, e := range errnos {
+		if errno == e {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,211 @@
+package netconsoled_test
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestJournaldSink(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want map[string]string
+	}{
+		{
+			name: "simple",
+			msg:  "<3>hello world",
+			want: map[string]string{
+				"MESSAGE":            "hello world",
+				"PRIORITY":           "3",
+				"SYSLOG_FACILITY":    "0",
+				"SYSLOG_IDENTIFIER":  "kernel",
+				"NETCONSOLE_HOST":    "192.168.1.1",
+				"NETCONSOLE_ADDR":    "192.168.1.1:6666",
+				"NETCONSOLE_ELAPSED": "1.500000",
+			},
+		},
+		{
+			name: "multiline event",
+			msg:  "Kernel panic - not syncing: foo\nbar",
+			want: map[string]string{
+				"MESSAGE":            "Kernel panic - not syncing: foo\nbar",
+				"PRIORITY":           "6",
+				"SYSLOG_FACILITY":    "0",
+				"SYSLOG_IDENTIFIER":  "kernel",
+				"NETCONSOLE_HOST":    "192.168.1.1",
+				"NETCONSOLE_ADDR":    "192.168.1.1:6666",
+				"NETCONSOLE_ELAPSED": "1.500000",
+				"NETCONSOLE_EVENT":   "panic",
+			},
+		},
+		{
+			// Larger than the maximum datagram size, so a memfd must be used.
+			name: "oversized",
+			msg:  strings.Repeat("a", 256*1024),
+			want: map[string]string{
+				"MESSAGE":            strings.Repeat("a", 256*1024),
+				"PRIORITY":           "6",
+				"SYSLOG_FACILITY":    "0",
+				"SYSLOG_IDENTIFIER":  "kernel",
+				"NETCONSOLE_HOST":    "192.168.1.1",
+				"NETCONSOLE_ADDR":    "192.168.1.1:6666",
+				"NETCONSOLE_ELAPSED": "1.500000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, path, done := testJournal(t)
+			defer done()
+
+			sink, err := netconsoled.JournaldSink(netconsoled.JournaldConfig{
+				Path: path,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+			defer sink.(io.Closer).Close()
+
+			errC := make(chan error, 1)
+			go func() {
+				errC <- sink.Store(netconsoled.Data{
+					Addr: &net.UDPAddr{
+						IP:   net.IPv4(192, 168, 1, 1),
+						Port: 6666,
+					},
+					Log: netconsole.Log{
+						Elapsed: 1500 * time.Millisecond,
+						Message: tt.msg,
+					},
+				})
+			}()
+
+			got := readJournalEntry(t, c)
+			if err := <-errC; err != nil {
+				t.Fatalf("failed to store log: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected entry (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJournaldSinkNoJournal(t *testing.T) {
+	sink, err := netconsoled.JournaldSink(netconsoled.JournaldConfig{
+		Path: "/nonexistent/journal/socket",
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	if err := sink.Store(netconsoled.Data{}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+// testJournal creates a unixgram socket which stands in for the journal.
+func testJournal(t *testing.T) (*net.UnixConn, string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "netconsoled-journald-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	path := filepath.Join(dir, "socket")
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{
+		Name: path,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		t.Fatalf("failed to listen unixgram: %v", err)
+	}
+
+	return c, path, func() {
+		_ = c.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// readJournalEntry reads and decodes a single journal entry, either sent
+// directly or passed using a file descriptor.
+func readJournalEntry(t *testing.T, c *net.UnixConn) map[string]string {
+	t.Helper()
+
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	b := make([]byte, 1024*1024)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := c.ReadMsgUnix(b, oob)
+	if err != nil {
+		t.Fatalf("failed to read entry: %v", err)
+	}
+	b = b[:n]
+
+	if oobn > 0 {
+		f := receiveFile(t, oob[:oobn])
+		defer f.Close()
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("failed to seek file: %v", err)
+		}
+
+		if b, err = ioutil.ReadAll(f); err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+	}
+
+	fields := make(map[string]string)
+	for len(b) > 0 {
+		i := strings.IndexAny(string(b), "=\n")
+		if i == -1 {
+			t.Fatalf("malformed entry: %q", string(b))
+		}
+
+		key := string(b[:i])
+		if b[i] == '=' {
+			b = b[i+1:]
+			j := strings.IndexByte(string(b), '\n')
+			fields[key], b = string(b[:j]), b[j+1:]
+			continue
+		}
+
+		b = b[i+1:]
+		l := int(binary.LittleEndian.Uint64(b[:8]))
+		fields[key], b = string(b[8:8+l]), b[8+l+1:]
+	}
+
+	return fields
+}
+
+// receiveFile parses a file descriptor from a socket control message.
+func receiveFile(t *testing.T, oob []byte) *os.File {
+	t.Helper()
+
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("failed to parse control messages: %v", err)
+	}
+
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("failed to parse file descriptors: %v", err)
+	}
+
+	return os.NewFile(uintptr(fds[0]), "journal")
+}
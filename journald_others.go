@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package netconsoled
+
+import (
+	"errors"
+)
+
+// JournaldSink creates a Sink which writes logs to the systemd journal using
+// its native protocol.  It is only supported on Linux.
+func JournaldSink(cfg JournaldConfig) (Sink, error) {
+	return nil, errors.New("journald sink is only supported on Linux")
+}
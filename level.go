@@ -0,0 +1,64 @@
+package netconsoled
+
+import (
+	"strconv"
+)
+
+// A Level is a kernel log level, as used by printk.  Levels are numerically
+// equivalent to syslog severities.
+type Level int
+
+// Possible Level values.
+const (
+	LevelEmerg Level = iota
+	LevelAlert
+	LevelCrit
+	LevelErr
+	LevelWarning
+	LevelNotice
+	LevelInfo
+	LevelDebug
+)
+
+// DefaultLevel is the Level assumed for logs which do not specify a Level.
+const DefaultLevel = LevelInfo
+
+func (l Level) String() string {
+	switch l {
+	case LevelEmerg:
+		return "emerg"
+	case LevelAlert:
+		return "alert"
+	case LevelCrit:
+		return "crit"
+	case LevelErr:
+		return "err"
+	case LevelWarning:
+		return "warning"
+	case LevelNotice:
+		return "notice"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	}
+
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// ParseLevel parses a kernel log level prefix, such as "<3>", from the
+// beginning of message.  It returns the Level and the message with the prefix
+// removed.  If message has no level prefix, DefaultLevel and the original
+// message are returned.
+func ParseLevel(message string) (Level, string) {
+	if len(message) < 3 || message[0] != '<' || message[2] != '>' {
+		return DefaultLevel, message
+	}
+
+	c := message[1]
+	if c < '0' || c > '7' {
+		return DefaultLevel, message
+	}
+
+	return Level(c - '0'), message[3:]
+}
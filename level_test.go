@@ -0,0 +1,55 @@
+package netconsoled_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in    string
+		level netconsoled.Level
+		msg   string
+	}{
+		{
+			in:    "hello world",
+			level: netconsoled.DefaultLevel,
+			msg:   "hello world",
+		},
+		{
+			in:    "<0>hello world",
+			level: netconsoled.LevelEmerg,
+			msg:   "hello world",
+		},
+		{
+			in:    "<4>hello world",
+			level: netconsoled.LevelWarning,
+			msg:   "hello world",
+		},
+		{
+			in:    "<8>hello world",
+			level: netconsoled.DefaultLevel,
+			msg:   "<8>hello world",
+		},
+		{
+			in:    "<>",
+			level: netconsoled.DefaultLevel,
+			msg:   "<>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			level, msg := netconsoled.ParseLevel(tt.in)
+
+			if diff := cmp.Diff(tt.level, level); diff != "" {
+				t.Fatalf("unexpected level (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.msg, msg); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package netconsoled
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loki push request encodings.
+const (
+	LokiJSON   = "json"
+	LokiGzip   = "gzip"
+	LokiSnappy = "snappy"
+)
+
+// lokiPushPath is the path of Loki's push API.
+const lokiPushPath = "/loki/api/v1/push"
+
+// A LokiConfig configures a Loki Sink.
+type LokiConfig struct {
+	// URL is the base URL of the Loki server.
+	URL string
+
+	// Encoding is the push request encoding: LokiJSON, LokiGzip for gzipped
+	// JSON, or LokiSnappy for snappy-compressed protocol buffers.  If empty,
+	// LokiSnappy is used, as with Loki's own clients.
+	Encoding string
+
+	// TenantID, if set, is sent as the X-Scope-OrgID header.
+	TenantID string
+
+	// Username and Password, if set, are sent using HTTP basic authentication.
+	Username string
+	Password string
+
+	// Pipeline, if set, is added as the "pipeline" label of each stream to
+	// identify this netconsoled server.
+	Pipeline string
+
+	// BatchSize is the maximum number of logs pushed in a single request.
+	// If zero, the Server's Batch.Size is used.
+	BatchSize int
+
+	// BatchWait is the maximum amount of time a log is buffered before it is
+	// pushed.  If zero, the Server's Batch.Wait is used.
+	BatchWait time.Duration
+
+	// MaxRetries is the number of times a failed push is retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, pushes are
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Client is the HTTP client used to push logs.  If nil, a client with
+	// a 10 second timeout is used.
+	Client *http.Client
+}
+
+// LokiSink creates a BatchSink which pushes logs to Grafana Loki.  Each batch
+// of logs is pushed in a single request, grouped into streams labeled by
+// host, pipeline, level, and event type.
+//
+// Pushes which fail due to network errors, rate limiting, or server errors
+// are retried with exponential backoff before an error is returned.
+func LokiSink(cfg LokiConfig) (BatchSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Loki URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Loki URL must use HTTP or HTTPS: %q", cfg.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + lokiPushPath
+
+	switch cfg.Encoding {
+	case "":
+		cfg.Encoding = LokiSnappy
+	case LokiJSON, LokiGzip, LokiSnappy:
+	default:
+		return nil, fmt.Errorf("unsupported Loki encoding: %q", cfg.Encoding)
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("Loki batch size must not be negative: %d", cfg.BatchSize)
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &lokiSink{
+		cfg:   cfg,
+		url:   u.String(),
+		name:  redactURL(u),
+		retry: newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+	}, nil
+}
+
+var (
+	_ BatchSink        = &lokiSink{}
+	_ contextBatchSink = &lokiSink{}
+)
+
+type lokiSink struct {
+	healthState
+
+	cfg   LokiConfig
+	url   string
+	name  string
+	retry retrier
+}
+
+func (s *lokiSink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+func (s *lokiSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *lokiSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	return s.set(s.push(ctx, ds))
+}
+
+func (s *lokiSink) batchConfig() BatchConfig {
+	return BatchConfig{Size: s.cfg.BatchSize, Wait: s.cfg.BatchWait}
+}
+
+func (s *lokiSink) String() string {
+	return fmt.Sprintf("loki: %s %s", s.cfg.Encoding, s.name)
+}
+
+// push pushes a single batch of logs, retrying with backoff if needed until
+// ctx is done.
+func (s *lokiSink) push(ctx context.Context, ds []Data) error {
+	body, err := s.encode(ds)
+	if err != nil {
+		return err
+	}
+
+	err = s.retry.Do(ctx, func() (bool, error) {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		switch s.cfg.Encoding {
+		case LokiJSON:
+			req.Header.Set("Content-Type", "application/json")
+		case LokiGzip:
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+		case LokiSnappy:
+			req.Header.Set("Content-Type", "application/x-protobuf")
+		}
+
+		if s.cfg.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+		}
+		if s.cfg.Username != "" || s.cfg.Password != "" {
+			req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+		}
+
+		_, retry, err := doHTTP(s.cfg.Client, req)
+		return retry, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push %d logs to Loki: %v", len(ds), err)
+	}
+
+	return nil
+}
+
+// A lokiStream is a group of logs with the same labels.
+type lokiStream struct {
+	labels map[string]string
+	key    string
+	ds     []Data
+}
+
+// streams groups ds into streams by their labels.
+func (s *lokiSink) streams(ds []Data) []*lokiStream {
+	var ss []*lokiStream
+	byKey := make(map[string]*lokiStream)
+
+	for _, d := range ds {
+		level, _ := ParseLevel(d.Log.Message)
+
+		labels := map[string]string{
+			"host":  d.Host(),
+			"level": level.String(),
+		}
+		if s.cfg.Pipeline != "" {
+			labels["pipeline"] = s.cfg.Pipeline
+		}
+		if e := d.Event(); e != EventNone {
+			labels["event"] = string(e)
+		}
+
+		key := lokiLabels(labels)
+		st, ok := byKey[key]
+		if !ok {
+			st = &lokiStream{
+				labels: labels,
+				key:    key,
+			}
+
+			byKey[key] = st
+			ss = append(ss, st)
+		}
+
+		st.ds = append(st.ds, d)
+	}
+
+	return ss
+}
+
+// encode encodes ds as a push request body.
+func (s *lokiSink) encode(ds []Data) ([]byte, error) {
+	ss := s.streams(ds)
+
+	if s.cfg.Encoding == LokiSnappy {
+		return snappyEncode(lokiProtobuf(ss)), nil
+	}
+
+	b, err := lokiJSON(ss)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Encoding == LokiJSON {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// lokiLine formats d as a Loki log line.
+func lokiLine(d Data) string {
+	_, msg := ParseLevel(d.Log.Message)
+	return fmt.Sprintf("[%12.6f] %s", d.Log.Elapsed.Seconds(), msg)
+}
+
+// lokiTime returns the timestamp of d, using the current time if none is set.
+func lokiTime(d Data) time.Time {
+	if d.Time.IsZero() {
+		return time.Now()
+	}
+
+	return d.Time
+}
+
+// lokiLabels formats labels in Prometheus label set syntax, as used by
+// Loki's protocol buffers API.
+func lokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	ss := make([]string, 0, len(names))
+	for _, k := range names {
+		ss = append(ss, k+"="+strconv.Quote(labels[k]))
+	}
+
+	return "{" + strings.Join(ss, ", ") + "}"
+}
+
+// lokiJSON encodes streams using Loki's JSON push format.
+func lokiJSON(ss []*lokiStream) ([]byte, error) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	req := struct {
+		Streams []stream `json:"streams"`
+	}{
+		Streams: make([]stream, 0, len(ss)),
+	}
+
+	for _, st := range ss {
+		vs := make([][2]string, 0, len(st.ds))
+		for _, d := range st.ds {
+			vs = append(vs, [2]string{
+				strconv.FormatInt(lokiTime(d).UnixNano(), 10),
+				lokiLine(d),
+			})
+		}
+
+		req.Streams = append(req.Streams, stream{
+			Stream: st.labels,
+			Values: vs,
+		})
+	}
+
+	return json.Marshal(req)
+}
+
+// lokiProtobuf encodes streams as a Loki logproto.PushRequest.
+func lokiProtobuf(ss []*lokiStream) []byte {
+	req := newPBWriter()
+	for _, st := range ss {
+		// StreamAdapter.
+		stream := newPBWriter()
+		stream.String(1, st.key)
+
+		for _, d := range st.ds {
+			t := lokiTime(d)
+
+			// google.protobuf.Timestamp.
+			ts := newPBWriter()
+			ts.Varint(1, uint64(t.Unix()))
+			ts.Varint(2, uint64(t.Nanosecond()))
+
+			// EntryAdapter.
+			entry := newPBWriter()
+			entry.Message(1, ts)
+			entry.String(2, lokiLine(d))
+
+			stream.Message(2, entry)
+		}
+
+		req.Message(1, stream)
+	}
+
+	return req.Bytes()
+}
+
+// snappyEncode encodes b using the snappy block format.  Matches are found
+// using a single hash table probe per position, which compresses less than
+// the reference encoder but avoids an additional dependency.
+func snappyEncode(b []byte) []byte {
+	var buf bytes.Buffer
+
+	// The block begins with the uncompressed length.
+	lb := make([]byte, binary.MaxVarintLen64)
+	buf.Write(lb[:binary.PutUvarint(lb, uint64(len(b)))])
+
+	// Compress the input in chunks of at most 64KiB, so positions fit in
+	// the hash table and every copy offset fits in two bytes.
+	const chunk = 1 << 16
+	for len(b) > 0 {
+		n := len(b)
+		if n > chunk {
+			n = chunk
+		}
+
+		snappyEncodeChunk(&buf, b[:n])
+		b = b[n:]
+	}
+
+	return buf.Bytes()
+}
+
+// snappyEncodeChunk encodes up to 64KiB of b as snappy literal and copy
+// elements.
+func snappyEncodeChunk(buf *bytes.Buffer, b []byte) {
+	const (
+		tableBits = 14
+		minMatch  = 4
+	)
+
+	load := func(i int) uint32 { return binary.LittleEndian.Uint32(b[i:]) }
+	hash := func(u uint32) uint32 { return (u * 0x1e35a7bd) >> (32 - tableBits) }
+
+	var table [1 << tableBits]uint16
+
+	var s, emit int
+	for s+minMatch <= len(b) {
+		u := load(s)
+		h := hash(u)
+		c := int(table[h])
+		table[h] = uint16(s)
+
+		if c >= s || load(c) != u {
+			s++
+			continue
+		}
+
+		// Found a match: emit any pending literal, extend the match as far
+		// as possible, and copy it from the earlier position.
+		snappyLiteral(buf, b[emit:s])
+
+		start := s
+		s += minMatch
+		for s < len(b) && b[s] == b[c+s-start] {
+			s++
+		}
+
+		snappyCopy(buf, start-c, s-start)
+		emit = s
+	}
+
+	snappyLiteral(buf, b[emit:])
+}
+
+// snappyLiteral writes a snappy literal element containing b.
+func snappyLiteral(buf *bytes.Buffer, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	n := len(b) - 1
+	switch {
+	case n < 60:
+		buf.WriteByte(byte(n) << 2)
+	case n < 1<<8:
+		// Tag 60 indicates a 1 byte length - 1 follows.
+		buf.WriteByte(60 << 2)
+		buf.WriteByte(byte(n))
+	default:
+		// Tag 61 indicates a 2 byte little endian length - 1 follows.
+		buf.WriteByte(61 << 2)
+		buf.WriteByte(byte(n))
+		buf.WriteByte(byte(n >> 8))
+	}
+
+	buf.Write(b)
+}
+
+// snappyCopy writes snappy copy elements which repeat n bytes found offset
+// bytes earlier in the output.  offset must be less than 64KiB and n must be
+// at least 4.
+func snappyCopy(buf *bytes.Buffer, offset, n int) {
+	// Copies with a 2 byte offset hold at most 64 bytes.  Split long matches
+	// so the remainder is always at least 4 bytes.
+	for n >= 68 {
+		snappyCopy2(buf, offset, 64)
+		n -= 64
+	}
+	if n > 64 {
+		snappyCopy2(buf, offset, 60)
+		n -= 60
+	}
+
+	if n >= 12 || offset >= 2048 {
+		snappyCopy2(buf, offset, n)
+		return
+	}
+
+	// Short, close copies fit in a 1 byte offset element.
+	buf.WriteByte(byte(offset>>8)<<5 | byte(n-4)<<2 | 0x1)
+	buf.WriteByte(byte(offset))
+}
+
+// snappyCopy2 writes a snappy copy element with a 2 byte offset.
+func snappyCopy2(buf *bytes.Buffer, offset, n int) {
+	buf.WriteByte(byte(n-1)<<2 | 0x2)
+	buf.WriteByte(byte(offset))
+	buf.WriteByte(byte(offset >> 8))
+}
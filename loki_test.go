@@ -0,0 +1,466 @@
+package netconsoled_test
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestLokiSink(t *testing.T) {
+	want := map[string][]string{
+		`{host="192.168.1.1", level="info", pipeline="test"}`: {
+			"[    1.000000] hello",
+			"[    2.000000] world",
+		},
+		`{event="panic", host="192.168.1.1", level="emerg", pipeline="test"}`: {
+			"[    3.000000] Kernel panic - not syncing: foo",
+		},
+		`{host="192.168.1.2", level="info", pipeline="test"}`: {
+			"[    4.000000] hello",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{
+			name:     "JSON",
+			encoding: netconsoled.LokiJSON,
+		},
+		{
+			name:     "gzip",
+			encoding: netconsoled.LokiGzip,
+		},
+		{
+			name:     "snappy",
+			encoding: netconsoled.LokiSnappy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu  sync.Mutex
+				got = make(map[string][]string)
+			)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if diff := cmp.Diff("/loki/api/v1/push", r.URL.Path); diff != "" {
+					t.Errorf("unexpected path (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff("tenant", r.Header.Get("X-Scope-OrgID")); diff != "" {
+					t.Errorf("unexpected tenant (-want +got):\n%s", diff)
+				}
+				if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+					t.Errorf("unexpected basic auth: %q:%q", u, p)
+				}
+
+				streams := decodeLokiPush(t, r)
+
+				mu.Lock()
+				defer mu.Unlock()
+				for k, v := range streams {
+					got[k] = append(got[k], v...)
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer srv.Close()
+
+			sink, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+				URL:      srv.URL,
+				Encoding: tt.encoding,
+				TenantID: "tenant",
+				Username: "user",
+				Password: "pass",
+				Pipeline: "test",
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			// Logs may be stored individually or in batches.
+			if err := sink.Store(testData(1, 1, "hello")); err != nil {
+				t.Fatalf("failed to store log: %v", err)
+			}
+
+			if err := sink.StoreBatch([]netconsoled.Data{
+				testData(1, 2, "world"),
+				testData(1, 3, "<0>Kernel panic - not syncing: foo"),
+				testData(2, 4, "hello"),
+			}); err != nil {
+				t.Fatalf("failed to store logs: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected streams (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLokiSinkRetry(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		switch calls {
+		case 1:
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	sink, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL:        srv.URL,
+		MinBackoff: 1 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// The log is stored once the push succeeds.
+	if err := sink.Store(testData(1, 1, "hello")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(3, calls); diff != "" {
+		t.Fatalf("unexpected number of requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestLokiSinkClientError(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sink, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL:        srv.URL,
+		MinBackoff: 1 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// Client errors are not retried, and are reported immediately and by
+	// health checks.
+	if err := sink.Store(testData(1, 1, "hello")); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+	if err := sink.(netconsoled.HealthChecker).CheckHealth(); err == nil {
+		t.Fatal("expected sink to be unhealthy")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(1, calls); diff != "" {
+		t.Fatalf("unexpected number of requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestLokiSinkSnappyCompression(t *testing.T) {
+	const n = 100
+
+	var (
+		mu        sync.Mutex
+		got       []string
+		sent, raw int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		sent += len(b)
+		raw += len(decodeSnappy(t, b))
+
+		for _, v := range decodeLokiProtobuf(t, decodeSnappy(t, b)) {
+			got = append(got, v...)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL: srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	var (
+		ds   []netconsoled.Data
+		want []string
+	)
+
+	for i := 0; i < n; i++ {
+		msg := "usb 1-1: new high-speed USB device number 2 using xhci_hcd"
+		ds = append(ds, testData(1, i, msg))
+		want = append(want, fmt.Sprintf("[%12.6f] %s", float64(i), msg))
+	}
+
+	if err := sink.StoreBatch(ds); err != nil {
+		t.Fatalf("failed to store logs: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected lines (-want +got):\n%s", diff)
+	}
+
+	// Repetitive logs must actually be compressed.
+	if sent*2 > raw {
+		t.Fatalf("snappy request not compressed: sent %d bytes for %d bytes of protobuf", sent, raw)
+	}
+}
+
+func TestLokiSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.LokiConfig
+	}{
+		{
+			name: "URL",
+			cfg:  netconsoled.LokiConfig{URL: "localhost:3100"},
+		},
+		{
+			name: "encoding",
+			cfg:  netconsoled.LokiConfig{URL: "http://localhost:3100", Encoding: "foo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.LokiSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// decodeLokiPush decodes a Loki push request into log lines keyed by
+// stream labels.
+func decodeLokiPush(t *testing.T, r *http.Request) map[string][]string {
+	t.Helper()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	if r.Header.Get("Content-Type") == "application/x-protobuf" {
+		return decodeLokiProtobuf(t, decodeSnappy(t, b))
+	}
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(strings.NewReader(string(b)))
+		if err != nil {
+			t.Fatalf("failed to create gzip reader: %v", err)
+		}
+
+		if b, err = ioutil.ReadAll(zr); err != nil {
+			t.Fatalf("failed to decompress body: %v", err)
+		}
+	}
+
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+
+	out := make(map[string][]string)
+	for _, s := range req.Streams {
+		var names []string
+		for k := range s.Stream {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var labels []string
+		for _, k := range names {
+			labels = append(labels, k+"="+strconv.Quote(s.Stream[k]))
+		}
+
+		key := "{" + strings.Join(labels, ", ") + "}"
+		for _, v := range s.Values {
+			out[key] = append(out[key], v[1])
+		}
+	}
+
+	return out
+}
+
+// decodeSnappy decodes a snappy block.
+func decodeSnappy(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	n, i := binary.Uvarint(b)
+	b = b[i:]
+
+	var out []byte
+	for len(b) > 0 {
+		tag := b[0]
+		b = b[1:]
+
+		var offset, l int
+		switch tag & 0x3 {
+		case 0:
+			l = int(tag >> 2)
+			if l >= 60 {
+				size := l - 59
+				l = 0
+				for j := 0; j < size; j++ {
+					l |= int(b[j]) << uint(8*j)
+				}
+				b = b[size:]
+			}
+			l++
+
+			out = append(out, b[:l]...)
+			b = b[l:]
+			continue
+		case 1:
+			l = int(tag>>2&0x7) + 4
+			offset = int(tag>>5)<<8 | int(b[0])
+			b = b[1:]
+		case 2:
+			l = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(b))
+			b = b[2:]
+		default:
+			t.Fatalf("unexpected snappy element tag: %#x", tag)
+		}
+
+		if offset == 0 || offset > len(out) {
+			t.Fatalf("invalid snappy copy offset: %d", offset)
+		}
+
+		// Copies may overlap their own output, so copy byte by byte.
+		start := len(out) - offset
+		for j := 0; j < l; j++ {
+			out = append(out, out[start+j])
+		}
+	}
+
+	if diff := cmp.Diff(int(n), len(out)); diff != "" {
+		t.Fatalf("unexpected decoded length (-want +got):\n%s", diff)
+	}
+
+	return out
+}
+
+// decodeLokiProtobuf decodes a Loki logproto.PushRequest.
+func decodeLokiProtobuf(t *testing.T, b []byte) map[string][]string {
+	t.Helper()
+
+	out := make(map[string][]string)
+	for _, stream := range pbFields(t, b)[1] {
+		fs := pbFields(t, stream)
+
+		key := string(fs[1][0])
+		for _, entry := range fs[2] {
+			out[key] = append(out[key], string(pbFields(t, entry)[2][0]))
+		}
+	}
+
+	return out
+}
+
+// pbFields decodes the fields of a protocol buffers message.  Numeric fields
+// are returned as 8 byte little endian values.
+func pbFields(t *testing.T, b []byte) map[int][][]byte {
+	t.Helper()
+
+	fs := make(map[int][][]byte)
+	buf := proto.NewBuffer(b)
+	for {
+		tag, err := buf.DecodeVarint()
+		if err != nil {
+			// End of message.
+			return fs
+		}
+
+		var v []byte
+		switch tag & 0x7 {
+		case 0, 1:
+			decode := buf.DecodeVarint
+			if tag&0x7 == 1 {
+				decode = buf.DecodeFixed64
+			}
+
+			u, err := decode()
+			if err != nil {
+				t.Fatalf("failed to decode number: %v", err)
+			}
+
+			v = make([]byte, 8)
+			binary.LittleEndian.PutUint64(v, u)
+		case 2:
+			if v, err = buf.DecodeRawBytes(true); err != nil {
+				t.Fatalf("failed to decode bytes: %v", err)
+			}
+		default:
+			t.Fatalf("unexpected wire type: %d", tag&0x7)
+		}
+
+		field := int(tag >> 3)
+		fs[field] = append(fs[field], v)
+	}
+}
@@ -0,0 +1,287 @@
+package netconsoled
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A MemorySink is a Sink which keeps the most recent logs in memory, so they
+// can be queried later.
+type MemorySink struct {
+	size    int
+	perHost bool
+
+	mu    sync.RWMutex
+	all   *ring
+	hosts map[string]*ring
+}
+
+// NewMemorySink creates a MemorySink which keeps the most recent size logs.
+// If perHost is true, the most recent size logs are kept for each of up to
+// DefaultMaxHosts hosts, and the logs of the host which has been silent for
+// the longest time are discarded to make room for a new host.
+func NewMemorySink(size int, perHost bool) *MemorySink {
+	if size < 1 {
+		size = 1
+	}
+
+	return &MemorySink{
+		size:    size,
+		perHost: perHost,
+		all:     newRing(size),
+		hosts:   make(map[string]*ring),
+	}
+}
+
+var _ Sink = &MemorySink{}
+
+// Store stores a log in memory, evicting the oldest log if necessary.
+func (m *MemorySink) Store(d Data) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.perHost {
+		m.all.add(d)
+		return nil
+	}
+
+	host := d.Host()
+	r, ok := m.hosts[host]
+	if !ok {
+		if len(m.hosts) >= DefaultMaxHosts {
+			m.evictHost()
+		}
+
+		r = newRing(m.size)
+		m.hosts[host] = r
+	}
+
+	r.add(d)
+	return nil
+}
+
+// evictHost discards the logs of the host which has been silent for the
+// longest time.  m.mu must be held.
+func (m *MemorySink) evictHost() {
+	var (
+		oldest string
+		seen   time.Time
+	)
+
+	for host, r := range m.hosts {
+		if t := r.newest().Time; oldest == "" || t.Before(seen) {
+			oldest, seen = host, t
+		}
+	}
+
+	delete(m.hosts, oldest)
+}
+
+func (m *MemorySink) String() string {
+	if m.perHost {
+		return fmt.Sprintf("memory: %d logs per host", m.size)
+	}
+
+	return fmt.Sprintf("memory: %d logs", m.size)
+}
+
+// A Query selects logs which match all of its non-empty fields.
+type Query struct {
+	// Host selects logs from a single host.
+	Host string
+
+	// Since and Until select logs received within a time range.
+	Since, Until time.Time
+
+	// Contains selects logs with messages containing a substring.
+	Contains string
+
+	// Match selects logs with messages matching a regular expression.
+	Match *regexp.Regexp
+
+	// Limit selects only the most recent Limit logs.
+	Limit int
+}
+
+// Matches determines if d is selected by the Query, ignoring its Limit.
+func (q Query) Matches(d Data) bool {
+	switch {
+	case q.Host != "" && d.Host() != q.Host:
+		return false
+	case !q.Since.IsZero() && d.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && d.Time.After(q.Until):
+		return false
+	case q.Contains != "" && !strings.Contains(d.Log.Message, q.Contains):
+		return false
+	case q.Match != nil && !q.Match.MatchString(d.Log.Message):
+		return false
+	}
+
+	return true
+}
+
+// Query returns the logs selected by q, ordered from oldest to newest.
+func (m *MemorySink) Query(q Query) []Data {
+	m.mu.RLock()
+
+	var rings []*ring
+	switch {
+	case !m.perHost:
+		rings = []*ring{m.all}
+	case q.Host != "":
+		if r, ok := m.hosts[q.Host]; ok {
+			rings = []*ring{r}
+		}
+	default:
+		for _, r := range m.hosts {
+			rings = append(rings, r)
+		}
+	}
+
+	var out []Data
+	for _, r := range rings {
+		r.do(func(d Data) {
+			if q.Matches(d) {
+				out = append(out, d)
+			}
+		})
+	}
+
+	m.mu.RUnlock()
+
+	// Logs from multiple hosts must be merged in order of arrival.
+	if len(rings) > 1 {
+		sort.SliceStable(out, func(i, j int) bool {
+			return out[i].Time.Before(out[j].Time)
+		})
+	}
+
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+
+	return out
+}
+
+// ServeHTTP serves logs selected by a Query built from the "host", "since",
+// "until", "contains", "match", and "limit" query parameters, as a JSON array.
+//
+// The "since" and "until" parameters accept either RFC 3339 timestamps or
+// durations relative to the current time, such as "15m".
+func (m *MemorySink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs := m.Query(q)
+	if logs == nil {
+		// Always return an array, even if empty.
+		logs = []Data{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(logs)
+}
+
+// ParseQuery parses a Query from URL query parameters.  Relative times are
+// computed using now.
+func ParseQuery(v url.Values, now time.Time) (Query, error) {
+	q := Query{
+		Host:     v.Get("host"),
+		Contains: v.Get("contains"),
+	}
+
+	var err error
+	if q.Since, err = parseQueryTime(v.Get("since"), now); err != nil {
+		return Query{}, fmt.Errorf("invalid since parameter: %v", err)
+	}
+	if q.Until, err = parseQueryTime(v.Get("until"), now); err != nil {
+		return Query{}, fmt.Errorf("invalid until parameter: %v", err)
+	}
+
+	if s := v.Get("match"); s != "" {
+		if q.Match, err = regexp.Compile(s); err != nil {
+			return Query{}, fmt.Errorf("invalid match parameter: %v", err)
+		}
+	}
+
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 0 {
+			return Query{}, fmt.Errorf("invalid limit parameter: %q", s)
+		}
+	}
+
+	return q, nil
+}
+
+// parseQueryTime parses an RFC 3339 timestamp or a duration before now.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// A ring is a fixed-size circular buffer of logs.
+type ring struct {
+	logs []Data
+	next int
+	full bool
+}
+
+// newRing creates a ring which holds up to size logs.
+func newRing(size int) *ring {
+	return &ring{
+		logs: make([]Data, size),
+	}
+}
+
+// add adds a log to the ring, overwriting the oldest log if the ring is full.
+func (r *ring) add(d Data) {
+	r.logs[r.next] = d
+
+	r.next++
+	if r.next == len(r.logs) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// newest returns the most recently added log in the ring.
+func (r *ring) newest() Data {
+	i := r.next - 1
+	if i < 0 {
+		i = len(r.logs) - 1
+	}
+
+	return r.logs[i]
+}
+
+// do invokes fn for each log in the ring, from oldest to newest.
+func (r *ring) do(fn func(d Data)) {
+	if r.full {
+		for _, d := range r.logs[r.next:] {
+			fn(d)
+		}
+	}
+
+	for _, d := range r.logs[:r.next] {
+		fn(d)
+	}
+}
@@ -0,0 +1,185 @@
+package netconsoled_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestMemorySinkQuery(t *testing.T) {
+	start := time.Unix(1000, 0)
+
+	logs := []netconsoled.Data{
+		memoryData(start, 1, "hello world"),
+		memoryData(start.Add(1*time.Second), 2, "hello world"),
+		memoryData(start.Add(2*time.Second), 1, "kernel panic"),
+		memoryData(start.Add(3*time.Second), 2, "goodbye world"),
+		memoryData(start.Add(4*time.Second), 1, "goodbye world"),
+	}
+
+	tests := []struct {
+		name    string
+		size    int
+		perHost bool
+		q       netconsoled.Query
+		want    []netconsoled.Data
+	}{
+		{
+			name: "all, evicted",
+			size: 3,
+			want: logs[2:],
+		},
+		{
+			name:    "per host, evicted",
+			size:    2,
+			perHost: true,
+			want:    logs[1:],
+		},
+		{
+			name:    "per host, host",
+			size:    2,
+			perHost: true,
+			q:       netconsoled.Query{Host: "192.168.1.1"},
+			want:    []netconsoled.Data{logs[2], logs[4]},
+		},
+		{
+			name: "time range",
+			size: 8,
+			q: netconsoled.Query{
+				Since: start.Add(1 * time.Second),
+				Until: start.Add(3 * time.Second),
+			},
+			want: logs[1:4],
+		},
+		{
+			name: "contains and limit",
+			size: 8,
+			q: netconsoled.Query{
+				Contains: "world",
+				Limit:    2,
+			},
+			want: logs[3:],
+		},
+		{
+			name: "match",
+			size: 8,
+			q: netconsoled.Query{
+				Match: regexp.MustCompile(`^kernel`),
+			},
+			want: logs[2:3],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := netconsoled.NewMemorySink(tt.size, tt.perHost)
+			for _, d := range logs {
+				if err := sink.Store(d); err != nil {
+					t.Fatalf("failed to store log: %v", err)
+				}
+			}
+
+			got := sink.Query(tt.q)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMemorySinkMaxHosts(t *testing.T) {
+	sink := netconsoled.NewMemorySink(1, true)
+
+	// Store one more host than can be kept, so the first host is discarded.
+	start := time.Unix(1000, 0)
+	for i := 0; i <= netconsoled.DefaultMaxHosts; i++ {
+		d := netconsoled.Data{
+			Addr: &net.UDPAddr{
+				IP:   net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)),
+				Port: 6666,
+			},
+			Log:  netconsole.Log{Message: "hello world"},
+			Time: start.Add(time.Duration(i) * time.Second),
+		}
+
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(netconsoled.DefaultMaxHosts, len(sink.Query(netconsoled.Query{}))); diff != "" {
+		t.Fatalf("unexpected number of logs (-want +got):\n%s", diff)
+	}
+
+	if logs := sink.Query(netconsoled.Query{Host: "10.0.0.0"}); len(logs) != 0 {
+		t.Fatalf("expected first host to be discarded, but got logs: %v", logs)
+	}
+}
+
+func TestMemorySinkHTTP(t *testing.T) {
+	sink := netconsoled.NewMemorySink(8, false)
+
+	d := memoryData(time.Unix(1000, 0), 1, "hello world")
+	if err := sink.Store(d); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "?host=192.168.1.1&since=1970-01-01T00:00:00Z&match=world")
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	var got []map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+
+	want := []map[string]interface{}{{
+		"time":    d.Time.Format(time.RFC3339Nano),
+		"host":    "192.168.1.1",
+		"addr":    "192.168.1.1:6666",
+		"elapsed": 1.0,
+		"message": "hello world",
+	}}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+
+	res, err = http.Get(srv.URL + "?since=foo")
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+}
+
+func memoryData(now time.Time, host byte, msg string) netconsoled.Data {
+	return netconsoled.Data{
+		Addr: &net.UDPAddr{
+			IP:   net.IPv4(192, 168, 1, host),
+			Port: 6666,
+		},
+		Log: netconsole.Log{
+			Elapsed: 1 * time.Second,
+			Message: msg,
+		},
+		Time: now,
+	}
+}
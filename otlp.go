@@ -0,0 +1,266 @@
+package netconsoled
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// otlpLogsPath is the default path of the OTLP/HTTP logs endpoint.
+const otlpLogsPath = "/v1/logs"
+
+// An OTLPConfig configures an OTLP Sink.
+type OTLPConfig struct {
+	// URL is the URL of the OTLP/HTTP receiver.  If URL has no path,
+	// "/v1/logs" is used.
+	URL string
+
+	// Headers are added to each export request, such as for authentication.
+	Headers map[string]string
+
+	// BatchSize is the maximum number of logs exported in a single request.
+	// If zero, the Server's Batch.Size is used.
+	BatchSize int
+
+	// BatchWait is the maximum amount of time a log is buffered before it is
+	// exported.  If zero, the Server's Batch.Wait is used.
+	BatchWait time.Duration
+
+	// MaxRetries is the number of times a failed export is retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, exports are
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Client is the HTTP client used to export logs.  If nil, a client with
+	// a 10 second timeout is used.
+	Client *http.Client
+}
+
+// OTLPSink creates a BatchSink which exports logs as OpenTelemetry log
+// records using OTLP over HTTP with protocol buffers encoding.  Each batch of
+// logs is exported in a single request.
+//
+// Logs from each host share a resource with host.name and host.ip
+// attributes.  Each log record has a severity mapped from its kernel level,
+// and a kernel.timestamp attribute containing the number of seconds since
+// the host booted.  Exports which fail are retried with exponential backoff
+// before an error is returned.
+//
+// OTLP over gRPC is not supported; an OpenTelemetry Collector accepts both
+// transports on its OTLP receiver.
+func OTLPSink(cfg OTLPConfig) (BatchSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OTLP URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("OTLP URL must use HTTP or HTTPS: %q", cfg.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpLogsPath
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("OTLP batch size must not be negative: %d", cfg.BatchSize)
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &otlpSink{
+		cfg:   cfg,
+		url:   u.String(),
+		name:  redactURL(u),
+		retry: newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+	}, nil
+}
+
+var (
+	_ BatchSink        = &otlpSink{}
+	_ contextBatchSink = &otlpSink{}
+)
+
+type otlpSink struct {
+	healthState
+
+	cfg   OTLPConfig
+	url   string
+	name  string
+	retry retrier
+}
+
+func (s *otlpSink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+func (s *otlpSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *otlpSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	return s.set(s.push(ctx, ds))
+}
+
+func (s *otlpSink) batchConfig() BatchConfig {
+	return BatchConfig{Size: s.cfg.BatchSize, Wait: s.cfg.BatchWait}
+}
+
+func (s *otlpSink) String() string {
+	return fmt.Sprintf("otlp: %s", s.name)
+}
+
+// push exports a single batch of logs, retrying with backoff if needed until
+// ctx is done.
+func (s *otlpSink) push(ctx context.Context, ds []Data) error {
+	body := otlpRequest(ds)
+
+	err := s.retry.Do(ctx, func() (bool, error) {
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		for k, v := range s.cfg.Headers {
+			req.Header.Set(k, v)
+		}
+
+		_, retry, err := doHTTP(s.cfg.Client, req)
+		return retry, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export %d logs using OTLP: %v", len(ds), err)
+	}
+
+	return nil
+}
+
+// OpenTelemetry severity numbers for each kernel level, as recommended for
+// syslog severities.
+var otlpSeverities = map[Level]uint64{
+	LevelEmerg:   21, // FATAL
+	LevelAlert:   19, // ERROR3
+	LevelCrit:    18, // ERROR2
+	LevelErr:     17, // ERROR
+	LevelWarning: 13, // WARN
+	LevelNotice:  10, // INFO2
+	LevelInfo:    9,  // INFO
+	LevelDebug:   5,  // DEBUG
+}
+
+// otlpRequest encodes ds as an OTLP ExportLogsServiceRequest, with one
+// resource for each host.
+func otlpRequest(ds []Data) []byte {
+	var (
+		hosts   []string
+		records = make(map[string][]*pbWriter)
+	)
+
+	now := time.Now()
+	for _, d := range ds {
+		host := d.Host()
+		if _, ok := records[host]; !ok {
+			hosts = append(hosts, host)
+		}
+
+		records[host] = append(records[host], otlpLogRecord(d, now))
+	}
+
+	req := newPBWriter()
+	for _, host := range hosts {
+		// Resource.
+		resource := newPBWriter()
+		resource.Message(1, otlpString("host.name", host))
+		if ip := net.ParseIP(host); ip != nil {
+			// host.ip is an array of strings.
+			array := newPBWriter()
+			array.Message(1, otlpStringValue(ip.String()))
+
+			value := newPBWriter()
+			value.Message(5, array)
+
+			kv := newPBWriter()
+			kv.String(1, "host.ip")
+			kv.Message(2, value)
+
+			resource.Message(1, kv)
+		}
+
+		// InstrumentationScope.
+		scope := newPBWriter()
+		scope.String(1, "netconsoled")
+
+		// ScopeLogs.
+		scopeLogs := newPBWriter()
+		scopeLogs.Message(1, scope)
+		for _, r := range records[host] {
+			scopeLogs.Message(2, r)
+		}
+
+		// ResourceLogs.
+		resourceLogs := newPBWriter()
+		resourceLogs.Message(1, resource)
+		resourceLogs.Message(2, scopeLogs)
+
+		req.Message(1, resourceLogs)
+	}
+
+	return req.Bytes()
+}
+
+// otlpLogRecord encodes d as an OTLP LogRecord.
+func otlpLogRecord(d Data, now time.Time) *pbWriter {
+	level, msg := ParseLevel(d.Log.Message)
+
+	t := d.Time
+	if t.IsZero() {
+		t = now
+	}
+
+	r := newPBWriter()
+	r.Fixed64(1, uint64(t.UnixNano()))
+	r.Varint(2, otlpSeverities[level])
+	r.String(3, level.String())
+	r.Message(5, otlpStringValue(msg))
+	r.Message(6, otlpDouble("kernel.timestamp", d.Log.Elapsed.Seconds()))
+	if e := d.Event(); e != EventNone {
+		r.Message(6, otlpString("netconsole.event", string(e)))
+	}
+	r.Fixed64(11, uint64(t.UnixNano()))
+
+	return r
+}
+
+// otlpString encodes a KeyValue with a string value.
+func otlpString(key, value string) *pbWriter {
+	kv := newPBWriter()
+	kv.String(1, key)
+	kv.Message(2, otlpStringValue(value))
+	return kv
+}
+
+// otlpDouble encodes a KeyValue with a double value.
+func otlpDouble(key string, value float64) *pbWriter {
+	v := newPBWriter()
+	v.Double(4, value)
+
+	kv := newPBWriter()
+	kv.String(1, key)
+	kv.Message(2, v)
+	return kv
+}
+
+// otlpStringValue encodes an AnyValue with a string value.
+func otlpStringValue(s string) *pbWriter {
+	v := newPBWriter()
+	v.String(1, s)
+	return v
+}
@@ -0,0 +1,191 @@
+package netconsoled_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestOTLPSink(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []otlpRecord
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if diff := cmp.Diff("/v1/logs", r.URL.Path); diff != "" {
+			t.Errorf("unexpected path (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff("application/x-protobuf", r.Header.Get("Content-Type")); diff != "" {
+			t.Errorf("unexpected content type (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff("secret", r.Header.Get("X-API-Key")); diff != "" {
+			t.Errorf("unexpected API key (-want +got):\n%s", diff)
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, decodeOTLP(t, b)...)
+	}))
+	defer srv.Close()
+
+	sink, err := netconsoled.OTLPSink(netconsoled.OTLPConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"X-API-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// Logs in a batch are grouped by host.
+	if err := sink.StoreBatch([]netconsoled.Data{
+		testData(1, 1, "hello"),
+		testData(2, 2, "<4>WARNING: CPU: 0 PID: 1 at foo"),
+		testData(1, 3, "<7>world"),
+	}); err != nil {
+		t.Fatalf("failed to store logs: %v", err)
+	}
+
+	want := []otlpRecord{
+		{
+			Host:         "192.168.1.1",
+			IP:           "192.168.1.1",
+			Time:         time.Unix(1, 0).UnixNano(),
+			Severity:     9,
+			SeverityText: "info",
+			Body:         "hello",
+			Elapsed:      1,
+		},
+		{
+			Host:         "192.168.1.1",
+			IP:           "192.168.1.1",
+			Time:         time.Unix(3, 0).UnixNano(),
+			Severity:     5,
+			SeverityText: "debug",
+			Body:         "world",
+			Elapsed:      3,
+		},
+		{
+			Host:         "192.168.1.2",
+			IP:           "192.168.1.2",
+			Time:         time.Unix(2, 0).UnixNano(),
+			Severity:     13,
+			SeverityText: "warning",
+			Body:         "WARNING: CPU: 0 PID: 1 at foo",
+			Elapsed:      2,
+			Event:        "warning",
+		},
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected log records (-want +got):\n%s", diff)
+	}
+}
+
+func TestOTLPSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.OTLPConfig
+	}{
+		{
+			name: "URL",
+			cfg:  netconsoled.OTLPConfig{URL: "localhost:4318"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.OTLPSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// An otlpRecord is a flattened OTLP log record and its resource.
+type otlpRecord struct {
+	Host, IP     string
+	Time         int64
+	Severity     uint64
+	SeverityText string
+	Body         string
+	Elapsed      float64
+	Event        string
+}
+
+// decodeOTLP decodes the log records in an ExportLogsServiceRequest.
+func decodeOTLP(t *testing.T, b []byte) []otlpRecord {
+	t.Helper()
+
+	u64 := func(b []byte) uint64 { return binary.LittleEndian.Uint64(b) }
+
+	var rs []otlpRecord
+	for _, resourceLogs := range pbFields(t, b)[1] {
+		rlfs := pbFields(t, resourceLogs)
+
+		var host, ip string
+		for _, kv := range pbFields(t, rlfs[1][0])[1] {
+			kvfs := pbFields(t, kv)
+			value := pbFields(t, kvfs[2][0])
+
+			switch string(kvfs[1][0]) {
+			case "host.name":
+				host = string(value[1][0])
+			case "host.ip":
+				array := pbFields(t, value[5][0])
+				ip = string(pbFields(t, array[1][0])[1][0])
+			}
+		}
+
+		for _, scopeLogs := range rlfs[2] {
+			for _, record := range pbFields(t, scopeLogs)[2] {
+				fs := pbFields(t, record)
+
+				r := otlpRecord{
+					Host:         host,
+					IP:           ip,
+					Time:         int64(u64(fs[1][0])),
+					Severity:     u64(fs[2][0]),
+					SeverityText: string(fs[3][0]),
+					Body:         string(pbFields(t, fs[5][0])[1][0]),
+				}
+
+				if diff := cmp.Diff(fs[1], fs[11]); diff != "" {
+					t.Errorf("unexpected observed time (-want +got):\n%s", diff)
+				}
+
+				for _, kv := range fs[6] {
+					kvfs := pbFields(t, kv)
+					value := pbFields(t, kvfs[2][0])
+
+					switch string(kvfs[1][0]) {
+					case "kernel.timestamp":
+						r.Elapsed = math.Float64frombits(u64(value[4][0]))
+					case "netconsole.event":
+						r.Event = string(value[1][0])
+					}
+				}
+
+				rs = append(rs, r)
+			}
+		}
+	}
+
+	return rs
+}
@@ -0,0 +1,76 @@
+package netconsoled
+
+import (
+	"math"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Protocol buffers wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+)
+
+// A pbWriter encodes protocol buffers messages field by field, for the few
+// message types which netconsoled sends without generated code.
+type pbWriter struct {
+	b *proto.Buffer
+}
+
+// newPBWriter creates a pbWriter with an empty buffer.
+func newPBWriter() *pbWriter {
+	return &pbWriter{b: proto.NewBuffer(nil)}
+}
+
+// Bytes returns the encoded message.
+func (w *pbWriter) Bytes() []byte { return w.b.Bytes() }
+
+// Varint encodes a varint field.  Zero values are omitted.
+func (w *pbWriter) Varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	w.tag(field, pbVarint)
+	_ = w.b.EncodeVarint(v)
+}
+
+// Fixed64 encodes a fixed64 field.  Zero values are omitted.
+func (w *pbWriter) Fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	w.tag(field, pbFixed64)
+	_ = w.b.EncodeFixed64(v)
+}
+
+// Double encodes a double field.  Zero values are included, so that
+// doubles may be used as members of a oneof.
+func (w *pbWriter) Double(field int, v float64) {
+	w.tag(field, pbFixed64)
+	_ = w.b.EncodeFixed64(math.Float64bits(v))
+}
+
+// String encodes a string field.  Empty strings are omitted.
+func (w *pbWriter) String(field int, s string) {
+	if s == "" {
+		return
+	}
+
+	w.tag(field, pbBytes)
+	_ = w.b.EncodeStringBytes(s)
+}
+
+// Message encodes an embedded message field.
+func (w *pbWriter) Message(field int, m *pbWriter) {
+	w.tag(field, pbBytes)
+	_ = w.b.EncodeRawBytes(m.Bytes())
+}
+
+// tag encodes a field's tag.
+func (w *pbWriter) tag(field, wire int) {
+	_ = w.b.EncodeVarint(uint64(field<<3 | wire))
+}
@@ -0,0 +1,434 @@
+package netconsoled
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netconsole"
+)
+
+// relayMagic begins each relay connection, and identifies the version of
+// the relay protocol.
+const relayMagic = "NCR1"
+
+// maxRelayFrame is the maximum size of a single relay frame.
+const maxRelayFrame = 1 << 20
+
+// A relayFrame is a single log sent over a relay connection.  Each frame is
+// a 4 byte big endian length, followed by the frame encoded as JSON.
+//
+// The receiver acknowledges each frame with its 8 byte big endian sequence
+// number once the log has been handled.  Acknowledgements are cumulative.
+type relayFrame struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Addr      string    `json:"addr"`
+	ElapsedNS int64     `json:"elapsed_ns"`
+	Message   string    `json:"message"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Synthetic Event     `json:"synthetic,omitempty"`
+}
+
+// writeRelayFrame writes a single frame to w.
+func writeRelayFrame(w io.Writer, f relayFrame) error {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+
+	if _, err := w.Write(l[:]); err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// readRelayFrame reads a single frame from r.
+func readRelayFrame(r io.Reader) (relayFrame, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return relayFrame{}, err
+	}
+
+	n := binary.BigEndian.Uint32(l[:])
+	if n > maxRelayFrame {
+		return relayFrame{}, fmt.Errorf("relay frame is too long: %d bytes", n)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return relayFrame{}, err
+	}
+
+	var f relayFrame
+	if err := json.Unmarshal(b, &f); err != nil {
+		return relayFrame{}, fmt.Errorf("malformed relay frame: %v", err)
+	}
+
+	return f, nil
+}
+
+// relayAddr reconstructs the network address of a relayed log.  Netconsole
+// logs are sent over UDP, so addresses with an IP are UDP addresses.
+func relayAddr(s string) net.Addr {
+	host, port, err := net.SplitHostPort(s)
+	if err == nil {
+		p, err := strconv.Atoi(port)
+		if ip := net.ParseIP(host); ip != nil && err == nil {
+			return &net.UDPAddr{IP: ip, Port: p}
+		}
+	}
+
+	return relayStringAddr(s)
+}
+
+// A relayStringAddr is a relayed network address which is not an IP address.
+type relayStringAddr string
+
+func (a relayStringAddr) Network() string { return "relay" }
+func (a relayStringAddr) String() string  { return string(a) }
+
+// A RelayConfig configures a relay Sink.
+type RelayConfig struct {
+	// Network is the network used to relay logs: "tcp" or "tls".  If empty,
+	// "tcp" is used.
+	Network string
+
+	// Addr is the address of the relay listener of another Server.
+	Addr string
+
+	// TLSConfig configures TLS when Network is "tls".
+	TLSConfig *tls.Config
+
+	// BatchSize is the maximum number of logs sent before waiting for them
+	// to be acknowledged.  If zero, the Server's Batch.Size is used.
+	BatchSize int
+
+	// BatchWait is the maximum amount of time a log is buffered before it is
+	// sent.  If zero, the Server's Batch.Wait is used.
+	BatchWait time.Duration
+
+	// MaxRetries is the number of times a batch is resent if it is not
+	// acknowledged, with exponential backoff.  If zero, 5 is used; if
+	// negative, batches are not resent.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the timeout for connecting and for each batch to be
+	// acknowledged.  If zero, 10 seconds is used.
+	Timeout time.Duration
+}
+
+// RelaySink creates a Sink which relays logs to another Server, which serves
+// them using ServeRelay.  Each log keeps the address of the host which sent
+// it, its elapsed time, and the time it was received, so that the receiving
+// Server treats it as if it was received directly.
+//
+// Logs are sent over a single connection, and each batch of logs is sent
+// before waiting for the last of them to be acknowledged.  A batch which is
+// not acknowledged is resent on a new connection with exponential backoff
+// before an error is returned.  Delivery is at least once: a batch may be
+// handled twice if the connection fails before it is acknowledged.  Closing
+// the Sink closes its connection.
+func RelaySink(cfg RelayConfig) (BatchSink, error) {
+	switch cfg.Network {
+	case "":
+		cfg.Network = "tcp"
+	case "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported relay network: %q", cfg.Network)
+	}
+
+	if cfg.Addr == "" {
+		return nil, errors.New("relay address must not be empty")
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("relay batch size must not be negative: %d", cfg.BatchSize)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &relaySink{
+		cfg:   cfg,
+		retry: newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+	}, nil
+}
+
+var (
+	_ BatchSink        = &relaySink{}
+	_ contextBatchSink = &relaySink{}
+)
+
+type relaySink struct {
+	healthState
+
+	cfg   RelayConfig
+	retry retrier
+
+	// Batches are sent one at a time over a single connection.
+	mu  sync.Mutex
+	c   net.Conn
+	br  *bufio.Reader
+	seq uint64
+}
+
+func (s *relaySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.c != nil {
+		_ = s.c.Close()
+		s.c = nil
+	}
+
+	return nil
+}
+
+func (s *relaySink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+
+func (s *relaySink) batchConfig() BatchConfig {
+	return BatchConfig{Size: s.cfg.BatchSize, Wait: s.cfg.BatchWait}
+}
+
+func (s *relaySink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *relaySink) storeBatchContext(ctx context.Context, ds []Data) error {
+	if len(ds) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(s.push(ctx, ds))
+}
+
+func (s *relaySink) String() string {
+	return fmt.Sprintf("relay: %s://%s", s.cfg.Network, s.cfg.Addr)
+}
+
+// push sends a single batch of logs and waits for it to be acknowledged,
+// reconnecting and resending with backoff if needed until ctx is done.  The
+// caller must hold s.mu.
+func (s *relaySink) push(ctx context.Context, ds []Data) error {
+	fs := make([]relayFrame, 0, len(ds))
+	for _, d := range ds {
+		var addr string
+		if d.Addr != nil {
+			addr = d.Addr.String()
+		}
+
+		s.seq++
+		fs = append(fs, relayFrame{
+			Seq:       s.seq,
+			Time:      d.Time,
+			Addr:      addr,
+			ElapsedNS: int64(d.Log.Elapsed),
+			Message:   d.Log.Message,
+			Hostname:  d.Hostname,
+			Synthetic: d.Synthetic,
+		})
+	}
+
+	err := s.retry.Do(ctx, func() (bool, error) {
+		if err := s.send(fs); err != nil {
+			if s.c != nil {
+				_ = s.c.Close()
+				s.c = nil
+			}
+
+			return true, err
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to relay %d logs to %s: %v", len(ds), s.cfg.Addr, err)
+	}
+
+	return nil
+}
+
+// send sends frames over the current connection, connecting if needed, and
+// waits for the last frame to be acknowledged.
+func (s *relaySink) send(fs []relayFrame) error {
+	if s.c == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	_ = s.c.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	bw := bufio.NewWriter(s.c)
+	for _, f := range fs {
+		if err := writeRelayFrame(bw, f); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	last := fs[len(fs)-1].Seq
+	for {
+		var b [8]byte
+		if _, err := io.ReadFull(s.br, b[:]); err != nil {
+			return fmt.Errorf("failed to read acknowledgement: %v", err)
+		}
+
+		if binary.BigEndian.Uint64(b[:]) >= last {
+			return nil
+		}
+	}
+}
+
+// dial connects to the relay listener and begins the relay protocol.
+func (s *relaySink) dial() error {
+	var (
+		c   net.Conn
+		err error
+	)
+
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+	if s.cfg.Network == "tls" {
+		c, err = tls.DialWithDialer(dialer, "tcp", s.cfg.Addr, s.cfg.TLSConfig)
+	} else {
+		c, err = dialer.Dial("tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	_ = c.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	if _, err := io.WriteString(c, relayMagic); err != nil {
+		_ = c.Close()
+		return err
+	}
+
+	s.c = c
+	s.br = bufio.NewReader(c)
+	return nil
+}
+
+// ServeRelay serves logs relayed by the relay Sinks of other Servers, using
+// connections accepted on l, until ctx is canceled.  Each log is passed to
+// HandleData with its original address and receive time, and acknowledged
+// once it has been handled.
+//
+// The relay protocol does not authenticate peers, and any peer may relay logs
+// on behalf of any host.  Unless l only accepts local connections, it should
+// be a TLS listener which requires and verifies client certificates.
+func (s *Server) ServeRelay(ctx context.Context, l net.Listener) error {
+	defer s.listen()()
+	defer closeOnDone(ctx, l)()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			// Canceled context closes the listener.
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer closeOnDone(ctx, c)()
+
+			if err := s.serveRelayConn(ctx, c); err != nil {
+				s.ErrorLog.Printf("error reading relay stream from %s: %v", c.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// serveRelayConn handles relayed logs from a single connection.
+func (s *Server) serveRelayConn(ctx context.Context, c net.Conn) error {
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+
+	magic := make([]byte, len(relayMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return err
+	}
+	if string(magic) != relayMagic {
+		return fmt.Errorf("unsupported relay protocol: %q", magic)
+	}
+
+	for {
+		f, err := readRelayFrame(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		t := f.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		d := Data{
+			Addr: relayAddr(f.Addr),
+			Log: netconsole.Log{
+				Elapsed: time.Duration(f.ElapsedNS),
+				Message: f.Message,
+			},
+			Time:     t,
+			Hostname: f.Hostname,
+		}
+
+		// Relaying Servers only synthesize logs for silent hosts.
+		if f.Synthetic == EventSilent {
+			d.Synthetic = EventSilent
+		}
+
+		// Store the frame even if the relay server is stopped meanwhile.
+		s.HandleData(d)
+
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], f.Seq)
+		if _, err := bw.Write(b[:]); err != nil {
+			return err
+		}
+
+		// Acknowledge once all frames which have arrived are handled.
+		if br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
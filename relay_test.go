@@ -0,0 +1,264 @@
+package netconsoled_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestRelay(t *testing.T) {
+	server, client := testTLSConfigs(t)
+
+	tests := []struct {
+		name    string
+		network string
+		listen  func(l net.Listener) net.Listener
+	}{
+		{
+			name:   "TCP",
+			listen: func(l net.Listener) net.Listener { return l },
+		},
+		{
+			name:    "TLS",
+			network: "tls",
+			listen: func(l net.Listener) net.Listener {
+				return tls.NewListener(l, server)
+			},
+		},
+		{
+			name: "reconnect",
+			listen: func(l net.Listener) net.Listener {
+				return &flakyListener{Listener: l}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, s, dataC, done := testRelayServer(t, tt.listen)
+			defer done()
+
+			sink, err := netconsoled.RelaySink(netconsoled.RelayConfig{
+				Network:    tt.network,
+				Addr:       addr,
+				TLSConfig:  client,
+				MinBackoff: 10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			in := []netconsoled.Data{
+				testData(1, 1, "hello"),
+				testData(2, 2, "world"),
+			}
+			in[1].Log.Elapsed += 123456 * time.Nanosecond
+
+			for _, d := range in {
+				if err := sink.Store(d); err != nil {
+					t.Fatalf("failed to store log: %v", err)
+				}
+			}
+
+			if err := sink.(io.Closer).Close(); err != nil {
+				t.Fatalf("failed to close sink: %v", err)
+			}
+
+			// The logs are received as if they were sent directly to the
+			// relay server.
+			want := []relayedData{
+				{Addr: "192.168.1.1:6666", Data: in[0]},
+				{Addr: "192.168.1.2:6666", Data: in[1]},
+			}
+
+			var got []relayedData
+			for range in {
+				select {
+				case d := <-dataC:
+					got = append(got, relayedData{Addr: d.Addr.String(), Data: d})
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for log")
+				}
+			}
+
+			opts := []cmp.Option{
+				cmp.Comparer(func(x, y net.Addr) bool { return true }),
+			}
+
+			if diff := cmp.Diff(want, got, opts...); diff != "" {
+				t.Fatalf("unexpected relayed logs (-want +got):\n%s", diff)
+			}
+
+			var hosts []string
+			for _, hs := range s.Hosts() {
+				hosts = append(hosts, hs.Host)
+			}
+
+			if diff := cmp.Diff([]string{"192.168.1.1", "192.168.1.2"}, hosts); diff != "" {
+				t.Fatalf("unexpected hosts (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRelaySynthetic(t *testing.T) {
+	addr, s, dataC, done := testRelayServer(t, func(l net.Listener) net.Listener { return l })
+	defer done()
+
+	sink, err := netconsoled.RelaySink(netconsoled.RelayConfig{
+		Addr:       addr,
+		MinBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	silent := testData(1, 0, "netconsoled: host 192.168.1.1 has been silent for 5m0s")
+	silent.Synthetic = netconsoled.EventSilent
+
+	var stats []netconsoled.HostStats
+	for _, d := range []netconsoled.Data{testData(1, 2, "hello"), silent} {
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+
+		select {
+		case got := <-dataC:
+			if diff := cmp.Diff(d.Synthetic, got.Synthetic); diff != "" {
+				t.Fatalf("unexpected synthetic event (-want +got):\n%s", diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for log")
+		}
+
+		stats = append(stats, s.Hosts()...)
+	}
+
+	// The relayed silent host event was not sent by the host, so the host's
+	// statistics are unchanged by it.
+	if diff := cmp.Diff(stats[0], stats[1]); diff != "" {
+		t.Fatalf("unexpected host statistics (-want +got):\n%s", diff)
+	}
+}
+
+func TestRelayServerBadProtocol(t *testing.T) {
+	addr, _, _, done := testRelayServer(t, func(l net.Listener) net.Listener { return l })
+	defer done()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := io.WriteString(c, "<13>1 - - - - - - hello\n"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	// The server closes connections which do not speak the relay protocol.
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected EOF, but got: %v", err)
+	}
+}
+
+func TestRelaySinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.RelayConfig
+	}{
+		{
+			name: "network",
+			cfg:  netconsoled.RelayConfig{Network: "udp", Addr: "localhost:6667"},
+		},
+		{
+			name: "address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.RelaySink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// relayedData is Data with its address in comparable form.
+type relayedData struct {
+	Addr string
+	Data netconsoled.Data
+}
+
+// testRelayServer starts a Server which serves relayed logs using the
+// listener returned by listen.
+func testRelayServer(t *testing.T, listen func(l net.Listener) net.Listener) (string, *netconsoled.Server, <-chan netconsoled.Data, func()) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	dataC := make(chan netconsoled.Data, 16)
+	s := &netconsoled.Server{
+		Filter: netconsoled.NoopFilter(),
+		Sink: netconsoled.FuncSink(func(d netconsoled.Data) error {
+			dataC <- d
+			return nil
+		}),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if err := s.ServeRelay(ctx, listen(l)); err != nil {
+			t.Errorf("failed to serve relay: %v", err)
+		}
+	}()
+
+	return l.Addr().String(), s, dataC, func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// A flakyListener closes the first connection it accepts.
+type flakyListener struct {
+	net.Listener
+	once sync.Once
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	closed := false
+	l.once.Do(func() {
+		_ = c.Close()
+		closed = true
+	})
+	if closed {
+		return l.Listener.Accept()
+	}
+
+	return c, nil
+}
@@ -1,9 +1,19 @@
 package netconsoled
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mdlayher/netconsole"
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,6 +23,65 @@ import (
 type Data struct {
 	Addr net.Addr
 	Log  netconsole.Log
+
+	// Time is the time when the log was received by a Server.
+	Time time.Time
+
+	// Hostname is the name of the host which produced the log, if it was
+	// reported by the sender, such as in the HOSTNAME field of a syslog
+	// message.  It may differ from the host of Addr if the log was forwarded.
+	Hostname string
+
+	// Synthetic, if set, indicates that the log was produced by a Server on
+	// behalf of a host rather than sent by it, and is the Event which the
+	// log reports, such as EventSilent.  Synthetic logs do not report the
+	// host's elapsed time since boot, so they are not used to detect
+	// reboots.
+	Synthetic Event
+}
+
+// Host returns the host portion of the Data's network address.
+func (d Data) Host() string { return hostOf(d.Addr) }
+
+// Event returns the Event indicated by the Data: its Synthetic Event if set,
+// or otherwise the Event detected in its message.
+func (d Data) Event() Event {
+	if d.Synthetic != EventNone {
+		return d.Synthetic
+	}
+
+	return DetectEvent(d.Log.Message)
+}
+
+// jsonData is the JSON representation of Data.
+type jsonData struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	Addr    string    `json:"addr"`
+	Elapsed float64   `json:"elapsed"`
+	Message string    `json:"message"`
+
+	Hostname  string `json:"hostname,omitempty"`
+	Synthetic Event  `json:"synthetic,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Data) MarshalJSON() ([]byte, error) {
+	var addr string
+	if d.Addr != nil {
+		addr = d.Addr.String()
+	}
+
+	return json.Marshal(jsonData{
+		Time:    d.Time,
+		Host:    d.Host(),
+		Addr:    addr,
+		Elapsed: d.Log.Elapsed.Seconds(),
+		Message: d.Log.Message,
+
+		Hostname:  d.Hostname,
+		Synthetic: d.Synthetic,
+	})
 }
 
 // A Server serves the netconsoled UDP and HTTP servers.
@@ -23,6 +92,51 @@ type Server struct {
 	// Sink gathers processed logs and stores them.
 	Sink Sink
 
+	// DeadLetter, if not nil, receives each log which Sink fails to store,
+	// along with the name of the failing Sink and its error, including logs
+	// which Sinks fail to store in the background.
+	DeadLetter DeadLetterSink
+
+	// Batch configures batching for Sinks which implement BatchSink, such
+	// as a failover Sink with a member which implements BatchSink.  Sinks
+	// whose configuration sets a batch size or wait, such as LokiSink, use
+	// those values in place of Batch's.  Each batch which fails to be stored
+	// is passed to DeadLetter.
+	Batch BatchConfig
+
+	// SinkTimeout, if not zero, is the maximum amount of time each Sink, or
+	// each Sink within a MultiSink, may take to store a log.  Sinks which
+	// implement ContextSink are canceled at the deadline; others are
+	// abandoned, and further logs fail without being passed to the Sink
+	// until the abandoned call returns.
+	SinkTimeout time.Duration
+
+	// ExpectedHosts lists the IP addresses of hosts which are expected to
+	// send logs regularly, in the form returned by Data.Host.  While
+	// WatchHosts is running, an expected host which has sent no logs for
+	// longer than SilenceThreshold is reported as down, and a synthetic log
+	// which indicates EventSilent is stored in Sink on behalf of the host.
+	// If SilenceThreshold is zero, DefaultSilenceThreshold is used.
+	ExpectedHosts    []string
+	SilenceThreshold time.Duration
+
+	// MaxHosts is the maximum number of hosts for which statistics and
+	// metrics are kept.  When a log is received from a new host and the limit
+	// has been reached, the host which has been silent for the longest time
+	// is forgotten, unless it is one of ExpectedHosts.  If zero,
+	// DefaultMaxHosts is used.
+	MaxHosts int
+
+	// SyslogIdleTimeout is the maximum amount of time ServeSyslogStream
+	// waits for each message on a connection before closing it.  If zero,
+	// DefaultSyslogIdleTimeout is used.
+	SyslogIdleTimeout time.Duration
+
+	// MaxSyslogConns is the maximum number of connections ServeSyslogStream
+	// serves at once.  Connections accepted beyond the limit are closed
+	// immediately.  If zero, DefaultMaxSyslogConns is used.
+	MaxSyslogConns int
+
 	// ErrorLog specifies a logger to use for capturing errors.
 	ErrorLog *log.Logger
 
@@ -34,6 +148,70 @@ type Server struct {
 	// Embedding is used for metrics to slightly simplify the call sites
 	// to s.inc and avoid polluting the Server structure, although this
 	// probably isn't ideal.
+
+	// wrappedFilter and wrapped are Filter and Sink with metrics, batching,
+	// and timeouts applied, created on first use.
+	filterOnce    sync.Once
+	wrappedFilter ContextFilter
+	sinkOnce      sync.Once
+	wrapped       ContextSink
+
+	// queues are the Sinks within wrapped which queue logs, and drop them
+	// when their queues are full.
+	queues []queueSink
+
+	// mu protects internal server state.
+	mu        sync.Mutex
+	listeners int
+	hosts     map[string]*hostState
+	silent    map[string]bool
+}
+
+// DefaultMaxHosts is the default maximum number of hosts for which a Server
+// keeps statistics.
+const DefaultMaxHosts = 10000
+
+// DefaultSyslogIdleTimeout is the default amount of time a syslog stream
+// connection may be idle before it is closed.
+const DefaultSyslogIdleTimeout = 5 * time.Minute
+
+// DefaultMaxSyslogConns is the default maximum number of syslog stream
+// connections a Server serves at once.
+const DefaultMaxSyslogConns = 1000
+
+// DefaultSilenceThreshold is the default amount of time an expected host may
+// be silent before it is reported as down.
+const DefaultSilenceThreshold = 5 * time.Minute
+
+// minWatchInterval is the minimum interval between checks for silent hosts.
+const minWatchInterval = 10 * time.Millisecond
+
+// hostState is the internal state tracked for each host.
+type hostState struct {
+	stats HostStats
+
+	// boot is the host's current boot, used to detect when it reboots.
+	boot Boot
+}
+
+// HostStats contains statistics about the logs received from a single host.
+type HostStats struct {
+	// Host is the network address of the host, without a port.
+	Host string `json:"host"`
+
+	// LastSeen is the time when the most recent log was received from the host.
+	LastSeen time.Time `json:"last_seen"`
+
+	// Boots is the number of times the host has booted, as detected by
+	// the elapsed time of a log being less than that of the previous log.
+	Boots int `json:"boots"`
+
+	// Counts of logs received from the host, dropped by a Filter,
+	// and which encountered an error in a Filter or Sink.
+	Received int `json:"received"`
+	Bytes    int `json:"bytes"`
+	Dropped  int `json:"dropped"`
+	Errors   int `json:"errors"`
 }
 
 // Prometheus metric labels.
@@ -43,44 +221,555 @@ const (
 	labelError   = "error"
 )
 
+// Serve serves netconsole logs received on pc until ctx is canceled.  Each
+// log which is successfully parsed is passed to Handle, and any malformed logs
+// are discarded.
+func (s *Server) Serve(ctx context.Context, pc net.PacketConn) error {
+	return s.servePacket(ctx, pc, os.Getpagesize(), func(b []byte) (Data, error) {
+		l, err := netconsole.ParseLog(string(b))
+		return Data{Log: l}, err
+	})
+}
+
+// servePacket serves logs received on pc until ctx is canceled, using parse
+// to parse each packet of up to size bytes.  Packets which cannot be parsed
+// are discarded.
+func (s *Server) servePacket(ctx context.Context, pc net.PacketConn, size int, parse func(b []byte) (Data, error)) error {
+	defer s.listen()()
+	defer closeOnDone(ctx, pc)()
+
+	b := make([]byte, size)
+	for {
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			// Canceled context closes the connection.
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		d, err := parse(b[:n])
+		if err != nil {
+			continue
+		}
+
+		d.Addr = addr
+		d.Time = time.Now()
+
+		// A log which has been received is stored even if ctx is canceled
+		// while it is being processed.
+		s.HandleData(d)
+	}
+}
+
+// listen marks the Server as serving a listener until the returned function
+// is invoked.
+func (s *Server) listen() func() {
+	s.mu.Lock()
+	s.listeners++
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		s.listeners--
+		s.mu.Unlock()
+	}
+}
+
+// closeOnDone closes c when ctx is canceled, so that blocked reads on c are
+// interrupted.  The returned function must be invoked to close c and clean
+// up if c is no longer needed before ctx is canceled.
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer wg.Done()
+
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		_ = c.Close()
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Ready returns an error if the Server is not ready to process logs, either
+// because it is not serving any listeners, because its Sink reports that it
+// is not healthy, or because a Sink's queue of logs waiting to be stored is
+// full, such as the batches buffered for a Sink which implements BatchSink.
+func (s *Server) Ready() error {
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	if listeners == 0 {
+		return errors.New("server is not listening for logs")
+	}
+
+	sink := s.sink()
+	if err := checkHealth(sink); err != nil {
+		return fmt.Errorf("server sink is not healthy: %v", err)
+	}
+
+	for _, q := range s.queues {
+		if err := q.saturated(); err != nil {
+			return fmt.Errorf("server sink is saturated: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Close stores any logs buffered for Sinks which implement BatchSink, and
+// closes the Server's Sink if it implements io.Closer.  Close must only be
+// invoked once the Server is no longer serving any listeners.
+func (s *Server) Close() error {
+	c, ok := s.sink().(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
+
+// filter returns the Server's Filter, with metrics applied to each Filter.
+func (s *Server) filter() ContextFilter {
+	s.filterOnce.Do(func() {
+		filter := s.Filter
+		if s.Metrics != (Metrics{}) && s.FilterLogsTotal != nil && s.FilterDurationSeconds != nil {
+			var n int
+			filter = wrapFilters(filter, func(f Filter) Filter {
+				mf := &metricsFilter{
+					f:        ContextFilterAdapter(f),
+					name:     metricName(f),
+					index:    strconv.Itoa(n),
+					total:    s.FilterLogsTotal,
+					duration: s.FilterDurationSeconds,
+				}
+				n++
+
+				return mf
+			})
+		}
+
+		s.wrappedFilter = ContextFilterAdapter(filter)
+	})
+
+	return s.wrappedFilter
+}
+
+// sink returns the Server's Sink, with batching applied to any Sinks which
+// implement BatchSink, and with the Server's timeout and metrics applied to
+// each Sink.
+func (s *Server) sink() ContextSink {
+	s.sinkOnce.Do(func() {
+		// Sinks which store logs in the background report logs which they
+		// fail to store so they can be dead-lettered.
+		WalkSinks([]Sink{s.Sink}, func(sink Sink) {
+			if as, ok := sink.(asyncSink); ok {
+				as.setFailed(s.sinkFailed(sink))
+			}
+			if q, ok := sink.(queueSink); ok {
+				s.queues = append(s.queues, q)
+			}
+		})
+
+		// Number each Sink in pipeline order, so that metrics for Sinks of
+		// the same kind can be told apart.
+		var n int
+		sink := wrapSinks(s.Sink, func(sink Sink) Sink {
+			name, index := metricName(sink), strconv.Itoa(n)
+			n++
+
+			if bs, ok := sink.(BatchSink); ok {
+				cfg := s.Batch
+				if bc, ok := bs.(batchConfigurer); ok {
+					cfg = cfg.override(bc.batchConfig())
+				}
+
+				sink = newBatchingSink(cfg, bs, s.sinkFailed(bs))
+				s.queues = append(s.queues, sink.(queueSink))
+			}
+
+			if s.SinkTimeout > 0 {
+				sink = &timeoutSink{
+					ContextSink: ContextSinkAdapter(sink),
+					timeout:     s.SinkTimeout,
+					abandon: func() {
+						s.inc(s.SinkAbandonedTotal, name, index)
+					},
+				}
+			}
+
+			if s.Metrics != (Metrics{}) && s.SinkLogsTotal != nil && s.SinkDurationSeconds != nil {
+				sink = &metricsSink{
+					ContextSink: ContextSinkAdapter(sink),
+					name:        name,
+					index:       index,
+					total:       s.SinkLogsTotal,
+					duration:    s.SinkDurationSeconds,
+				}
+			}
+
+			return sink
+		})
+
+		s.wrapped = ContextSinkAdapter(sink)
+	})
+
+	return s.wrapped
+}
+
 // Handle handles incoming netconsole log messages.
 func (s *Server) Handle(addr net.Addr, l netconsole.Log) {
+	s.HandleContext(context.Background(), addr, l)
+}
+
+// HandleContext is like Handle, but ctx is passed to the Server's Filter and
+// Sink, so that handling the log can be canceled.
+func (s *Server) HandleContext(ctx context.Context, addr net.Addr, l netconsole.Log) {
 	// Package up information for easier parameter passing.
-	in := Data{
+	s.HandleDataContext(ctx, Data{
 		Addr: addr,
 		Log:  l,
-	}
+		Time: time.Now(),
+	})
+}
 
-	host, _, err := net.SplitHostPort(addr.String())
-	if err != nil {
-		s.ErrorLog.Printf("error splitting network address: %v", err)
+// HandleData handles a log which was received elsewhere, such as one relayed
+// by another Server, preserving its original address and receive time.
+func (s *Server) HandleData(in Data) {
+	s.HandleDataContext(context.Background(), in)
+}
+
+// HandleDataContext is like HandleData, but ctx is passed to the Server's
+// Filter and Sink, so that handling the log can be canceled.
+func (s *Server) HandleDataContext(ctx context.Context, in Data) {
+	if in.Addr == nil {
+		s.ErrorLog.Printf("error handling log with no network address")
 		return
 	}
 
-	s.inc(s.LogsReceivedTotal, host)
+	// A synthetic log, such as one relayed from another Server which
+	// reports that a host is silent, was not sent by its host, so it is not
+	// counted in the host's statistics and metrics.
+	host := in.Host()
+	observe := func(fn func(hs *hostState)) {}
+
+	if in.Synthetic == EventNone {
+		var err error
+		host, _, err = net.SplitHostPort(in.Addr.String())
+		if err != nil {
+			s.ErrorLog.Printf("error splitting network address: %v", err)
+			return
+		}
+
+		observe = func(fn func(hs *hostState)) { s.observe(host, fn) }
+
+		s.inc(s.LogsReceivedTotal, host)
+		s.add(s.HostReceivedBytesTotal, float64(len(in.Log.Message)), host)
+		s.set(s.HostLastSeenSeconds, float64(in.Time.UnixNano())/1e9, host)
+		observe(func(hs *hostState) {
+			hs.boot, _ = hs.boot.Next(in.Log.Elapsed)
+			hs.stats.Boots = hs.boot.N
 
-	out, pass, err := s.Filter.Filter(in)
+			hs.stats.LastSeen = in.Time
+			hs.stats.Received++
+			hs.stats.Bytes += len(in.Log.Message)
+		})
+	}
+
+	out, pass, err := s.filter().FilterContext(ctx, in)
 	if err != nil {
 		s.inc(s.LogsFilterTotal, host, labelError)
+		observe(func(hs *hostState) { hs.stats.Errors++ })
 		s.ErrorLog.Printf("error filtering log: %v", err)
 		return
 	}
 	if !pass {
 		s.inc(s.LogsFilterTotal, host, labelDropped)
+		observe(func(hs *hostState) { hs.stats.Dropped++ })
 		return
 	}
 
 	s.inc(s.LogsFilterTotal, host, labelOK)
 
-	if err := s.Sink.Store(out); err != nil {
+	if err := s.sink().StoreContext(ctx, out); err != nil {
 		s.inc(s.LogsSinkTotal, host, labelError)
+		observe(func(hs *hostState) { hs.stats.Errors++ })
 		s.ErrorLog.Printf("error sending log to sink: %v", err)
+		s.deadLetter(host, out, err)
 		return
 	}
 
 	s.inc(s.LogsSinkTotal, host, labelOK)
 }
 
+// deadLetter passes a log which could not be stored to the dead-letter
+// sink, if one is configured.  A log is passed once for each Sink within a
+// MultiSink which failed to store it.
+func (s *Server) deadLetter(host string, d Data, err error) {
+	if s.DeadLetter == nil {
+		return
+	}
+
+	// Identify the Sinks within a MultiSink which failed.
+	switch err := err.(type) {
+	case *SinkError:
+		s.storeDeadLetter(host, DeadLetter{
+			Data: d,
+			Sink: err.Sink,
+			Err:  err.Err,
+		})
+	case SinkErrors:
+		for _, serr := range err {
+			s.storeDeadLetter(host, DeadLetter{
+				Data: d,
+				Sink: serr.Sink,
+				Err:  serr.Err,
+			})
+		}
+	default:
+		s.storeDeadLetter(host, DeadLetter{
+			Data: d,
+			Sink: s.Sink.String(),
+			Err:  err,
+		})
+	}
+}
+
+// storeDeadLetter passes dl to the dead-letter sink.
+func (s *Server) storeDeadLetter(host string, dl DeadLetter) {
+	if err := s.DeadLetter.StoreDeadLetter(dl); err != nil {
+		s.inc(s.LogsDeadLetterTotal, host, labelError)
+		s.ErrorLog.Printf("error sending log to dead-letter sink: %v", err)
+		return
+	}
+
+	s.inc(s.LogsDeadLetterTotal, host, labelOK)
+}
+
+// sinkFailed returns a function which passes each log that sink failed to
+// store after its Store method returned, such as a batch of logs, to the
+// dead-letter sink.
+func (s *Server) sinkFailed(sink Sink) func(ds []Data, err error) {
+	name := sink.String()
+
+	return func(ds []Data, err error) {
+		s.ErrorLog.Printf("error sending %d logs to sink: %v", len(ds), err)
+
+		for _, d := range ds {
+			s.deadLetter(hostOf(d.Addr), d, &SinkError{
+				Sink: name,
+				Err:  err,
+			})
+		}
+	}
+}
+
+// Hosts returns statistics for each host which has sent logs to the Server,
+// sorted by host.
+func (s *Server) Hosts() []HostStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hosts := make([]HostStats, 0, len(s.hosts))
+	for _, hs := range s.hosts {
+		hosts = append(hosts, hs.stats)
+	}
+
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	return hosts
+}
+
+// observe updates the state of host using fn.
+func (s *Server) observe(host string, fn func(hs *hostState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hosts == nil {
+		s.hosts = make(map[string]*hostState)
+	}
+
+	hs, ok := s.hosts[host]
+	if !ok {
+		s.evictHost()
+
+		hs = &hostState{stats: HostStats{Host: host}}
+		s.hosts[host] = hs
+	}
+
+	fn(hs)
+}
+
+// evictHost forgets the host which has been silent for the longest time if
+// the Server is tracking its maximum number of hosts, so that logs from many
+// different addresses cannot consume unbounded memory.  s.mu must be held.
+func (s *Server) evictHost() {
+	max := s.MaxHosts
+	if max <= 0 {
+		max = DefaultMaxHosts
+	}
+
+	if len(s.hosts) < max {
+		return
+	}
+
+	expected := make(map[string]bool, len(s.ExpectedHosts))
+	for _, h := range s.ExpectedHosts {
+		expected[h] = true
+	}
+
+	var (
+		oldest string
+		seen   time.Time
+	)
+
+	for host, hs := range s.hosts {
+		if expected[host] {
+			continue
+		}
+
+		if oldest == "" || hs.stats.LastSeen.Before(seen) {
+			oldest, seen = host, hs.stats.LastSeen
+		}
+	}
+
+	if oldest == "" {
+		return
+	}
+
+	delete(s.hosts, oldest)
+	s.forget(oldest)
+}
+
+// WatchHosts reports each of the Server's ExpectedHosts which has been silent
+// for longer than SilenceThreshold until ctx is canceled.  A host is considered
+// to have last been seen when WatchHosts is invoked if it has not yet sent any
+// logs.
+func (s *Server) WatchHosts(ctx context.Context) error {
+	threshold := s.SilenceThreshold
+	if threshold < 0 {
+		return fmt.Errorf("silence threshold must not be negative: %s", threshold)
+	}
+	if threshold == 0 {
+		threshold = DefaultSilenceThreshold
+	}
+
+	start := time.Now()
+
+	// Check often enough that silence is noticed soon after it begins, but
+	// not so often that very small thresholds spin.
+	interval := threshold / 10
+	if interval < minWatchInterval {
+		interval = minWatchInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		s.checkHosts(start, threshold)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// checkHosts checks whether each of the Server's ExpectedHosts has been
+// silent for longer than threshold, and reports any host which has become
+// silent since the previous check.
+func (s *Server) checkHosts(start time.Time, threshold time.Duration) {
+	now := time.Now()
+
+	for _, host := range s.ExpectedHosts {
+		s.mu.Lock()
+
+		last := start
+		if hs, ok := s.hosts[host]; ok && hs.stats.LastSeen.After(last) {
+			last = hs.stats.LastSeen
+		}
+
+		if s.silent == nil {
+			s.silent = make(map[string]bool)
+		}
+
+		silence := now.Sub(last)
+		silent := silence > threshold
+		wasSilent := s.silent[host]
+		s.silent[host] = silent
+
+		s.mu.Unlock()
+
+		if !silent {
+			s.set(s.HostUp, 1, host)
+			continue
+		}
+
+		s.set(s.HostUp, 0, host)
+		if wasSilent {
+			continue
+		}
+
+		s.ErrorLog.Printf("expected host %s has been silent for %s", host, silence)
+
+		// The log bypasses the Server's Filter and host statistics so that
+		// it is not mistaken for a log sent by the host.
+		d := Data{
+			Addr: syntheticAddr(host),
+			Log: netconsole.Log{
+				Message: fmt.Sprintf("netconsoled: host %s has been silent for %s", host, silence.Round(time.Second)),
+			},
+			Time:      now,
+			Synthetic: EventSilent,
+		}
+
+		if err := s.sink().Store(d); err != nil {
+			s.ErrorLog.Printf("error sending silent host log to sink: %v", err)
+			s.deadLetter(host, d, err)
+		}
+	}
+}
+
+// A syntheticAddr is the network address of a synthetic log: the IP address
+// of the host on whose behalf the log was produced, with no port.
+type syntheticAddr string
+
+func (a syntheticAddr) Network() string { return "synthetic" }
+func (a syntheticAddr) String() string  { return string(a) }
+
+// hostOf returns the host portion of addr, or the entire address if it
+// has no port.
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
 // inc increments the specified counter with the specified labels.
 // If metrics are not configured, inc is a no-op.
 func (s *Server) inc(cv *prometheus.CounterVec, labels ...string) {
@@ -91,12 +780,161 @@ func (s *Server) inc(cv *prometheus.CounterVec, labels ...string) {
 	cv.WithLabelValues(labels...).Inc()
 }
 
+// forget deletes all metrics labeled with host.
+// If metrics are not configured, forget is a no-op.
+func (s *Server) forget(host string) {
+	if s.Metrics == (Metrics{}) {
+		return
+	}
+
+	for _, cv := range []*prometheus.CounterVec{s.LogsReceivedTotal, s.HostReceivedBytesTotal} {
+		if cv != nil {
+			cv.DeleteLabelValues(host)
+		}
+	}
+
+	for _, cv := range []*prometheus.CounterVec{s.LogsFilterTotal, s.LogsSinkTotal, s.LogsDeadLetterTotal} {
+		if cv == nil {
+			continue
+		}
+
+		for _, status := range []string{labelOK, labelDropped, labelError} {
+			cv.DeleteLabelValues(host, status)
+		}
+	}
+
+	if s.HostLastSeenSeconds != nil {
+		s.HostLastSeenSeconds.DeleteLabelValues(host)
+	}
+}
+
+// add adds v to the specified counter with the specified labels.
+// If metrics are not configured, add is a no-op.
+func (s *Server) add(cv *prometheus.CounterVec, v float64, labels ...string) {
+	if s.Metrics == (Metrics{}) || cv == nil {
+		return
+	}
+
+	cv.WithLabelValues(labels...).Add(v)
+}
+
+// set sets the specified gauge with the specified labels to v.
+// If metrics are not configured, set is a no-op.
+func (s *Server) set(gv *prometheus.GaugeVec, v float64, labels ...string) {
+	if s.Metrics == (Metrics{}) || gv == nil {
+		return
+	}
+
+	gv.WithLabelValues(labels...).Set(v)
+}
+
+var _ ContextFilter = &metricsFilter{}
+
+// A metricsFilter is a ContextFilter which records the outcome and latency of
+// each log passed through its Filter, labeled by the Filter's name.
+type metricsFilter struct {
+	f           ContextFilter
+	name, index string
+	total       *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+func (f *metricsFilter) Filter(in Data) (Data, bool, error) {
+	return f.FilterContext(context.Background(), in)
+}
+
+func (f *metricsFilter) FilterContext(ctx context.Context, in Data) (Data, bool, error) {
+	start := time.Now()
+	out, pass, err := f.f.FilterContext(ctx, in)
+	f.duration.WithLabelValues(f.name, f.index).Observe(time.Since(start).Seconds())
+
+	status := labelOK
+	switch {
+	case err != nil:
+		status = labelError
+	case !pass:
+		status = labelDropped
+	}
+
+	f.total.WithLabelValues(f.name, f.index, status).Inc()
+	return out, pass, err
+}
+
+func (f *metricsFilter) String() string { return f.f.String() }
+
+var _ ContextSink = &metricsSink{}
+
+// A metricsSink is a ContextSink which records the outcome and latency of
+// each log stored by its Sink, labeled by the Sink's kind and its index in
+// the Server's pipeline.
+type metricsSink struct {
+	ContextSink
+	name, index string
+	total       *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+}
+
+func (s *metricsSink) Close() error {
+	c, ok := s.ContextSink.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
+
+func (s *metricsSink) CheckHealth() error { return checkHealth(s.ContextSink) }
+
+func (s *metricsSink) Store(d Data) error { return s.StoreContext(context.Background(), d) }
+
+func (s *metricsSink) StoreContext(ctx context.Context, d Data) error {
+	start := time.Now()
+	err := s.ContextSink.StoreContext(ctx, d)
+	s.duration.WithLabelValues(s.name, s.index).Observe(time.Since(start).Seconds())
+
+	status := labelOK
+	if err != nil {
+		status = labelError
+	}
+
+	s.total.WithLabelValues(s.name, s.index, status).Inc()
+	return err
+}
+
+// metricName returns the kind of a Filter or Sink for use as a metric label.
+// Only the part of its name before any colon is used, so that details such
+// as addresses, paths, and credentials are not exposed.
+func metricName(v fmt.Stringer) string {
+	name := v.String()
+	if i := strings.IndexByte(name, ':'); i != -1 {
+		name = name[:i]
+	}
+
+	return strings.TrimSpace(name)
+}
+
 // Metrics contains Prometheus metrics for a Server.
 type Metrics struct {
 	// Metrics related to log ingestion and processing.
 	LogsReceivedTotal *prometheus.CounterVec
 	LogsFilterTotal   *prometheus.CounterVec
 	LogsSinkTotal     *prometheus.CounterVec
+
+	// Logs passed to the dead-letter sink after a Sink failed to store them.
+	LogsDeadLetterTotal *prometheus.CounterVec
+
+	// Metrics for each individual Filter and Sink, labeled by kind and by
+	// index in the Server's pipeline.
+	FilterLogsTotal       *prometheus.CounterVec
+	FilterDurationSeconds *prometheus.HistogramVec
+	SinkLogsTotal         *prometheus.CounterVec
+	SinkDurationSeconds   *prometheus.HistogramVec
+	SinkAbandonedTotal    *prometheus.CounterVec
+
+	// Metrics for each host which sends logs, or is expected to.
+	HostLastSeenSeconds    *prometheus.GaugeVec
+	HostReceivedBytesTotal *prometheus.CounterVec
+	HostUp                 *prometheus.GaugeVec
 }
 
 // NewMetrics sets up a Metrics structure for a Server, and also returns
@@ -106,10 +944,20 @@ func NewMetrics() (Metrics, *prometheus.Registry) {
 		namespace    = "netconsoled"
 		logSubsystem = "logs"
 
+		filterSubsystem = "filter"
+		sinkSubsystem   = "sink"
+		hostSubsystem   = "host"
+
 		labelHost   = "host"
 		labelStatus = "status"
+		labelFilter = "filter"
+		labelSink   = "sink"
+		labelIndex  = "index"
 	)
 
+	// Filters typically take microseconds, and Sinks may take seconds.
+	durationBuckets := prometheus.ExponentialBuckets(0.0001, 4, 9)
+
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(prometheus.NewGoCollector())
 	reg.MustRegister(prometheus.NewProcessCollector(os.Getpid(), ""))
@@ -138,9 +986,94 @@ func NewMetrics() (Metrics, *prometheus.Registry) {
 	}, []string{labelHost, labelStatus})
 	reg.MustRegister(logsSink)
 
+	logsDeadLetter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: logSubsystem,
+		Name:      "dead_letter_total",
+		Help:      "Total number of logs passed to the dead-letter sink by status.",
+	}, []string{labelHost, labelStatus})
+	reg.MustRegister(logsDeadLetter)
+
+	filterLogs := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: filterSubsystem,
+		Name:      "logs_total",
+		Help:      "Total number of logs passed through each filter by status.",
+	}, []string{labelFilter, labelIndex, labelStatus})
+	reg.MustRegister(filterLogs)
+
+	filterDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: filterSubsystem,
+		Name:      "duration_seconds",
+		Help:      "Time taken by each filter to process a log.",
+		Buckets:   durationBuckets,
+	}, []string{labelFilter, labelIndex})
+	reg.MustRegister(filterDuration)
+
+	sinkLogs := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: sinkSubsystem,
+		Name:      "logs_total",
+		Help:      "Total number of logs passed to each sink by status.",
+	}, []string{labelSink, labelIndex, labelStatus})
+	reg.MustRegister(sinkLogs)
+
+	sinkDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: sinkSubsystem,
+		Name:      "duration_seconds",
+		Help:      "Time taken by each sink to store a log.",
+		Buckets:   durationBuckets,
+	}, []string{labelSink, labelIndex})
+	reg.MustRegister(sinkDuration)
+
+	sinkAbandoned := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: sinkSubsystem,
+		Name:      "abandoned_total",
+		Help:      "Total number of calls to each sink abandoned after exceeding the sink timeout.",
+	}, []string{labelSink, labelIndex})
+	reg.MustRegister(sinkAbandoned)
+
+	hostLastSeen := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: hostSubsystem,
+		Name:      "last_seen_timestamp_seconds",
+		Help:      "UNIX timestamp of the most recent log received from each host.",
+	}, []string{labelHost})
+	reg.MustRegister(hostLastSeen)
+
+	hostBytes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: hostSubsystem,
+		Name:      "received_bytes_total",
+		Help:      "Total number of log message bytes received from each host.",
+	}, []string{labelHost})
+	reg.MustRegister(hostBytes)
+
+	hostUp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: hostSubsystem,
+		Name:      "up",
+		Help:      "Whether each expected host has sent logs within the silence threshold.",
+	}, []string{labelHost})
+	reg.MustRegister(hostUp)
+
 	return Metrics{
-		LogsReceivedTotal: logsRecv,
-		LogsFilterTotal:   logsFilter,
-		LogsSinkTotal:     logsSink,
+		LogsReceivedTotal:   logsRecv,
+		LogsFilterTotal:     logsFilter,
+		LogsSinkTotal:       logsSink,
+		LogsDeadLetterTotal: logsDeadLetter,
+
+		FilterLogsTotal:       filterLogs,
+		FilterDurationSeconds: filterDuration,
+		SinkLogsTotal:         sinkLogs,
+		SinkDurationSeconds:   sinkDuration,
+		SinkAbandonedTotal:    sinkAbandoned,
+
+		HostLastSeenSeconds:    hostLastSeen,
+		HostReceivedBytesTotal: hostBytes,
+		HostUp:                 hostUp,
 	}, reg
 }
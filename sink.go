@@ -1,10 +1,14 @@
 package netconsoled
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // defaultFormat is the default format descriptor for Sinks.
@@ -12,7 +16,8 @@ const defaultFormat = "[% 15s] [% 15f] %s"
 
 // A Sink enables storage of processed logs.
 //
-// Sinks may optionally implement io.Closer to flush data before the server halts.
+// Sinks may optionally implement io.Closer to flush data before the server halts,
+// and HealthChecker to report whether they are able to store logs.
 type Sink interface {
 	// Store stores a log to the Sink.
 	Store(d Data) error
@@ -21,23 +26,102 @@ type Sink interface {
 	fmt.Stringer
 }
 
+// A ContextSink is a Sink which accepts a context.Context, so that storing
+// a log can be canceled or given a deadline.
+type ContextSink interface {
+	Sink
+
+	// StoreContext is like Store, but ctx may be used to cancel the
+	// operation.
+	StoreContext(ctx context.Context, d Data) error
+}
+
+// ContextSinkAdapter adapts s into a ContextSink.  If s is already a
+// ContextSink, it is returned.  Otherwise, StoreContext returns an error if
+// ctx is done, and calls s's Store method if it is not.
+func ContextSinkAdapter(s Sink) ContextSink {
+	if cs, ok := s.(ContextSink); ok {
+		return cs
+	}
+
+	return &contextSink{Sink: s}
+}
+
+var _ ContextSink = &contextSink{}
+
+type contextSink struct {
+	Sink
+}
+
+func (s *contextSink) Close() error {
+	c, ok := s.Sink.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
+
+func (s *contextSink) CheckHealth() error { return checkHealth(s.Sink) }
+
+func (s *contextSink) StoreContext(ctx context.Context, d Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.Sink.Store(d)
+}
+
+// A HealthChecker is a type which can report its health.
+type HealthChecker interface {
+	// CheckHealth returns an error if the type is not healthy.
+	CheckHealth() error
+}
+
+// checkHealth checks the health of v if it implements HealthChecker.
+// Types which do not implement HealthChecker are assumed to be healthy.
+func checkHealth(v interface{}) error {
+	hc, ok := v.(HealthChecker)
+	if !ok {
+		return nil
+	}
+
+	return hc.CheckHealth()
+}
+
 // StdoutSink creates a Sink that writes log data to stdout.
 func StdoutSink() Sink {
 	return newNamedSink("stdout", WriterSink(os.Stdout))
 }
 
 // MultiSink chains zero or more Sinks together.  If any Sink returns an error,
-// subsequent Sinks in the chain are not invoked.
+// subsequent Sinks in the chain are not invoked, and the error is returned as
+// a *SinkError which identifies the Sink.
+//
+// When a MultiSink is used by a Server, each log is instead passed to every
+// Sink, even if some of them return an error, so that a failing Sink does not
+// prevent the others from storing the log.
 func MultiSink(sinks ...Sink) Sink {
 	return &multiSink{
 		sinks: sinks,
 	}
 }
 
-var _ Sink = &multiSink{}
+// fanoutSink creates a MultiSink which passes each log to every Sink, even if
+// some of them return an error.  If a single Sink fails, its error is returned
+// as a *SinkError; if several fail, SinkErrors is returned.
+func fanoutSink(sinks ...Sink) Sink {
+	return &multiSink{
+		sinks:  sinks,
+		fanout: true,
+	}
+}
+
+var _ ContextSink = &multiSink{}
 
 type multiSink struct {
-	sinks []Sink
+	sinks  []Sink
+	fanout bool
 }
 
 func (s *multiSink) Close() error {
@@ -56,19 +140,86 @@ func (s *multiSink) Close() error {
 	return nil
 }
 
-func (s *multiSink) Store(d Data) error {
+func (s *multiSink) inner() []Sink { return s.sinks }
+
+func (s *multiSink) CheckHealth() error {
 	for _, sink := range s.sinks {
-		if err := sink.Store(d); err != nil {
-			return err
+		if err := checkHealth(sink); err != nil {
+			return fmt.Errorf("sink %s is not healthy: %v", sink, err)
 		}
 	}
 
 	return nil
 }
 
+func (s *multiSink) Store(d Data) error { return s.StoreContext(context.Background(), d) }
+
+func (s *multiSink) StoreContext(ctx context.Context, d Data) error {
+	var errs SinkErrors
+	for _, sink := range s.sinks {
+		err := ContextSinkAdapter(sink).StoreContext(ctx, d)
+
+		// Keep the innermost Sinks for nested MultiSinks.
+		switch err := err.(type) {
+		case nil:
+			continue
+		case *SinkError:
+			errs = append(errs, err)
+		case SinkErrors:
+			errs = append(errs, err...)
+		default:
+			errs = append(errs, &SinkError{
+				Sink: sink.String(),
+				Err:  err,
+			})
+		}
+
+		if !s.fanout {
+			break
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
 func (s *multiSink) String() string {
-	// TODO(mdlayher): loop through sinks and list.
-	return "multi"
+	names := make([]string, 0, len(s.sinks))
+	for _, sink := range s.sinks {
+		names = append(names, sink.String())
+	}
+
+	return fmt.Sprintf("multi: [%s]", strings.Join(names, ", "))
+}
+
+// A SinkError is an error returned by a Sink within a MultiSink.
+type SinkError struct {
+	// Sink is the name of the Sink which returned the error.
+	Sink string
+
+	// Err is the error returned by the Sink.
+	Err error
+}
+
+func (e *SinkError) Error() string { return fmt.Sprintf("sink %s: %v", e.Sink, e.Err) }
+
+// SinkErrors is returned when more than one Sink within a MultiSink used by a
+// Server returns an error.
+type SinkErrors []*SinkError
+
+func (e SinkErrors) Error() string {
+	ss := make([]string, 0, len(e))
+	for _, err := range e {
+		ss = append(ss, err.Error())
+	}
+
+	return strings.Join(ss, "; ")
 }
 
 // FuncSink adapts a function into a Sink.
@@ -87,6 +238,128 @@ type funcSink struct {
 func (f *funcSink) Store(d Data) error { return f.fn(d) }
 func (f *funcSink) String() string     { return "func" }
 
+// FuncContextSink adapts a function which accepts a context.Context into a
+// ContextSink.
+func FuncContextSink(store func(ctx context.Context, d Data) error) ContextSink {
+	return &funcContextSink{
+		fn: store,
+	}
+}
+
+var _ ContextSink = &funcContextSink{}
+
+type funcContextSink struct {
+	fn func(ctx context.Context, d Data) error
+}
+
+func (f *funcContextSink) Store(d Data) error { return f.fn(context.Background(), d) }
+
+func (f *funcContextSink) StoreContext(ctx context.Context, d Data) error {
+	return f.fn(ctx, d)
+}
+
+func (f *funcContextSink) String() string { return "func" }
+
+// WalkSinks calls fn for each of sinks, and for each Sink which they pass
+// logs to, such as the members of a MultiSink or FailoverSink and the Sink
+// wrapped by a SpoolSink.
+func WalkSinks(sinks []Sink, fn func(sink Sink)) {
+	for _, sink := range sinks {
+		fn(sink)
+
+		if w, ok := sink.(wrapper); ok {
+			WalkSinks(w.inner(), fn)
+		}
+	}
+}
+
+// A wrapper is a Sink which passes logs to other Sinks.
+type wrapper interface {
+	inner() []Sink
+}
+
+// wrapSinks wraps sink, or each of the Sinks within sink if it is a
+// MultiSink, using fn.  MultiSinks are rebuilt to pass each log to every
+// Sink.
+func wrapSinks(sink Sink, fn func(s Sink) Sink) Sink {
+	ms, ok := sink.(*multiSink)
+	if !ok {
+		return fn(sink)
+	}
+
+	sinks := make([]Sink, 0, len(ms.sinks))
+	for _, s := range ms.sinks {
+		sinks = append(sinks, wrapSinks(s, fn))
+	}
+
+	return fanoutSink(sinks...)
+}
+
+// timeoutSink wraps a Sink and applies a timeout to each log it stores.
+// Each log is stored in its own goroutine, so that a Sink which does not
+// honor its context is abandoned at the deadline instead of blocking the
+// caller.
+type timeoutSink struct {
+	ContextSink
+	timeout time.Duration
+
+	// abandon, if not nil, is called each time a call to the Sink is
+	// abandoned.
+	abandon func()
+
+	// Number of abandoned calls which have not yet returned, accessed
+	// atomically.
+	pending int32
+}
+
+func (s *timeoutSink) Close() error {
+	c, ok := s.ContextSink.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	return c.Close()
+}
+
+func (s *timeoutSink) CheckHealth() error { return checkHealth(s.ContextSink) }
+
+func (s *timeoutSink) Store(d Data) error { return s.StoreContext(context.Background(), d) }
+
+func (s *timeoutSink) StoreContext(ctx context.Context, d Data) error {
+	// A Sink which is still blocked in an abandoned call is most likely
+	// hung, so fail immediately rather than starting more goroutines which
+	// will also block.
+	if atomic.LoadInt32(&s.pending) > 0 {
+		return fmt.Errorf("sink %s has not finished storing a previous log", s.ContextSink)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.ContextSink.StoreContext(ctx, d)
+	}()
+
+	select {
+	case err := <-errC:
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.AddInt32(&s.pending, 1)
+	go func() {
+		<-errC
+		atomic.AddInt32(&s.pending, -1)
+	}()
+
+	if s.abandon != nil {
+		s.abandon()
+	}
+
+	return ctx.Err()
+}
+
 // NoopSink returns a Sink that discards all logs.
 func NoopSink() Sink {
 	return &noopSink{}
@@ -164,6 +437,11 @@ func (s *writerSink) Store(d Data) error {
 
 func (s *writerSink) String() string { return "writer" }
 
+// formatLog formats d as a single line using the default format.
+func formatLog(d Data) string {
+	return fmt.Sprintf(defaultFormat, d.Addr, d.Log.Elapsed.Seconds(), d.Log.Message)
+}
+
 // newNamedSink wraps a Sink and replaces its name with the specified name.
 // This is primarily useful for composing Sinks and providing detailed information
 // to the user on startup.
@@ -190,5 +468,6 @@ func (s *namedSink) Close() error {
 
 	return c.Close()
 }
+func (s *namedSink) CheckHealth() error { return checkHealth(s.sink) }
 func (s *namedSink) Store(d Data) error { return s.sink.Store(d) }
 func (s *namedSink) String() string     { return s.name }
@@ -0,0 +1,752 @@
+package netconsoled
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled/internal/record"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// spoolExt is the file extension used for spool segment files.
+	spoolExt = ".spool"
+
+	// spoolCursorFile stores the position of the next log to be delivered.
+	spoolCursorFile = "cursor"
+
+	// spoolBatchSize is the maximum number of logs delivered at once to a
+	// Sink which implements BatchSink, unless the Sink configures its own
+	// batch size.
+	spoolBatchSize = 100
+)
+
+// DefaultSpoolSize is the default maximum size of a spool.
+const DefaultSpoolSize = 64 << 20
+
+// A SpoolConfig configures a spool Sink.
+type SpoolConfig struct {
+	// Dir is the directory which holds the spool.  It is created if it does
+	// not exist, and must not be shared with any other spool.
+	Dir string
+
+	// MaxSize is the maximum size of the spool in bytes.  When it is
+	// exceeded, the oldest logs are dropped.  If zero, DefaultSpoolSize is
+	// used.
+	MaxSize int64
+
+	// SegmentSize is the size of each spool file.  Logs are dropped one
+	// spool file at a time.  If zero, one eighth of MaxSize is used.
+	SegmentSize int64
+
+	// MinBackoff and MaxBackoff bound the delay between attempts to deliver
+	// a log.  If zero, 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// SpoolSink creates a Sink which writes each log to a queue on disk before
+// passing it to sink, so that logs are not lost when sink's backend is
+// unavailable.
+//
+// Logs are delivered to sink in order by a background goroutine, in batches
+// if sink implements BatchSink.  When sink fails to store a log, it is
+// retried indefinitely with exponential backoff, and new logs are queued
+// behind it.  A log is removed from the spool only once sink's Store or
+// StoreBatch method returns nil, so sink must not return before the log is
+// stored.  If the spool grows beyond its maximum size, the oldest logs are
+// dropped, and passed to the Server's DeadLetter sink.  Logs which have not
+// been delivered when the Sink is closed are delivered when the spool is
+// opened again.
+// Delivery is at least once: a log may be stored twice if the daemon stops
+// while it is being delivered.
+//
+// Closing the Sink stops any delivery in progress, including retries within
+// the Sinks in this package which retry with backoff, and also closes sink.
+// The spool's metrics, collected by registering the Sink as a
+// prometheus.Collector, do not include those of sink.
+func SpoolSink(cfg SpoolConfig, sink Sink) (Sink, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool directory must not be empty")
+	}
+	if sink == nil {
+		return nil, errors.New("spool must wrap a sink")
+	}
+
+	if cfg.MaxSize < 0 {
+		return nil, fmt.Errorf("spool maximum size must not be negative: %d", cfg.MaxSize)
+	}
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultSpoolSize
+	}
+
+	if cfg.SegmentSize < 0 || cfg.SegmentSize > cfg.MaxSize {
+		return nil, fmt.Errorf("spool segment size must be between 0 and %d: %d", cfg.MaxSize, cfg.SegmentSize)
+	}
+	if cfg.SegmentSize == 0 {
+		cfg.SegmentSize = cfg.MaxSize / 8
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 1 * time.Minute
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &spoolSink{
+		cfg:     cfg,
+		sink:    sink,
+		notifyC: make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "netconsoled",
+			Subsystem:   "spool",
+			Name:        "dropped_total",
+			Help:        "Total number of spooled logs dropped because the spool was full.",
+			ConstLabels: prometheus.Labels{"dir": cfg.Dir},
+		}),
+	}
+
+	s.pending = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "netconsoled",
+		Subsystem:   "spool",
+		Name:        "pending_logs",
+		Help:        "Number of spooled logs waiting to be delivered.",
+		ConstLabels: prometheus.Labels{"dir": cfg.Dir},
+	}, func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return float64(s.pendingLocked())
+	})
+
+	if err := s.open(); err != nil {
+		cancel()
+		_ = s.closeFiles()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	// Deliver any logs left from a previous run.
+	s.notify()
+
+	return s, nil
+}
+
+var (
+	_ Sink                 = &spoolSink{}
+	_ asyncSink            = &spoolSink{}
+	_ queueSink            = &spoolSink{}
+	_ prometheus.Collector = &spoolSink{}
+)
+
+type spoolSink struct {
+	failureHook
+
+	cfg  SpoolConfig
+	sink Sink
+
+	notifyC chan struct{}
+	wg      sync.WaitGroup
+
+	// ctx is canceled when the Sink is closed, to stop delivery and any
+	// retries in progress within sink.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pending prometheus.GaugeFunc
+	dropped prometheus.Counter
+
+	mu     sync.Mutex
+	segs   []*spoolSegment
+	size   int64
+	active *os.File
+	reader *os.File
+	cursor *os.File
+	read   spoolPosition
+	err    error
+	closed bool
+}
+
+// A spoolSegment is a single spool file.  The first segment is always the
+// one being read, and the last segment is always the one being written.
+type spoolSegment struct {
+	id   uint64
+	path string
+	size int64
+	n    int
+}
+
+// A spoolPosition is the position of the next log to be delivered: its
+// segment, its offset in the segment, and the number of logs before it.
+type spoolPosition struct {
+	id  uint64
+	off int64
+	n   int
+}
+
+func (s *spoolSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	// Wait for any delivery in progress, so the cursor is up to date.
+	s.cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	err := s.closeFiles()
+	s.mu.Unlock()
+
+	if c, ok := s.sink.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (s *spoolSink) inner() []Sink { return []Sink{s.sink} }
+
+func (s *spoolSink) CheckHealth() error {
+	s.mu.Lock()
+	err, n := s.err, s.pendingLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to deliver %d spooled logs: %v", n, err)
+	}
+
+	return checkHealth(s.sink)
+}
+
+func (s *spoolSink) saturated() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Once the spool spans several segments and is within one segment of
+	// its maximum size, filling another segment drops undelivered logs.
+	if len(s.segs) > 1 && s.size+s.cfg.SegmentSize > s.cfg.MaxSize {
+		return fmt.Errorf("spool %q holds %d of %d bytes", s.cfg.Dir, s.size, s.cfg.MaxSize)
+	}
+
+	return nil
+}
+
+func (s *spoolSink) Store(d Data) error {
+	b, err := encodeSpoolRecord(d)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	dropped, err := s.storeLocked(b)
+	s.mu.Unlock()
+
+	// Report logs dropped to make room once s.mu is released.
+	if len(dropped) > 0 {
+		s.failed(dropped, fmt.Errorf("dropped %d logs from full spool %q", len(dropped), s.cfg.Dir))
+	}
+
+	return err
+}
+
+// storeLocked appends a record to the spool, and returns the undelivered
+// logs which were dropped to make room for it.  The caller must hold s.mu.
+func (s *spoolSink) storeLocked(b []byte) ([]Data, error) {
+	if s.closed {
+		return nil, errors.New("sink is closed")
+	}
+
+	if _, err := s.active.Write(b); err != nil {
+		return nil, err
+	}
+
+	seg := s.segs[len(s.segs)-1]
+	seg.size += int64(len(b))
+	seg.n++
+	s.size += int64(len(b))
+
+	if seg.size >= s.cfg.SegmentSize {
+		if err := s.roll(); err != nil {
+			return nil, err
+		}
+	}
+
+	dropped, err := s.evict()
+	if err != nil {
+		return dropped, err
+	}
+
+	s.notify()
+	return dropped, nil
+}
+
+func (s *spoolSink) String() string {
+	return fmt.Sprintf("spool: %q -> %s", s.cfg.Dir, s.sink)
+}
+
+// Describe implements prometheus.Collector.
+func (s *spoolSink) Describe(ch chan<- *prometheus.Desc) {
+	s.pending.Describe(ch)
+	s.dropped.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *spoolSink) Collect(ch chan<- prometheus.Metric) {
+	s.pending.Collect(ch)
+	s.dropped.Collect(ch)
+}
+
+// notify wakes the delivery goroutine.
+func (s *spoolSink) notify() {
+	select {
+	case s.notifyC <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers spooled logs until the Sink is closed.
+func (s *spoolSink) run() {
+	defer s.wg.Done()
+
+	for {
+		ds, next, ok := s.next()
+		if !ok {
+			select {
+			case <-s.notifyC:
+				continue
+			case <-s.ctx.Done():
+				return
+			}
+		}
+
+		backoff := s.cfg.MinBackoff
+		for {
+			err := storeBatch(s.ctx, s.sink, ds)
+
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+
+			if err == nil {
+				break
+			}
+
+			select {
+			case <-time.After(backoff):
+			case <-s.ctx.Done():
+				return
+			}
+
+			backoff *= 2
+			if backoff > s.cfg.MaxBackoff {
+				backoff = s.cfg.MaxBackoff
+			}
+		}
+
+		s.advance(next)
+	}
+}
+
+// next reads the next logs to be delivered, and returns the position which
+// follows them.  If no logs are waiting, next returns false.
+func (s *spoolSink) next() ([]Data, spoolPosition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		seg := s.segs[0]
+		if s.read.off < seg.size {
+			break
+		}
+
+		// The last segment is still being written.
+		if len(s.segs) == 1 {
+			return nil, spoolPosition{}, false
+		}
+
+		// Every log in the first segment has been delivered.
+		if err := s.remove(); err != nil {
+			s.err = err
+			return nil, spoolPosition{}, false
+		}
+	}
+
+	seg := s.segs[0]
+
+	if s.reader == nil {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			s.err = err
+			return nil, spoolPosition{}, false
+		}
+
+		s.reader = f
+	}
+
+	max := 1
+	if _, ok := s.sink.(BatchSink); ok {
+		max = spoolBatchSize
+		if c := memberBatchConfig([]Sink{s.sink}); c.Size > 0 {
+			max = c.Size
+		}
+	}
+
+	var (
+		ds   []Data
+		next = spoolPosition{id: seg.id, off: s.read.off, n: s.read.n}
+		r    = io.NewSectionReader(s.reader, s.read.off, seg.size-s.read.off)
+	)
+
+	for len(ds) < max && next.off < seg.size {
+		d, n, err := decodeSpoolRecord(r)
+		if err != nil {
+			// Deliver the logs before the damaged record first.
+			if len(ds) > 0 {
+				break
+			}
+
+			// The rest of the segment cannot be read, so skip it.
+			s.err = fmt.Errorf("failed to read spooled log at offset %d in %q: %v", s.read.off, seg.path, err)
+			s.dropped.Add(float64(seg.n - s.read.n))
+			s.read.off, s.read.n = seg.size, seg.n
+
+			return nil, spoolPosition{}, false
+		}
+
+		ds = append(ds, d)
+		next.off += int64(n)
+		next.n++
+	}
+
+	return ds, next, true
+}
+
+// advance moves the cursor to next once a log has been delivered.
+func (s *spoolSink) advance(next spoolPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The log's segment was dropped while it was being delivered.
+	if s.read.id != next.id {
+		return
+	}
+
+	s.read = next
+	if err := s.writeCursor(); err != nil {
+		s.err = err
+	}
+}
+
+// remove deletes the first segment and moves the cursor to the segment
+// which follows it.
+func (s *spoolSink) remove() error {
+	seg := s.segs[0]
+
+	if s.reader != nil {
+		_ = s.reader.Close()
+		s.reader = nil
+	}
+
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.size -= seg.size
+	s.segs = s.segs[1:]
+	s.read = spoolPosition{id: s.segs[0].id}
+
+	return s.writeCursor()
+}
+
+// evict drops the oldest segments until the spool is within its maximum
+// size, and returns the undelivered logs which were dropped.  The segment
+// being written is never dropped.
+func (s *spoolSink) evict() ([]Data, error) {
+	var dropped []Data
+	for len(s.segs) > 1 && s.size > s.cfg.MaxSize {
+		s.dropped.Add(float64(s.segs[0].n - s.read.n))
+		dropped = append(dropped, s.unread()...)
+
+		if err := s.remove(); err != nil {
+			return dropped, err
+		}
+	}
+
+	return dropped, nil
+}
+
+// unread returns the logs in the first segment which have not been
+// delivered.  Logs which cannot be read are skipped.
+func (s *spoolSink) unread() []Data {
+	f, err := os.Open(s.segs[0].path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var (
+		ds []Data
+		r  = io.NewSectionReader(f, s.read.off, s.segs[0].size-s.read.off)
+	)
+
+	for {
+		d, _, err := decodeSpoolRecord(r)
+		if err != nil {
+			return ds
+		}
+
+		ds = append(ds, d)
+	}
+}
+
+// roll seals the segment being written and starts a new one.
+func (s *spoolSink) roll() error {
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+	if err := s.active.Close(); err != nil {
+		return err
+	}
+	s.active = nil
+
+	return s.openActive(s.segs[len(s.segs)-1].id + 1)
+}
+
+// pendingLocked returns the number of logs waiting to be delivered.  The
+// caller must hold s.mu.
+func (s *spoolSink) pendingLocked() int {
+	n := -s.read.n
+	for _, seg := range s.segs {
+		n += seg.n
+	}
+
+	return n
+}
+
+// open loads the spool files and cursor left by a previous run, if any.
+func (s *spoolSink) open() error {
+	ids, err := record.List(s.cfg.Dir, spoolExt)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		name := record.Name(id, spoolExt)
+
+		seg, err := loadSpoolSegment(filepath.Join(s.cfg.Dir, name), id)
+		if err != nil {
+			return fmt.Errorf("failed to load spool file %q: %v", name, err)
+		}
+
+		s.segs = append(s.segs, seg)
+	}
+
+	cursor, err := os.OpenFile(filepath.Join(s.cfg.Dir, spoolCursorFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	s.cursor = cursor
+
+	// A missing or damaged cursor delivers every spooled log again.
+	var b [24]byte
+	if _, err := cursor.ReadAt(b[:], 0); err == nil {
+		s.read = spoolPosition{
+			id:  binary.BigEndian.Uint64(b[0:8]),
+			off: int64(binary.BigEndian.Uint64(b[8:16])),
+			n:   int(binary.BigEndian.Uint64(b[16:24])),
+		}
+	}
+
+	// Delete segments which were delivered before the cursor was saved.
+	for len(s.segs) > 0 && s.segs[0].id < s.read.id {
+		if err := os.Remove(s.segs[0].path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		s.segs = s.segs[1:]
+	}
+
+	var next uint64
+	if len(s.segs) > 0 {
+		next = s.segs[len(s.segs)-1].id + 1
+	}
+
+	switch {
+	case len(s.segs) == 0 || s.segs[0].id != s.read.id:
+		// The cursor's segment no longer exists.
+		s.read = spoolPosition{}
+		if len(s.segs) > 0 {
+			s.read.id = s.segs[0].id
+		}
+	case s.read.off > s.segs[0].size || s.read.n > s.segs[0].n:
+		// The cursor's segment was truncated.
+		s.read.off, s.read.n = s.segs[0].size, s.segs[0].n
+	}
+
+	for _, seg := range s.segs {
+		s.size += seg.size
+	}
+
+	// Append to the last segment unless it is full.
+	if n := len(s.segs); n > 0 && s.segs[n-1].size < s.cfg.SegmentSize {
+		f, err := os.OpenFile(s.segs[n-1].path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		s.active = f
+	} else if err := s.openActive(next); err != nil {
+		return err
+	}
+
+	return s.writeCursor()
+}
+
+// openActive creates a new segment with the specified ID for writing.
+func (s *spoolSink) openActive(id uint64) error {
+	path := filepath.Join(s.cfg.Dir, record.Name(id, spoolExt))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.segs = append(s.segs, &spoolSegment{
+		id:   id,
+		path: path,
+	})
+	s.active = f
+
+	return nil
+}
+
+// writeCursor saves the cursor so that delivery resumes from it after a
+// restart.
+func (s *spoolSink) writeCursor() error {
+	var b [24]byte
+	binary.BigEndian.PutUint64(b[0:8], s.read.id)
+	binary.BigEndian.PutUint64(b[8:16], uint64(s.read.off))
+	binary.BigEndian.PutUint64(b[16:24], uint64(s.read.n))
+
+	_, err := s.cursor.WriteAt(b[:], 0)
+	return err
+}
+
+// closeFiles flushes and closes all open files.
+func (s *spoolSink) closeFiles() error {
+	var err error
+	if s.active != nil {
+		err = s.active.Sync()
+		if cerr := s.active.Close(); err == nil {
+			err = cerr
+		}
+		s.active = nil
+	}
+
+	for _, f := range []**os.File{&s.reader, &s.cursor} {
+		if *f == nil {
+			continue
+		}
+
+		if cerr := (*f).Close(); err == nil {
+			err = cerr
+		}
+		*f = nil
+	}
+
+	return err
+}
+
+// loadSpoolSegment counts the logs in the spool file at path.  If the file
+// ends with a partially written record, the file is truncated to remove it.
+func loadSpoolSegment(path string, id uint64) (*spoolSegment, error) {
+	seg := &spoolSegment{
+		id:   id,
+		path: path,
+	}
+
+	size, err := record.Load(path, true, func(_ record.Record, _ int64) {
+		seg.n++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seg.size = size
+	return seg, nil
+}
+
+// encodeSpoolRecord encodes d with its header.
+func encodeSpoolRecord(d Data) ([]byte, error) {
+	var addr string
+	if d.Addr != nil {
+		addr = d.Addr.String()
+	}
+
+	var t int64
+	if !d.Time.IsZero() {
+		t = d.Time.UnixNano()
+	}
+
+	return record.Encode(record.Record{
+		Time:    t,
+		Addr:    addr,
+		Elapsed: int64(d.Log.Elapsed),
+		Message: d.Log.Message,
+		Host:    d.Hostname,
+
+		Synthetic: string(d.Synthetic),
+	})
+}
+
+// decodeSpoolRecord decodes a single log from r, returning the log and the
+// number of bytes read.  io.EOF is returned only if r contains no more data.
+func decodeSpoolRecord(r io.Reader) (Data, int, error) {
+	sr, n, err := record.Decode(r)
+	if err != nil {
+		return Data{}, 0, err
+	}
+
+	d := Data{
+		Log: netconsole.Log{
+			Elapsed: time.Duration(sr.Elapsed),
+			Message: sr.Message,
+		},
+		Hostname:  sr.Host,
+		Synthetic: Event(sr.Synthetic),
+	}
+
+	if sr.Time != 0 {
+		d.Time = time.Unix(0, sr.Time)
+	}
+	if sr.Addr != "" {
+		d.Addr = relayAddr(sr.Addr)
+	}
+
+	return d, n, nil
+}
@@ -0,0 +1,493 @@
+package netconsoled_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestSpoolSinkRetry(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	// Fail to store the first few logs, as if a backend is unavailable.
+	var (
+		mu    sync.Mutex
+		fails = 3
+		got   []netconsoled.Data
+		doneC = make(chan struct{})
+	)
+
+	in := []netconsoled.Data{
+		testData(1, 1, "hello"),
+		testData(2, 2, "world"),
+		testData(1, 3, "foo"),
+	}
+
+	inner := netconsoled.FuncSink(func(d netconsoled.Data) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fails > 0 {
+			fails--
+			return errors.New("backend unavailable")
+		}
+
+		got = append(got, d)
+		if len(got) == len(in) {
+			close(doneC)
+		}
+
+		return nil
+	})
+
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{
+		Dir:        dir,
+		MinBackoff: 1 * time.Millisecond,
+	}, inner)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	for _, d := range in {
+		if err := sink.Store(d); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	select {
+	case <-doneC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for logs")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(in, got); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+
+	if err := sink.(netconsoled.HealthChecker).CheckHealth(); err != nil {
+		t.Fatalf("sink is not healthy: %v", err)
+	}
+}
+
+func TestSpoolSinkBatch(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	// Fill the spool before reopening it with a sink which stores batches.
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{Dir: dir}, netconsoled.FuncSink(func(_ netconsoled.Data) error {
+		return errors.New("backend unavailable")
+	}))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for _, m := range []string{"a", "b", "c"} {
+		if err := sink.Store(testData(1, 1, m)); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	inner := &testBatchSink{}
+	sink, err = netconsoled.SpoolSink(netconsoled.SpoolConfig{Dir: dir}, inner)
+	if err != nil {
+		t.Fatalf("failed to reopen sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		inner.mu.Lock()
+		got := inner.batches
+		inner.mu.Unlock()
+
+		if len(got) > 0 {
+			// All spooled logs are delivered in a single batch.
+			if diff := cmp.Diff([][]string{{"a", "b", "c"}}, got); diff != "" {
+				t.Fatalf("unexpected batches (-want +got):\n%s", diff)
+			}
+
+			return
+		}
+
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("timed out waiting for logs")
+		}
+	}
+}
+
+func TestSpoolSinkLoki(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	// Fail the first pushes, as if Loki is unavailable.
+	var (
+		mu    sync.Mutex
+		fails = 3
+		got   []string
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streams := decodeLokiPush(t, r)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if fails > 0 {
+			fails--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		for _, v := range streams {
+			got = append(got, v...)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	loki, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL:        srv.URL,
+		MaxRetries: -1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create Loki sink: %v", err)
+	}
+
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{
+		Dir:        dir,
+		MinBackoff: 1 * time.Millisecond,
+	}, loki)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	if err := sink.Store(testData(1, 1, "hello")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	// The log stays in the spool until a push succeeds.
+	timeout := time.After(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+
+		if n > 0 {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("timed out waiting for logs")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff(0, fails); diff != "" {
+		t.Fatalf("unexpected remaining failures (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"[    1.000000] hello"}, got); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpoolSinkCloseRetrying(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	// Always fail, so the Loki sink waits to retry its push.
+	reqC := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case reqC <- struct{}{}:
+		default:
+		}
+
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	loki, err := netconsoled.LokiSink(netconsoled.LokiConfig{
+		URL:        srv.URL,
+		MinBackoff: 1 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("failed to create Loki sink: %v", err)
+	}
+
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{Dir: dir}, loki)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	if err := sink.Store(testData(1, 1, "hello")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	select {
+	case <-reqC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for push")
+	}
+
+	// Closing the spool must not wait for the Loki sink's backoff.
+	errC := make(chan error, 1)
+	go func() {
+		errC <- sink.(io.Closer).Close()
+	}()
+
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatalf("failed to close sink: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out closing sink")
+	}
+
+	// The log is kept for the next time the spool is opened.
+	if diff := cmp.Diff([]string{"hello"}, testSpoolDrain(t, dir, 1)); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpoolSinkRestart(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	// Deliver the first log, and then fail until the daemon is restarted.
+	var (
+		mu        sync.Mutex
+		delivered bool
+		firstC    = make(chan struct{})
+	)
+
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{
+		Dir:        dir,
+		MinBackoff: 1 * time.Millisecond,
+	}, netconsoled.FuncSink(func(d netconsoled.Data) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if delivered {
+			return errors.New("backend unavailable")
+		}
+
+		delivered = true
+		close(firstC)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := sink.Store(testData(1, i, fmt.Sprintf("log %d", i))); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	select {
+	case <-firstC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for first log")
+	}
+
+	// Wait for the next delivery attempt to fail.
+	hc := sink.(netconsoled.HealthChecker)
+	for i := 0; hc.CheckHealth() == nil; i++ {
+		if i == 500 {
+			t.Fatal("timed out waiting for sink to become unhealthy")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	// Only logs which were not delivered are delivered after a restart.
+	got := testSpoolDrain(t, dir, 2)
+
+	want := []string{"log 1", "log 2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected logs (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpoolSinkMaxSize(t *testing.T) {
+	dir := testSpoolDir(t)
+	defer os.RemoveAll(dir)
+
+	const (
+		maxSize = 4096
+		n       = 200
+	)
+
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{
+		Dir:         dir,
+		MaxSize:     maxSize,
+		SegmentSize: maxSize / 4,
+		MinBackoff:  1 * time.Hour,
+	}, netconsoled.FuncSink(func(_ netconsoled.Data) error {
+		return errors.New("backend unavailable")
+	}))
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := sink.Store(testData(1, i, fmt.Sprintf("log %03d", i))); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	if err := sink.(io.Closer).Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read spool directory: %v", err)
+	}
+
+	var size int64
+	for _, fi := range fis {
+		if filepath.Ext(fi.Name()) == ".spool" {
+			size += fi.Size()
+		}
+	}
+
+	if size > maxSize {
+		t.Fatalf("spool size %d exceeds maximum size %d", size, maxSize)
+	}
+
+	// The oldest logs were dropped, and the newest logs remain in order.
+	got := testSpoolDrain(t, dir, 0)
+	if len(got) >= n {
+		t.Fatalf("expected logs to be dropped, but %d logs were delivered", len(got))
+	}
+
+	if diff := cmp.Diff(fmt.Sprintf("log %03d", n-1), got[len(got)-1]); diff != "" {
+		t.Fatalf("unexpected newest log (-want +got):\n%s", diff)
+	}
+}
+
+func TestSpoolSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.SpoolConfig
+		sink netconsoled.Sink
+	}{
+		{
+			name: "no directory",
+			sink: netconsoled.NoopSink(),
+		},
+		{
+			name: "no sink",
+			cfg:  netconsoled.SpoolConfig{Dir: "/tmp/spool"},
+		},
+		{
+			name: "max size",
+			cfg:  netconsoled.SpoolConfig{Dir: "/tmp/spool", MaxSize: -1},
+			sink: netconsoled.NoopSink(),
+		},
+		{
+			name: "segment size",
+			cfg:  netconsoled.SpoolConfig{Dir: "/tmp/spool", MaxSize: 1024, SegmentSize: 2048},
+			sink: netconsoled.NoopSink(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.SpoolSink(tt.cfg, tt.sink); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func testSpoolDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "netconsoled_spool")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	return dir
+}
+
+// testSpoolDrain reopens the spool in dir and returns the messages of the
+// logs it delivers.  If n is zero, logs are delivered until the spool is
+// empty, and the messages are checked to be in order.
+func testSpoolDrain(t *testing.T, dir string, n int) []string {
+	t.Helper()
+
+	dataC := make(chan netconsoled.Data, 1024)
+	sink, err := netconsoled.SpoolSink(netconsoled.SpoolConfig{Dir: dir}, netconsoled.FuncSink(func(d netconsoled.Data) error {
+		dataC <- d
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to reopen sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	timeout := time.After(5 * time.Second)
+
+	var got []string
+	for n == 0 || len(got) < n {
+		select {
+		case d := <-dataC:
+			got = append(got, d.Log.Message)
+		case <-time.After(100 * time.Millisecond):
+			if n == 0 {
+				if len(got) == 0 {
+					t.Fatal("no logs were delivered")
+				}
+
+				for i := 1; i < len(got); i++ {
+					if got[i-1] >= got[i] {
+						t.Fatalf("logs delivered out of order: %q before %q", got[i-1], got[i])
+					}
+				}
+
+				return got
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for logs")
+		}
+	}
+
+	return got
+}
@@ -0,0 +1,366 @@
+package netconsoled
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/netconsole"
+)
+
+const (
+	// maxSyslogLen is the maximum length of a syslog message.  It is also
+	// large enough to hold any UDP datagram.
+	maxSyslogLen = 64 * 1024
+
+	// maxSyslogLenPrefix is the maximum length of the message length prefix
+	// used by octet counting framing, including its trailing space.
+	maxSyslogLenPrefix = 10
+)
+
+// A SyslogMessage is a parsed RFC 3164 or RFC 5424 syslog message.
+type SyslogMessage struct {
+	Facility int
+	Severity int
+
+	// Fields which may be empty if not present in a message.
+	Time     time.Time
+	Hostname string
+	AppName  string
+
+	Message string
+}
+
+// ParseSyslog parses an RFC 3164 or RFC 5424 syslog message.  Parsing of
+// RFC 3164 messages is lenient, because the format is loosely defined.
+func ParseSyslog(b []byte) (SyslogMessage, error) {
+	s := strings.TrimRight(string(b), "\r\n\x00")
+
+	// Both formats begin with a priority: "<PRI>".
+	end := strings.IndexByte(s, '>')
+	if len(s) < 3 || s[0] != '<' || end < 2 || end > 4 {
+		return SyslogMessage{}, errors.New("syslog: missing priority")
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return SyslogMessage{}, fmt.Errorf("syslog: invalid priority: %q", s[1:end])
+	}
+
+	m := SyslogMessage{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+
+	s = s[end+1:]
+	if strings.HasPrefix(s, "1 ") {
+		err = parseRFC5424(&m, s[2:])
+	} else {
+		parseRFC3164(&m, s)
+	}
+	if err != nil {
+		return SyslogMessage{}, err
+	}
+
+	return m, nil
+}
+
+// parseRFC5424 parses the remainder of an RFC 5424 message after its version.
+func parseRFC5424(m *SyslogMessage, s string) error {
+	// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+	fields := make([]string, 5)
+	for i := range fields {
+		j := strings.IndexByte(s, ' ')
+		if j == -1 {
+			if i != len(fields)-1 {
+				return errors.New("syslog: truncated RFC 5424 header")
+			}
+
+			fields[i], s = s, ""
+			break
+		}
+
+		fields[i], s = s[:j], s[j+1:]
+	}
+
+	if fields[0] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("syslog: invalid timestamp: %v", err)
+		}
+
+		m.Time = t
+	}
+
+	m.Hostname = nilValue(fields[1])
+	m.AppName = nilValue(fields[2])
+
+	// Skip the structured data, which may contain escaped characters.
+	switch {
+	case s == "" || s == "-":
+		s = ""
+	case strings.HasPrefix(s, "- "):
+		s = s[2:]
+	case strings.HasPrefix(s, "["):
+		var (
+			inValue bool
+			escaped bool
+			i       int
+		)
+
+	loop:
+		for ; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case escaped:
+				escaped = false
+			case inValue && c == '\\':
+				escaped = true
+			case c == '"':
+				inValue = !inValue
+			case !inValue && c == ']':
+				// The structured data ends unless another element follows.
+				if i+1 == len(s) || s[i+1] != '[' {
+					i++
+					break loop
+				}
+			}
+		}
+
+		s = strings.TrimPrefix(s[i:], " ")
+	default:
+		return errors.New("syslog: invalid structured data")
+	}
+
+	// The message may begin with a UTF-8 byte order mark.
+	m.Message = strings.TrimPrefix(s, "\ufeff")
+	return nil
+}
+
+// parseRFC3164 parses the remainder of an RFC 3164 message after its priority.
+func parseRFC3164(m *SyslogMessage, s string) {
+	// TIMESTAMP is always 15 characters, e.g. "Jan  2 15:04:05".
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if t, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			// The year is not included, so assume the current year.
+			now := time.Now()
+			m.Time = time.Date(now.Year(), t.Month(), t.Day(),
+				t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+
+			s = s[len(time.Stamp)+1:]
+
+			// HOSTNAME follows the timestamp.
+			if i := strings.IndexByte(s, ' '); i != -1 {
+				m.Hostname, s = s[:i], s[i+1:]
+			}
+		}
+	}
+
+	// TAG is terminated by a colon or the beginning of a process ID.
+	if i := strings.IndexAny(s, ":[ "); i > 0 && i <= 32 && s[i] != ' ' {
+		m.AppName = s[:i]
+
+		if j := strings.Index(s, ": "); j != -1 {
+			s = s[j+2:]
+		}
+	}
+
+	m.Message = s
+}
+
+// nilValue returns the empty string for the RFC 5424 NILVALUE, "-".
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+
+	return s
+}
+
+// syslogData converts a syslog message into a netconsole log.  Kernel logs
+// forwarded over syslog commonly retain the timestamp prefix added by the
+// kernel, which is used as the elapsed time if present.
+//
+// The message's severity is retained as a kernel log level prefix, unless
+// the message already has one, and its hostname is retained as the
+// Hostname of the Data.
+func syslogData(b []byte) (Data, error) {
+	m, err := ParseSyslog(b)
+	if err != nil {
+		return Data{}, err
+	}
+
+	l := netconsole.Log{Message: m.Message}
+	if strings.HasPrefix(m.Message, "[") {
+		if pl, err := netconsole.ParseLog(m.Message); err == nil {
+			l = pl
+		}
+	}
+
+	if _, msg := ParseLevel(l.Message); msg == l.Message {
+		l.Message = fmt.Sprintf("<%d>%s", m.Severity, l.Message)
+	}
+
+	return Data{
+		Log:      l,
+		Hostname: m.Hostname,
+	}, nil
+}
+
+// ServeSyslog serves syslog messages received on pc until ctx is canceled.
+// Each message which is successfully parsed is converted to a netconsole log
+// and passed to Handle, and any malformed messages are discarded.
+func (s *Server) ServeSyslog(ctx context.Context, pc net.PacketConn) error {
+	return s.servePacket(ctx, pc, maxSyslogLen, syslogData)
+}
+
+// ServeSyslogStream serves syslog messages received by connections accepted
+// on l until ctx is canceled, like ServeSyslog.  Messages may be framed using
+// either octet counting or trailing newlines.
+//
+// Connections which are idle for longer than SyslogIdleTimeout are closed, and
+// at most MaxSyslogConns connections are served at once.
+func (s *Server) ServeSyslogStream(ctx context.Context, l net.Listener) error {
+	defer s.listen()()
+	defer closeOnDone(ctx, l)()
+
+	max := s.MaxSyslogConns
+	if max == 0 {
+		max = DefaultMaxSyslogConns
+	}
+	semC := make(chan struct{}, max)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			// Canceled context closes the listener.
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		select {
+		case semC <- struct{}{}:
+		default:
+			s.ErrorLog.Printf("error serving syslog stream from %s: too many connections", c.RemoteAddr())
+			_ = c.Close()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-semC
+				wg.Done()
+			}()
+			defer closeOnDone(ctx, c)()
+
+			s.serveSyslogConn(ctx, c)
+		}()
+	}
+}
+
+// serveSyslogConn handles syslog messages from a single stream connection.
+func (s *Server) serveSyslogConn(ctx context.Context, c net.Conn) {
+	timeout := s.SyslogIdleTimeout
+	if timeout == 0 {
+		timeout = DefaultSyslogIdleTimeout
+	}
+
+	br := bufio.NewReaderSize(c, maxSyslogLen)
+	for {
+		// Each message must arrive before the deadline, so that idle
+		// connections do not consume resources indefinitely.
+		_ = c.SetReadDeadline(time.Now().Add(timeout))
+
+		b, err := readSyslogFrame(br)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				s.ErrorLog.Printf("closing idle syslog stream from %s", c.RemoteAddr())
+				return
+			}
+
+			if err != io.EOF {
+				s.ErrorLog.Printf("error reading syslog stream from %s: %v", c.RemoteAddr(), err)
+			}
+
+			return
+		}
+
+		d, err := syslogData(b)
+		if err != nil {
+			continue
+		}
+
+		d.Addr = c.RemoteAddr()
+		d.Time = time.Now()
+
+		// Shutdown must not cancel a message which was already read.
+		s.HandleData(d)
+	}
+}
+
+// readSyslogFrame reads a single syslog message from a stream, framed either
+// using octet counting, as described in RFC 6587 and RFC 5425, or using
+// a trailing newline.
+func readSyslogFrame(br *bufio.Reader) ([]byte, error) {
+	c, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if c[0] < '0' || c[0] > '9' {
+		// Non-transparent framing.
+		b, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return nil, errors.New("syslog message is too long")
+		}
+		if err != nil && (err != io.EOF || len(b) == 0) {
+			return nil, err
+		}
+
+		return b, nil
+	}
+
+	// Bound the length prefix so that a client cannot send an endless
+	// stream of digits.
+	p, err := br.Peek(maxSyslogLenPrefix)
+	i := bytes.IndexByte(p, ' ')
+	if i == -1 {
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("invalid syslog message length: %q", p)
+	}
+
+	ns := string(p[:i])
+	if _, err := br.Discard(i + 1); err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(ns)
+	if err != nil || n < 0 || n > maxSyslogLen {
+		return nil, fmt.Errorf("invalid syslog message length: %q", ns)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
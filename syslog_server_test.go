@@ -0,0 +1,354 @@
+package netconsoled_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestParseSyslog(t *testing.T) {
+	year := time.Now().Year()
+
+	tests := []struct {
+		name string
+		s    string
+		m    netconsoled.SyslogMessage
+		ok   bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "no priority",
+			s:    "hello world",
+		},
+		{
+			name: "bad priority",
+			s:    "<192>hello world",
+		},
+		{
+			name: "RFC 5424 bad timestamp",
+			s:    "<14>1 yesterday host app - - - hello world",
+		},
+		{
+			name: "RFC 5424 truncated",
+			s:    "<14>1 - host",
+		},
+		{
+			name: "RFC 5424",
+			s:    "<14>1 2017-01-01T00:00:00.000000Z host app 123 ID1 - hello world\n",
+			m: netconsoled.SyslogMessage{
+				Facility: 1,
+				Severity: 6,
+				Time:     time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+				Hostname: "host",
+				AppName:  "app",
+				Message:  "hello world",
+			},
+			ok: true,
+		},
+		{
+			name: "RFC 5424 nil values and BOM",
+			s:    "<3>1 - - - - - - \ufeffhello world",
+			m: netconsoled.SyslogMessage{
+				Severity: 3,
+				Message:  "hello world",
+			},
+			ok: true,
+		},
+		{
+			name: "RFC 5424 structured data",
+			s:    `<6>1 - host kernel - - [a@1 x="]\"["][b@1 y="z"] [    1.500000] hello world`,
+			m: netconsoled.SyslogMessage{
+				Severity: 6,
+				Hostname: "host",
+				AppName:  "kernel",
+				Message:  "[    1.500000] hello world",
+			},
+			ok: true,
+		},
+		{
+			name: "RFC 3164",
+			s:    "<4>Jan  2 15:04:05 host kernel: [    1.500000] hello world",
+			m: netconsoled.SyslogMessage{
+				Severity: 4,
+				Time:     time.Date(year, time.January, 2, 15, 4, 5, 0, time.Local),
+				Hostname: "host",
+				AppName:  "kernel",
+				Message:  "[    1.500000] hello world",
+			},
+			ok: true,
+		},
+		{
+			name: "RFC 3164 process ID",
+			s:    "<30>Jan 12 15:04:05 host app[123]: hello world",
+			m: netconsoled.SyslogMessage{
+				Facility: 3,
+				Severity: 6,
+				Time:     time.Date(year, time.January, 12, 15, 4, 5, 0, time.Local),
+				Hostname: "host",
+				AppName:  "app",
+				Message:  "hello world",
+			},
+			ok: true,
+		},
+		{
+			name: "RFC 3164 message only",
+			s:    "<13>hello world",
+			m: netconsoled.SyslogMessage{
+				Facility: 1,
+				Severity: 5,
+				Message:  "hello world",
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := netconsoled.ParseSyslog([]byte(tt.s))
+			if err != nil && tt.ok {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil && !tt.ok {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServerServeSyslog(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen UDP: %v", err)
+	}
+
+	s, dataC := testSyslogServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.ServeSyslog(ctx, pc)
+	}()
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to dial UDP: %v", err)
+	}
+	defer c.Close()
+
+	// Messages larger than a page must not be truncated.
+	long := strings.Repeat("x", 8192)
+
+	// Malformed messages are discarded.
+	for _, msg := range []string{
+		"malformed",
+		"<6>Jan  2 15:04:05 host kernel: [    1.500000] hello world",
+		"<3>Jan  2 15:04:05 host kernel: " + long,
+	} {
+		if _, err := c.Write([]byte(msg)); err != nil {
+			t.Fatalf("failed to write message: %v", err)
+		}
+	}
+
+	want := []netconsoled.Data{
+		{
+			Log: netconsole.Log{
+				Elapsed: 1500 * time.Millisecond,
+				Message: "<6>hello world",
+			},
+			Hostname: "host",
+		},
+		{
+			Log: netconsole.Log{
+				Message: "<3>" + long,
+			},
+			Hostname: "host",
+		},
+	}
+
+	for i, w := range want {
+		if diff := cmp.Diff(w, receiveData(t, dataC), syslogDataComparer); diff != "" {
+			t.Fatalf("unexpected log %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+}
+
+func TestServerServeSyslogStream(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen TCP: %v", err)
+	}
+
+	s, dataC := testSyslogServer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.ServeSyslogStream(ctx, l)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial TCP: %v", err)
+	}
+
+	// Octet counting and newline framing may be mixed on one connection.
+	rfc5424 := "<4>1 - host kernel - - - [    2.000000] octet counted"
+	msgs := fmt.Sprintf("%d %s<6>newline delimited\n", len(rfc5424), rfc5424)
+
+	if _, err := c.Write([]byte(msgs)); err != nil {
+		t.Fatalf("failed to write messages: %v", err)
+	}
+
+	want := []netconsoled.Data{
+		{
+			Log: netconsole.Log{
+				Elapsed: 2 * time.Second,
+				Message: "<4>octet counted",
+			},
+			Hostname: "host",
+		},
+		{
+			Log: netconsole.Log{
+				Message: "<6>newline delimited",
+			},
+		},
+	}
+
+	for i, w := range want {
+		if diff := cmp.Diff(w, receiveData(t, dataC), syslogDataComparer); diff != "" {
+			t.Fatalf("unexpected log %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	// A connection which sends a message length without an end is closed.
+	bad, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial TCP: %v", err)
+	}
+	defer bad.Close()
+
+	if _, err := bad.Write([]byte(strings.Repeat("9", 64))); err != nil {
+		t.Fatalf("failed to write message length: %v", err)
+	}
+
+	_ = bad.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := bad.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected connection to be closed, but got: %v", err)
+	}
+
+	if err := s.Ready(); err != nil {
+		t.Fatalf("expected server to be ready: %v", err)
+	}
+
+	// The open connection must not prevent the server from stopping.
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+	_ = c.Close()
+}
+
+func TestServerServeSyslogStreamLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen TCP: %v", err)
+	}
+
+	s, dataC := testSyslogServer()
+	s.SyslogIdleTimeout = 500 * time.Millisecond
+	s.MaxSyslogConns = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.ServeSyslogStream(ctx, l)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial TCP: %v", err)
+	}
+	defer c.Close()
+
+	// Wait for the first connection to be served.
+	if _, err := c.Write([]byte("<6>hello world\n")); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	receiveData(t, dataC)
+
+	// A connection beyond the limit is closed immediately.
+	extra, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial TCP: %v", err)
+	}
+	defer extra.Close()
+
+	_ = extra.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+	if _, err := extra.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected extra connection to be closed, but got: %v", err)
+	}
+
+	// The idle connection is closed once the timeout expires.
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected idle connection to be closed, but got: %v", err)
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+}
+
+func testSyslogServer() (*netconsoled.Server, <-chan netconsoled.Data) {
+	dataC := make(chan netconsoled.Data, 2)
+
+	return &netconsoled.Server{
+		Filter: netconsoled.NoopFilter(),
+		Sink: netconsoled.FuncSink(func(d netconsoled.Data) error {
+			dataC <- d
+			return nil
+		}),
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}, dataC
+}
+
+// syslogDataComparer compares Data received by a syslog listener, ignoring
+// the fields set by the listener.
+var syslogDataComparer = cmp.Comparer(func(x, y netconsoled.Data) bool {
+	return x.Log == y.Log && x.Hostname == y.Hostname
+})
+
+func receiveData(t *testing.T, dataC <-chan netconsoled.Data) netconsoled.Data {
+	t.Helper()
+
+	select {
+	case d := <-dataC:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for log")
+	}
+
+	panic("unreachable")
+}
@@ -0,0 +1,261 @@
+package netconsoled_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestSyslogSinkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen UDP: %v", err)
+	}
+	defer pc.Close()
+
+	sink, err := netconsoled.SyslogSink(netconsoled.SyslogConfig{
+		Network: "udp",
+		Addr:    pc.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	if err := sink.Store(syslogData("<3>hello world")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	b := make([]byte, 1024)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+
+	want := `<3>1 2017-01-01T00:00:00.000000Z 192.168.1.1 kernel - - [netconsole@32473 elapsed="1.500000"] hello world`
+
+	if diff := cmp.Diff(want, string(b[:n])); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestSyslogSinkTCPReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen TCP: %v", err)
+	}
+	defer l.Close()
+	_ = l.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+
+	sink, err := netconsoled.SyslogSink(netconsoled.SyslogConfig{
+		Network: "tcp",
+		Addr:    l.Addr().String(),
+		Format:  netconsoled.SyslogRFC3164,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	want := "<6>Jan  1 00:00:00 192.168.1.1 kernel: [    1.500000] hello world"
+
+	// Accept a connection, read one message, and then drop the connection
+	// to force the sink to reconnect for the second message.
+	for i := 0; i < 2; i++ {
+		if err := sink.Store(syslogData("hello world")); err != nil {
+			t.Fatalf("failed to store log %d: %v", i, err)
+		}
+
+		c, err := l.Accept()
+		if err != nil {
+			t.Fatalf("failed to accept: %v", err)
+		}
+
+		got := readOctetCounted(t, bufio.NewReader(c))
+		_ = c.Close()
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("unexpected message %d (-want +got):\n%s", i, diff)
+		}
+
+		if i == 0 {
+			// The first write after the server closes the connection may
+			// appear to succeed, so store a log which is expected to be lost
+			// and give the sink time to observe the reset connection.
+			time.Sleep(50 * time.Millisecond)
+			_ = sink.Store(syslogData("lost"))
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func TestSyslogSinkTLS(t *testing.T) {
+	server, client := testTLSConfigs(t)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatalf("failed to listen TLS: %v", err)
+	}
+	defer l.Close()
+
+	sink, err := netconsoled.SyslogSink(netconsoled.SyslogConfig{
+		Network:   "tls",
+		Addr:      l.Addr().String(),
+		TLSConfig: client,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	defer sink.(io.Closer).Close()
+
+	msgC := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Errorf("failed to accept: %v", err)
+			msgC <- ""
+			return
+		}
+		defer c.Close()
+
+		msgC <- readOctetCounted(t, bufio.NewReader(c))
+	}()
+
+	if err := sink.Store(syslogData("hello world")); err != nil {
+		t.Fatalf("failed to store log: %v", err)
+	}
+
+	if msg := <-msgC; !strings.HasSuffix(msg, "] hello world") {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+}
+
+func TestSyslogSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.SyslogConfig
+	}{
+		{
+			name: "network",
+			cfg:  netconsoled.SyslogConfig{Network: "foo", Addr: "localhost:514"},
+		},
+		{
+			name: "format",
+			cfg:  netconsoled.SyslogConfig{Network: "udp", Addr: "localhost:514", Format: "foo"},
+		},
+		{
+			name: "address",
+			cfg:  netconsoled.SyslogConfig{Network: "udp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.SyslogSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// readOctetCounted reads a single octet-counted syslog message.
+func readOctetCounted(t *testing.T, br *bufio.Reader) string {
+	s, err := br.ReadString(' ')
+	if err != nil {
+		t.Errorf("failed to read message length: %v", err)
+		return ""
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		t.Errorf("failed to parse message length: %v", err)
+		return ""
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Errorf("failed to read message: %v", err)
+		return ""
+	}
+
+	return string(b)
+}
+
+func syslogData(msg string) netconsoled.Data {
+	return netconsoled.Data{
+		Addr: &net.UDPAddr{
+			IP:   net.IPv4(192, 168, 1, 1),
+			Port: 6666,
+		},
+		Log: netconsole.Log{
+			Elapsed: 1500 * time.Millisecond,
+			Message: msg,
+		},
+		Time: time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// testTLSConfigs generates a self-signed certificate for 127.0.0.1 and returns
+// TLS configurations for a server and a client which trusts it.
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "netconsoled test"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	server = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	}
+
+	client = &tls.Config{
+		RootCAs: pool,
+	}
+
+	return server, client
+}
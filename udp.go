@@ -0,0 +1,99 @@
+package netconsoled
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// A UDPConfig configures a UDP forwarding Sink.
+type UDPConfig struct {
+	// Addrs are the addresses of the netconsole listeners which receive
+	// each log.
+	Addrs []string
+
+	// StripElapsed removes the elapsed time prefix from each log, as sent by
+	// kernels which do not include timestamps in their logs.
+	StripElapsed bool
+}
+
+// UDPSink creates a Sink which forwards logs in the netconsole wire format
+// to one or more netconsole listeners over UDP, so that logs from a single
+// netconsole target can be fanned out to many receivers.
+//
+// Each log is sent as a single datagram, prefixed with its original elapsed
+// time unless StripElapsed is set.  Receivers see netconsoled as the source
+// of each log, so a UDPSink must not forward logs to the Server which
+// processes them.
+func UDPSink(cfg UDPConfig) (Sink, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, errors.New("UDP sink must have at least one address")
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(cfg.Addrs))
+	for _, a := range cfg.Addrs {
+		addr, err := net.ResolveUDPAddr("udp", a)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve UDP sink address: %v", err)
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	c, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &udpSink{
+		cfg:   cfg,
+		c:     c,
+		addrs: addrs,
+	}, nil
+}
+
+var _ Sink = &udpSink{}
+
+type udpSink struct {
+	cfg   UDPConfig
+	c     *net.UDPConn
+	addrs []*net.UDPAddr
+}
+
+func (s *udpSink) Close() error { return s.c.Close() }
+
+func (s *udpSink) Store(d Data) error {
+	b := []byte(formatNetconsole(d.Log.Elapsed, d.Log.Message, !s.cfg.StripElapsed))
+
+	// Send the log to every address, even if some of them fail.
+	var errs []string
+	for _, addr := range s.addrs {
+		if _, err := s.c.WriteToUDP(b, addr); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to forward log to %d of %d addresses: %s",
+			len(errs), len(s.addrs), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (s *udpSink) String() string {
+	return fmt.Sprintf("udp: %s", strings.Join(s.cfg.Addrs, ", "))
+}
+
+// formatNetconsole formats a log in the netconsole wire format, optionally
+// with its elapsed time prefix.
+func formatNetconsole(elapsed time.Duration, msg string, prefix bool) string {
+	if !prefix {
+		return msg + "\n"
+	}
+
+	return fmt.Sprintf("[%5d.%06d] %s\n",
+		elapsed/time.Second, (elapsed%time.Second)/time.Microsecond, msg)
+}
@@ -0,0 +1,118 @@
+package netconsoled_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsole"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestUDPSink(t *testing.T) {
+	tests := []struct {
+		name  string
+		strip bool
+		want  string
+	}{
+		{
+			name: "elapsed",
+			want: "[    1.500042] hello world\n",
+		},
+		{
+			name:  "strip elapsed",
+			strip: true,
+			want:  "hello world\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Fan out logs to multiple listeners.
+			var (
+				pcs   []net.PacketConn
+				addrs []string
+			)
+
+			for i := 0; i < 2; i++ {
+				pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatalf("failed to listen: %v", err)
+				}
+				defer pc.Close()
+
+				pcs = append(pcs, pc)
+				addrs = append(addrs, pc.LocalAddr().String())
+			}
+
+			sink, err := netconsoled.UDPSink(netconsoled.UDPConfig{
+				Addrs:        addrs,
+				StripElapsed: tt.strip,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+			defer sink.(io.Closer).Close()
+
+			d := testData(1, 1, "hello world")
+			d.Log.Elapsed = 1500042 * time.Microsecond
+
+			if err := sink.Store(d); err != nil {
+				t.Fatalf("failed to store log: %v", err)
+			}
+
+			for _, pc := range pcs {
+				b := make([]byte, 1024)
+				_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := pc.ReadFrom(b)
+				if err != nil {
+					t.Fatalf("failed to read datagram: %v", err)
+				}
+
+				if diff := cmp.Diff(tt.want, string(b[:n])); diff != "" {
+					t.Fatalf("unexpected datagram (-want +got):\n%s", diff)
+				}
+
+				if tt.strip {
+					continue
+				}
+
+				// Logs with an elapsed prefix can be parsed by any netconsole
+				// listener, including netconsoled.
+				l, err := netconsole.ParseLog(string(b[:n]))
+				if err != nil {
+					t.Fatalf("failed to parse log: %v", err)
+				}
+
+				if diff := cmp.Diff(d.Log.Elapsed, l.Elapsed); diff != "" {
+					t.Fatalf("unexpected elapsed time (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestUDPSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.UDPConfig
+	}{
+		{
+			name: "no addresses",
+		},
+		{
+			name: "bad address",
+			cfg:  netconsoled.UDPConfig{Addrs: []string{"localhost:6666", "localhost:foo"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.UDPSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
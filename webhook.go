@@ -0,0 +1,247 @@
+package netconsoled
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultWebhookBody is the default body template for a webhook Sink, which
+// is compatible with Slack and Mattermost incoming webhooks.
+const DefaultWebhookBody = `{"text":{{json (lines .)}}}`
+
+// A WebhookConfig configures a webhook Sink.
+type WebhookConfig struct {
+	// URL is the URL of the webhook.  It may contain a secret, as with
+	// incoming webhooks for chat services, so only its scheme and host are
+	// included in the Sink's name.
+	URL string
+
+	// Method is the HTTP method used to send requests.  If empty, POST
+	// is used.
+	Method string
+
+	// Headers are added to each request.  If no Content-Type header is set,
+	// "application/json" is used.
+	Headers map[string]string
+
+	// Body is a text/template which is executed with a batch of logs,
+	// a []Data, to produce the body of each request.  In addition to the
+	// standard functions, the template may use:
+	//  - json: encode a value as JSON
+	//  - event: the Event detected in a log, if any
+	//  - level: the Level of a log
+	//  - format: format a log as a single line
+	//  - lines: format a batch of logs as newline-separated lines
+	// If empty, DefaultWebhookBody is used.
+	Body string
+
+	// Events, if set, restricts the Sink to logs which contain one of the
+	// specified Events, such as EventPanic.  If empty, all logs are sent.
+	Events []Event
+
+	// BatchSize is the maximum number of logs sent in a single request.
+	// If zero, the Server's Batch.Size is used.
+	BatchSize int
+
+	// BatchWait is the window in which logs are batched into a single
+	// request.  If zero, the Server's Batch.Wait is used.
+	BatchWait time.Duration
+
+	// RateLimit, if set, is the minimum amount of time between requests.
+	// When the Sink is used by a Server, logs continue to be batched while
+	// waiting.
+	RateLimit time.Duration
+
+	// MaxRetries is the number of times a failed request is retried, with
+	// exponential backoff.  If zero, 5 is used; if negative, requests are
+	// not retried.
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the delay between retries.  If zero,
+	// 500 milliseconds and 1 minute are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout is the timeout for each request.  If zero, 10 seconds is used.
+	Timeout time.Duration
+}
+
+// WebhookSink creates a BatchSink which sends batches of logs to an HTTP
+// webhook, using a templated request body.  Each batch of logs is sent in a
+// single request, and requests which fail are retried with exponential
+// backoff before an error is returned.
+func WebhookSink(cfg WebhookConfig) (BatchSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook URL must use HTTP or HTTPS: %q", cfg.URL)
+	}
+
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+
+	if cfg.Body == "" {
+		cfg.Body = DefaultWebhookBody
+	}
+
+	body, err := template.New("body").Funcs(webhookFuncs).Parse(cfg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse webhook body template: %v", err)
+	}
+
+	for _, e := range cfg.Events {
+		if !knownEvent(e) {
+			return nil, fmt.Errorf("unknown webhook event: %q", e)
+		}
+	}
+
+	if cfg.BatchSize < 0 {
+		return nil, fmt.Errorf("webhook batch size must not be negative: %d", cfg.BatchSize)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &webhookSink{
+		cfg:    cfg,
+		name:   originURL(u),
+		body:   body,
+		retry:  newRetrier(cfg.MaxRetries, cfg.MinBackoff, cfg.MaxBackoff),
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+var (
+	_ BatchSink        = &webhookSink{}
+	_ contextBatchSink = &webhookSink{}
+)
+
+type webhookSink struct {
+	healthState
+
+	cfg    WebhookConfig
+	name   string
+	body   *template.Template
+	retry  retrier
+	client *http.Client
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (s *webhookSink) Store(d Data) error { return s.StoreBatch([]Data{d}) }
+
+func (s *webhookSink) batchConfig() BatchConfig {
+	return BatchConfig{Size: s.cfg.BatchSize, Wait: s.cfg.BatchWait}
+}
+
+func (s *webhookSink) StoreBatch(ds []Data) error {
+	return s.storeBatchContext(context.Background(), ds)
+}
+
+func (s *webhookSink) storeBatchContext(ctx context.Context, ds []Data) error {
+	if len(s.cfg.Events) > 0 {
+		var match []Data
+		for _, d := range ds {
+			if containsEvent(s.cfg.Events, d.Event()) {
+				match = append(match, d)
+			}
+		}
+
+		ds = match
+	}
+
+	if len(ds) == 0 {
+		return nil
+	}
+
+	return s.set(s.push(ctx, ds))
+}
+
+func (s *webhookSink) String() string {
+	return fmt.Sprintf("webhook: %s %s", s.cfg.Method, s.name)
+}
+
+// push sends a single batch of logs, obeying the rate limit and retrying
+// with backoff if needed until ctx is done.
+func (s *webhookSink) push(ctx context.Context, ds []Data) error {
+	var body bytes.Buffer
+	if err := s.body.Execute(&body, ds); err != nil {
+		return fmt.Errorf("failed to execute webhook body template: %v", err)
+	}
+
+	err := s.retry.Do(ctx, func() (bool, error) {
+		s.wait()
+
+		req, err := http.NewRequest(s.cfg.Method, s.cfg.URL, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return false, err
+		}
+		req = req.WithContext(ctx)
+
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range s.cfg.Headers {
+			req.Header.Set(k, v)
+		}
+
+		_, retry, err := doHTTP(s.client, req)
+		return retry, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send %d logs to webhook: %v", len(ds), err)
+	}
+
+	return nil
+}
+
+// wait blocks until a request may be sent without exceeding the rate limit.
+func (s *webhookSink) wait() {
+	if s.cfg.RateLimit <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.cfg.RateLimit - time.Since(s.last); d > 0 {
+		time.Sleep(d)
+	}
+
+	s.last = time.Now()
+}
+
+// webhookFuncs are the functions available to webhook body templates.
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"event": func(d Data) Event {
+		return d.Event()
+	},
+	"level": func(d Data) Level {
+		l, _ := ParseLevel(d.Log.Message)
+		return l
+	},
+	"format": formatLog,
+	"lines": func(ds []Data) string {
+		ss := make([]string, 0, len(ds))
+		for _, d := range ds {
+			ss = append(ss, formatLog(d))
+		}
+
+		return strings.Join(ss, "\n")
+	},
+}
@@ -0,0 +1,184 @@
+package netconsoled_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/netconsoled"
+)
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.WebhookConfig
+		want []string
+	}{
+		{
+			name: "default body",
+			want: []string{
+				`{"text":"[192.168.1.1:6666] [       1.000000] hello\n[192.168.1.1:6666] [       2.000000] Kernel panic - not syncing: foo"}`,
+			},
+		},
+		{
+			name: "events and template",
+			cfg: netconsoled.WebhookConfig{
+				Method:  http.MethodPut,
+				Headers: map[string]string{"Content-Type": "text/plain"},
+				Body:    `{{range .}}{{.Host}} {{event .}} {{level .}}{{end}}`,
+				Events:  []netconsoled.Event{netconsoled.EventPanic},
+			},
+			want: []string{
+				"192.168.1.1 panic info",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu  sync.Mutex
+				got []string
+			)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, contentType := http.MethodPost, "application/json"
+				if tt.cfg.Method != "" {
+					method, contentType = tt.cfg.Method, "text/plain"
+				}
+
+				if diff := cmp.Diff(method, r.Method); diff != "" {
+					t.Errorf("unexpected method (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(contentType, r.Header.Get("Content-Type")); diff != "" {
+					t.Errorf("unexpected content type (-want +got):\n%s", diff)
+				}
+
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("failed to read body: %v", err)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, string(b))
+			}))
+			defer srv.Close()
+
+			cfg := tt.cfg
+			cfg.URL = srv.URL
+
+			sink, err := netconsoled.WebhookSink(cfg)
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			if err := sink.StoreBatch([]netconsoled.Data{
+				testData(1, 1, "hello"),
+				testData(1, 2, "Kernel panic - not syncing: foo"),
+			}); err != nil {
+				t.Fatalf("failed to store logs: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected requests (-want +got):\n%s", diff)
+			}
+
+			// The default body must always be valid JSON.
+			if tt.cfg.Body == "" {
+				var v interface{}
+				if err := json.Unmarshal([]byte(got[0]), &v); err != nil {
+					t.Fatalf("failed to unmarshal JSON: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookSinkRateLimitRetry(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Fail the first request so it must be retried.
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	const limit = 50 * time.Millisecond
+
+	sink, err := netconsoled.WebhookSink(netconsoled.WebhookConfig{
+		URL:        srv.URL,
+		RateLimit:  limit,
+		MinBackoff: 1 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sink.Store(testData(1, i, "hello")); err != nil {
+			t.Fatalf("failed to store log: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// One failed request, followed by one request for each log.
+	if diff := cmp.Diff(3, len(times)); diff != "" {
+		t.Fatalf("unexpected number of requests (-want +got):\n%s", diff)
+	}
+
+	// Allow for a small amount of jitter between sending and receiving.
+	const min = limit - 10*time.Millisecond
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < min {
+			t.Fatalf("request %d sent %s after previous request, expected at least %s", i, d, min)
+		}
+	}
+}
+
+func TestWebhookSinkBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  netconsoled.WebhookConfig
+	}{
+		{
+			name: "URL",
+			cfg:  netconsoled.WebhookConfig{URL: "localhost"},
+		},
+		{
+			name: "body",
+			cfg:  netconsoled.WebhookConfig{URL: "http://localhost", Body: "{{"},
+		},
+		{
+			name: "event",
+			cfg:  netconsoled.WebhookConfig{URL: "http://localhost", Events: []netconsoled.Event{"foo"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := netconsoled.WebhookSink(tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package netconsoled
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements the minimal subset of RFC 6455 needed to stream
+// text messages to a WebSocket client.
+
+// webSocketGUID is used to compute the Sec-WebSocket-Accept header.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xa
+)
+
+const (
+	// maxFrameSize is the maximum size of a frame accepted from a client.
+	maxFrameSize = 64 * 1024
+
+	// wsWriteTimeout bounds the time spent writing a single frame, so that
+	// a stalled client is eventually disconnected.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// isWebSocket determines if r is a WebSocket upgrade request.
+func isWebSocket(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// headerContains determines if the comma-separated header key contains token.
+func headerContains(h http.Header, key, token string) bool {
+	for _, v := range h[key] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// A webSocket is a server-side WebSocket connection.
+type webSocket struct {
+	c  net.Conn
+	br *bufio.Reader
+
+	// mu serializes frame writes.
+	mu sync.Mutex
+}
+
+// acceptWebSocket performs the WebSocket opening handshake for r and
+// takes over the underlying connection from w.
+//
+// If the request is not a valid WebSocket upgrade, acceptWebSocket replies
+// to the client with an HTTP error.  Once acceptWebSocket attempts to take
+// over the connection, w must no longer be used, even if an error is returned.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*webSocket, error) {
+	if err := checkWebSocket(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		err := errors.New("websocket: connection cannot be hijacked")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	c, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	_, _ = io.WriteString(h, key+webSocketGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	_ = c.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err = fmt.Fprintf(c, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return &webSocket{
+		c:  c,
+		br: brw.Reader,
+	}, nil
+}
+
+// checkWebSocket verifies that r is a valid WebSocket upgrade request.
+func checkWebSocket(r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return errors.New("websocket: method must be GET")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return errors.New("websocket: unsupported version")
+	}
+	if r.Header.Get("Sec-WebSocket-Key") == "" {
+		return errors.New("websocket: missing key")
+	}
+
+	return nil
+}
+
+// Close closes the connection.
+func (ws *webSocket) Close() error {
+	// Best effort: notify the client before closing the connection.
+	_ = ws.writeFrame(opClose, nil)
+	return ws.c.Close()
+}
+
+// WriteText writes s as a single text message.
+func (ws *webSocket) WriteText(s string) error {
+	return ws.writeFrame(opText, []byte(s))
+}
+
+// discard reads and discards frames from the client, responding to pings,
+// until the client closes the connection or an error occurs.
+func (ws *webSocket) discard() {
+	for {
+		op, b, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+
+		switch op {
+		case opClose:
+			return
+		case opPing:
+			if err := ws.writeFrame(opPong, b); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readFrame reads a single frame from the client.
+func (ws *webSocket) readFrame() (byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(ws.br, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	op := hdr[0] & 0x0f
+	masked := hdr[1]&0x80 != 0
+
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(b[:])
+
+		// The most significant bit of a 64-bit length must be zero.
+		if n&(1<<63) != 0 {
+			return 0, nil, errors.New("websocket: invalid frame payload length")
+		}
+	}
+
+	// Clients must mask all frames sent to a server.
+	if !masked {
+		return 0, nil, errors.New("websocket: client frame is not masked")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return 0, nil, err
+	}
+
+	if n > maxFrameSize {
+		// Skip oversized frames which are not useful to us anyway.
+		if _, err := io.CopyN(ioutil.Discard, ws.br, int64(n)); err != nil {
+			return 0, nil, err
+		}
+
+		return op, nil, nil
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(ws.br, b); err != nil {
+		return 0, nil, err
+	}
+
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+
+	return op, b, nil
+}
+
+// writeFrame writes a single unmasked, final frame with the specified
+// opcode and payload.
+func (ws *webSocket) writeFrame(op byte, b []byte) error {
+	hdr := []byte{0x80 | op, 0}
+
+	switch n := len(b); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = append(hdr, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = append(hdr, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	_ = ws.c.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := ws.c.Write(append(hdr, b...))
+	return err
+}